@@ -0,0 +1,492 @@
+// Package client implements the client side of the delegated proving flow:
+// it generates the FHE keys, uploads them with an optional encrypted witness,
+// requests proofs from the server and decrypts and verifies them.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/protocol"
+	"github.com/nulltea/lumenos/vdec"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+const DefaultPollInterval = 2 * time.Second
+
+// Config describes the matrix the server proves and how the session talks to it.
+//
+// The dimensions, ring degree, plaintext modulus and code rate are taken from the
+// server. When set, they are expectations that Connect checks against it.
+type Config struct {
+	Rows int
+	Cols int
+	LogN int
+
+	// Modulus is the plaintext modulus.
+	Modulus uint64
+	// RhoInv is the inverse rate of the Ligero code.
+	RhoInv int
+	// Packing is the number of columns the witness packs per ciphertext, see fhe.LigeroMetadata.Window.
+	Packing int
+
+	// RingSwitchLogN requests inner products to be ring switched to this ring degree, disabled if zero.
+	RingSwitchLogN int
+	// Vdec makes DecryptAndProve prove correct decryption of the queried columns.
+	Vdec bool
+	// VdecBatches is the number of independent random linear combinations the decryption proof batches the columns
+	// into, vdec.DefaultBatches if zero. More batches cost proving time, and with LaZer proof size,
+	// but reduce the batching soundness error.
+	VdecBatches int
+	// Scheme is the FHE scheme the decryption proof is made for. GBFV proofs need the LaZer backend
+	// and can only be checked by the client that produced them.
+	Scheme vdec.Scheme
+
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// PollInterval is the delay between job status polls, DefaultPollInterval if zero.
+	PollInterval time.Duration
+	// OnStatus, if set, is called with every job status received while waiting for a proof.
+	OnStatus func(protocol.JobStatus)
+}
+
+// Session holds the client's secret key and the state shared with one server.
+// A Session is not safe for concurrent use.
+type Session struct {
+	url    string
+	cfg    Config
+	http   *http.Client
+	params bgv.Parameters
+	client *fhe.ClientBFV
+
+	// galoisElements are the elements the server requires Galois keys for
+	galoisElements []uint64
+
+	keysUploaded bool
+	// witness is the plaintext of the uploaded witness, used to compute claimed values
+	witness [][]*core.Element
+	// root is the Merkle root returned by Commit, which opened proofs must carry
+	root []byte
+}
+
+// Proof is an encrypted proof received from the server.
+type Proof struct {
+	Point uint64
+	// Value is the claimed evaluation, nil if neither the server nor the session know it.
+	Value     *uint64
+	Encrypted *fhe.EncryptedProof
+}
+
+// Connect fetches the parameters of the server at serverURL, checks them against
+// the expectations in cfg and generates the session's secret key.
+// With cfg.Vdec set, parameters the decryption proof cannot be generated under are rejected.
+func Connect(ctx context.Context, serverURL string, cfg Config) (*Session, error) {
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.VdecBatches == 0 {
+		cfg.VdecBatches = vdec.DefaultBatches
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	s := &Session{
+		url:  strings.TrimSuffix(serverURL, "/"),
+		http: httpClient,
+	}
+
+	serverParams, err := s.fetchParams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, err := range []error{
+		expect("rows", cfg.Rows, serverParams.Ligero.Rows),
+		expect("cols", cfg.Cols, serverParams.Ligero.Cols),
+		expect("rho inverse", cfg.RhoInv, serverParams.Ligero.RhoInv),
+		expect("packing", cfg.Packing, serverParams.Ligero.Packing),
+		expect("logN", cfg.LogN, serverParams.BGV.LogN),
+		expect("plaintext modulus", cfg.Modulus, serverParams.BGV.PlaintextModulus),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	cfg.Rows, cfg.Cols, cfg.RhoInv = serverParams.Ligero.Rows, serverParams.Ligero.Cols, serverParams.Ligero.RhoInv
+	cfg.Packing = serverParams.Ligero.Packing
+	cfg.LogN, cfg.Modulus = serverParams.BGV.LogN, serverParams.BGV.PlaintextModulus
+
+	params, err := bgv.NewParametersFromLiteral(serverParams.BGV)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrParamsMismatch, err)
+	}
+	if cfg.Vdec {
+		if err := vdec.CheckParameters(params, cfg.Scheme, cfg.VdecBatches); err != nil {
+			return nil, fmt.Errorf("verifiable decryption is not supported by the server's parameters: %w", err)
+		}
+	}
+
+	ptField, err := core.NewPrimeField(params.PlaintextModulus(), cfg.Cols*2)
+	if err != nil {
+		return nil, err
+	}
+
+	sk := rlwe.NewKeyGenerator(params).GenSecretKeyNew()
+	client := fhe.NewClientBFV(&ptField, params, sk)
+
+	if cfg.RingSwitchLogN != 0 {
+		rs, err := fhe.NewRingSwitchClient(client, cfg.RingSwitchLogN)
+		if err != nil {
+			return nil, err
+		}
+		client.SetRingSwitch(rs)
+	}
+
+	s.cfg = cfg
+	s.params = params
+	s.client = client
+	s.galoisElements = serverParams.GaloisElements
+	return s, nil
+}
+
+// expect checks a parameter advertised by the server against the expected one, if set.
+func expect[T comparable](name string, expected, actual T) error {
+	var unset T
+	if expected != unset && expected != actual {
+		return fmt.Errorf("%w: server uses %s %v, expected %v", ErrParamsMismatch, name, actual, expected)
+	}
+	return nil
+}
+
+// Config returns the session's configuration, completed with the server's parameters.
+func (s *Session) Config() Config {
+	return s.cfg
+}
+
+func (s *Session) Params() bgv.Parameters {
+	return s.params
+}
+
+func (s *Session) Client() *fhe.ClientBFV {
+	return s.client
+}
+
+// UploadKeys generates the public and evaluation keys and streams them to the server.
+func (s *Session) UploadKeys(ctx context.Context) error {
+	kgen := rlwe.NewKeyGenerator(s.params)
+	sk := s.client.SecretKey()
+
+	keys := &protocol.Keys{
+		PublicKey:          kgen.GenPublicKeyNew(sk),
+		RelinearizationKey: kgen.GenRelinearizationKeyNew(sk),
+		GaloisKeys:         kgen.GenGaloisKeysNew(s.galoisElements, sk),
+	}
+
+	if rs := s.client.RingSwitch(); rs != nil {
+		keys.RingSwitchEvk = rs.RingSwitchEvk
+		keys.RingSwitchParams = &rs.ParamsLit
+	}
+
+	err := s.upload(ctx, "upload keys", protocol.PathKeys, func(w io.Writer) error {
+		return protocol.WriteKeys(w, keys)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.keysUploaded = true
+	return nil
+}
+
+// UploadWitness encrypts the row-major matrix column by column, split into segments if it has more rows than
+// slots, and streams it to the server,
+// which then proves the polynomial it encodes instead of a random one.
+func (s *Session) UploadWitness(ctx context.Context, matrix [][]*core.Element) error {
+	if len(matrix) != s.cfg.Rows {
+		return fmt.Errorf("%w: %d rows, expected %d", ErrWitnessShape, len(matrix), s.cfg.Rows)
+	}
+	for i, row := range matrix {
+		if len(row) != s.cfg.Cols {
+			return fmt.Errorf("%w: row %d has %d columns, expected %d", ErrWitnessShape, i, len(row), s.cfg.Cols)
+		}
+	}
+
+	columns, err := fhe.EncryptMatrix(ctx, matrix, s.cfg.Packing, s.params, s.client)
+	if err != nil {
+		return err
+	}
+
+	err = s.upload(ctx, "upload witness", protocol.PathWitness, func(w io.Writer) error {
+		return protocol.WriteWitness(w, columns)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.witness = matrix
+	// The new witness is opened once committed
+	s.root = nil
+	return nil
+}
+
+// RequestProof submits a proving job for point, waits for it to finish and downloads the proof.
+func (s *Session) RequestProof(ctx context.Context, point uint64) (*Proof, error) {
+	if !s.keysUploaded {
+		return nil, ErrKeysNotUploaded
+	}
+
+	jobID, err := s.awaitJob(ctx, point)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, "download proof", http.MethodGet, fmt.Sprintf("%s/%s/proof", protocol.PathJobs, jobID), "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response, err := protocol.ReadProof(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("client: read proof: %w", err)
+	}
+
+	return s.newProof(point, response)
+}
+
+// Commit makes the server commit to the uploaded witness, or a random matrix if none, and returns the Merkle root.
+// The commitment is kept by the server, so that Open proves evaluations without encoding the matrix again.
+func (s *Session) Commit(ctx context.Context) ([]byte, error) {
+	if !s.keysUploaded {
+		return nil, ErrKeysNotUploaded
+	}
+
+	resp, err := s.do(ctx, "commit", http.MethodPost, protocol.PathCommit, "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var commitment protocol.Commitment
+	if err := json.NewDecoder(resp.Body).Decode(&commitment); err != nil {
+		return nil, fmt.Errorf("client: decode commitment: %w", err)
+	}
+
+	s.root = commitment.Root
+	return commitment.Root, nil
+}
+
+// Open downloads proofs of the committed polynomial at points, in order, from the commitment made by Commit.
+// Every proof must open the committed root.
+func (s *Session) Open(ctx context.Context, points ...uint64) ([]*Proof, error) {
+	if s.root == nil {
+		return nil, ErrNotCommitted
+	}
+
+	query := url.Values{}
+	for _, point := range points {
+		query.Add("point", strconv.FormatUint(point, 10))
+	}
+	resp, err := s.do(ctx, "open", http.MethodPost, protocol.PathOpen+"?"+query.Encode(), "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	openings, err := protocol.ReadOpenings(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("client: read openings: %w", err)
+	}
+	if len(openings) != len(points) {
+		return nil, fmt.Errorf("client: server opened %d points, requested %d", len(openings), len(points))
+	}
+
+	proofs := make([]*Proof, len(openings))
+	for i, opening := range openings {
+		if opening.Point != points[i] {
+			return nil, fmt.Errorf("client: server opened point %d, requested %d", opening.Point, points[i])
+		}
+		if proofs[i], err = s.newProof(opening.Point, &opening.Proof); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(proofs[i].Encrypted.Root, s.root) {
+			return nil, fmt.Errorf("%w: proof at point %d", ErrRootMismatch, opening.Point)
+		}
+	}
+	return proofs, nil
+}
+
+// newProof unmarshals the encrypted proof of response, completing its claimed value from the witness if known.
+func (s *Session) newProof(point uint64, response *protocol.Proof) (*Proof, error) {
+	encrypted := &fhe.EncryptedProof{}
+	if err := encrypted.UnmarshalBinary(response.EncryptedProof, &s.params); err != nil {
+		return nil, fmt.Errorf("client: unmarshal encrypted proof: %w", err)
+	}
+
+	proof := &Proof{Point: point, Value: response.Value, Encrypted: encrypted}
+	if proof.Value == nil && s.witness != nil {
+		value := core.NewDensePolyFromMatrix(s.witness).Evaluate(s.client.Field(), core.NewElement(point)).Uint64()
+		proof.Value = &value
+	}
+
+	return proof, nil
+}
+
+// DecryptAndProve decrypts the proof and, if enabled, proves its correct decryption.
+func (s *Session) DecryptAndProve(ctx context.Context, proof *Proof) (*fhe.Proof, error) {
+	span := core.StartSpan("Decrypt proof", nil, "Decrypting proof...")
+	decrypted, err := proof.Encrypted.Decrypt(ctx, s.client, span)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.Vdec {
+		if err := decrypted.ProveDecrypt(s.client, s.cfg.Scheme, s.cfg.VdecBatches, span); err != nil {
+			return nil, err
+		}
+	}
+
+	return decrypted, nil
+}
+
+// Verify checks the decrypted proof against the point and claimed value of proof,
+// and its decryption proof if present.
+func (s *Session) Verify(proof *Proof, decrypted *fhe.Proof) error {
+	if proof.Value == nil {
+		return ErrNoValue
+	}
+
+	transcript := core.NewTranscript(protocol.TranscriptLabel)
+	span := core.StartSpan("Verify proof", nil)
+	defer span.EndWithNewline()
+
+	if err := decrypted.Verify(core.NewElement(proof.Point), core.NewElement(*proof.Value), s.client.Field(), transcript); err != nil {
+		return err
+	}
+	if decrypted.DecryptionProof != nil {
+		return decrypted.VerifyDecrypt(s.params, s.client.Field(), s.cfg.Scheme, s.cfg.VdecBatches)
+	}
+	return nil
+}
+
+func (s *Session) fetchParams(ctx context.Context) (*protocol.Params, error) {
+	resp, err := s.do(ctx, "fetch params", http.MethodGet, protocol.PathParams, "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	params := &protocol.Params{}
+	if err := json.NewDecoder(resp.Body).Decode(params); err != nil {
+		return nil, fmt.Errorf("client: decode params: %w", err)
+	}
+	return params, nil
+}
+
+// awaitJob submits a proving job for point and polls it until it finishes.
+func (s *Session) awaitJob(ctx context.Context, point uint64) (string, error) {
+	resp, err := s.do(ctx, "submit job", http.MethodPost, fmt.Sprintf("%s?point=%d", protocol.PathJobs, point), "", nil, http.StatusAccepted)
+	if err != nil {
+		return "", err
+	}
+	status, err := decodeJobStatus(resp)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if s.cfg.OnStatus != nil {
+			s.cfg.OnStatus(status)
+		}
+
+		switch status.State {
+		case protocol.JobDone:
+			return status.ID, nil
+		case protocol.JobFailed, protocol.JobCanceled:
+			return "", &JobError{ID: status.ID, State: status.State, Message: status.Error}
+		}
+
+		select {
+		case <-ctx.Done():
+			s.cancelJob(status.ID)
+			return "", ctx.Err()
+		case <-time.After(s.cfg.PollInterval):
+		}
+
+		resp, err = s.do(ctx, "poll job", http.MethodGet, protocol.PathJobs+"/"+status.ID, "", nil, http.StatusOK)
+		if err != nil {
+			return "", err
+		}
+		if status, err = decodeJobStatus(resp); err != nil {
+			return "", err
+		}
+	}
+}
+
+// cancelJob is best effort, the job is abandoned either way.
+func (s *Session) cancelJob(id string) {
+	resp, err := s.do(context.Background(), "cancel job", http.MethodDelete, protocol.PathJobs+"/"+id, "", nil, http.StatusOK)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// upload streams the body produced by write to the server as it is serialized.
+func (s *Session) upload(ctx context.Context, op, path string, write func(io.Writer) error) error {
+	body, bodyWriter := io.Pipe()
+	go func() {
+		bodyWriter.CloseWithError(write(bodyWriter))
+	}()
+	defer body.Close()
+
+	resp, err := s.do(ctx, op, http.MethodPost, path, protocol.ContentType, body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *Session) do(ctx context.Context, op, method, path, contentType string, body io.Reader, expectedStatus int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("client: %s: %w", op, err)
+	}
+
+	if resp.StatusCode != expectedStatus {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &StatusError{Op: op, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp, nil
+}
+
+func decodeJobStatus(resp *http.Response) (protocol.JobStatus, error) {
+	defer resp.Body.Close()
+
+	var status protocol.JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("client: decode job status: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,271 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nulltea/lumenos/client"
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/server"
+	"github.com/nulltea/lumenos/vdec"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+const (
+	rows    = 16
+	cols    = 8
+	logN    = 12
+	modulus = server.Modulus
+	rhoInv  = 2
+)
+
+// vdecParams leave room for the decryption noise in the pure-Go decryption proof, unlike the server's plaintext
+// modulus, and a spare level for batching to rescale.
+var vdecParams = bgv.ParametersLiteral{
+	LogN:             logN,
+	LogQ:             []int{60, 55, 55, 55, 55, 55},
+	LogP:             []int{55, 55},
+	PlaintextModulus: 0x3ee0001,
+}
+
+// newTestServer serves the protocol endpoints of a prover for a rows x cols matrix.
+func newTestServer(t *testing.T) *httptest.Server {
+	return serve(t, server.Config{Rows: rows, Cols: cols, LogN: logN})
+}
+
+func serve(t *testing.T, cfg server.Config) *httptest.Server {
+	srv, err := server.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func connect(t *testing.T, serverURL string) *client.Session {
+	session, err := client.Connect(context.Background(), serverURL, client.Config{PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestSessionE2E(t *testing.T) {
+	ts := newTestServer(t)
+	session := connect(t, ts.URL)
+	ctx := context.Background()
+
+	matrix, _, err := core.RandomMatrixRowMajor(rows, cols, modulus, func(u []uint64) *struct{} { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := session.UploadKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.UploadWitness(ctx, matrix); err != nil {
+		t.Fatal(err)
+	}
+
+	const point = 3
+	proof, err := session.RequestProof(ctx, point)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := core.NewDensePolyFromMatrix(matrix).Evaluate(session.Client().Field(), core.NewElement(point)).Uint64()
+	if proof.Value == nil || *proof.Value != expected {
+		t.Fatalf("claimed value = %v, expected %d", proof.Value, expected)
+	}
+
+	decrypted, err := session.DecryptAndProve(ctx, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Verify(proof, decrypted); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong claimed value must be rejected.
+	wrong := expected + 1
+	proof.Value = &wrong
+	if err := session.Verify(proof, decrypted); err == nil {
+		t.Fatal("proof verified for a wrong value")
+	}
+}
+
+func TestSessionCommitOpen(t *testing.T) {
+	ts := newTestServer(t)
+	session := connect(t, ts.URL)
+	ctx := context.Background()
+
+	matrix, _, err := core.RandomMatrixRowMajor(rows, cols, modulus, func(u []uint64) *struct{} { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := session.UploadKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.UploadWitness(ctx, matrix); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Open(ctx, 1); !errors.Is(err, client.ErrNotCommitted) {
+		t.Fatalf("got %v, expected %v", err, client.ErrNotCommitted)
+	}
+
+	root, err := session.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points := []uint64{3, 5}
+	proofs, err := session.Open(ctx, points...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proofs) != len(points) {
+		t.Fatalf("got %d proofs, expected %d", len(proofs), len(points))
+	}
+	for i, proof := range proofs {
+		expected := core.NewDensePolyFromMatrix(matrix).Evaluate(session.Client().Field(), core.NewElement(points[i])).Uint64()
+		if proof.Point != points[i] || proof.Value == nil || *proof.Value != expected {
+			t.Fatalf("proof %d at point %d claims %v, expected %d at %d", i, proof.Point, proof.Value, expected, points[i])
+		}
+		if string(proof.Encrypted.Root) != string(root) {
+			t.Fatalf("proof %d opens a different root", i)
+		}
+
+		decrypted, err := session.DecryptAndProve(ctx, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := session.Verify(proof, decrypted); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new witness must be committed before it is opened
+	if err := session.UploadWitness(ctx, matrix); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Open(ctx, 1); !errors.Is(err, client.ErrNotCommitted) {
+		t.Fatalf("got %v, expected %v", err, client.ErrNotCommitted)
+	}
+}
+
+// TestSessionRingSwitch checks that ring switched proofs pass the evaluation checks and their decryption proofs.
+func TestSessionRingSwitch(t *testing.T) {
+	ts := serve(t, server.Config{Rows: rows, Cols: cols, Params: &vdecParams})
+	ctx := context.Background()
+	session, err := client.Connect(ctx, ts.URL, client.Config{PollInterval: time.Millisecond, Vdec: true, RingSwitchLogN: logN - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matrix, _, err := core.RandomMatrixRowMajor(rows, cols, vdecParams.PlaintextModulus, func(u []uint64) *struct{} { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.UploadKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.UploadWitness(ctx, matrix); err != nil {
+		t.Fatal(err)
+	}
+	proof, err := session.RequestProof(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := session.DecryptAndProve(ctx, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Verify(proof, decrypted); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong inner product must fail verification.
+	decrypted.MatR[0] = session.Client().Field().Add(decrypted.MatR[0], core.One())
+	if err := session.Verify(proof, decrypted); err == nil {
+		t.Fatal("verified a wrong inner product")
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	ts := newTestServer(t)
+	session := connect(t, ts.URL)
+	ctx := context.Background()
+
+	if _, err := session.RequestProof(ctx, 1); !errors.Is(err, client.ErrKeysNotUploaded) {
+		t.Fatalf("got %v, expected %v", err, client.ErrKeysNotUploaded)
+	}
+
+	if err := session.UploadWitness(ctx, make([][]*core.Element, rows-1)); !errors.Is(err, client.ErrWitnessShape) {
+		t.Fatalf("got %v, expected %v", err, client.ErrWitnessShape)
+	}
+
+	if err := session.UploadKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a witness, the server proves a random matrix and claims its value.
+	proof, err := session.RequestProof(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Value == nil {
+		t.Fatal("server did not claim the value of its random matrix")
+	}
+
+	var statusErr *client.StatusError
+	if _, err := client.Connect(ctx, ts.URL+"/missing", client.Config{}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("got %v, expected a not found status", err)
+	}
+}
+
+func TestConnectParamsMismatch(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+
+	session, err := client.Connect(ctx, ts.URL, client.Config{Rows: rows, Cols: cols, LogN: logN, Modulus: modulus, RhoInv: rhoInv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := session.Config(); cfg.Rows != rows || cfg.Cols != cols || cfg.LogN != logN {
+		t.Fatalf("unexpected session config %+v", cfg)
+	}
+
+	for _, cfg := range []client.Config{
+		{Rows: rows * 2},
+		{Cols: cols * 2},
+		{LogN: logN + 1},
+		{Modulus: 65537},
+		{RhoInv: rhoInv * 2},
+	} {
+		if _, err := client.Connect(ctx, ts.URL, cfg); !errors.Is(err, client.ErrParamsMismatch) {
+			t.Errorf("Connect(%+v) returned %v, expected %v", cfg, err, client.ErrParamsMismatch)
+		}
+	}
+}
+
+// TestConnectVdecNoiseBudget checks that the server's plaintext modulus, which leaves no noise budget for the
+// test-only pure-Go decryption proof, is rejected before anything is encrypted.
+func TestConnectVdecNoiseBudget(t *testing.T) {
+	ts := newTestServer(t)
+
+	if _, err := client.Connect(context.Background(), ts.URL, client.Config{Vdec: true}); !errors.Is(err, vdec.ErrTestBackend) {
+		t.Fatalf("got %v, expected %v", err, vdec.ErrTestBackend)
+	}
+}
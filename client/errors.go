@@ -0,0 +1,51 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrParamsMismatch is returned by Connect when the server's parameters differ from the expected ones.
+	ErrParamsMismatch = errors.New("client: parameters mismatch")
+
+	// ErrKeysNotUploaded is returned when a proof is requested before UploadKeys.
+	ErrKeysNotUploaded = errors.New("client: keys have not been uploaded")
+
+	// ErrWitnessShape is returned when the witness does not match the session's matrix dimensions.
+	ErrWitnessShape = errors.New("client: witness shape does not match session")
+
+	// ErrNoValue is returned when a proof cannot be verified because its claimed value is unknown.
+	ErrNoValue = errors.New("client: claimed value is unknown")
+
+	// ErrNotCommitted is returned when openings are requested before Commit.
+	ErrNotCommitted = errors.New("client: witness has not been committed")
+
+	// ErrRootMismatch is returned when an opened proof is not for the committed Merkle root.
+	ErrRootMismatch = errors.New("client: proof does not open the committed root")
+)
+
+// StatusError is returned when the server responds with an unexpected HTTP status.
+type StatusError struct {
+	Op         string
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("client: %s: server returned status %d", e.Op, e.StatusCode)
+	}
+	return fmt.Sprintf("client: %s: server returned status %d: %s", e.Op, e.StatusCode, e.Message)
+}
+
+// JobError is returned when a proving job fails or is cancelled on the server.
+type JobError struct {
+	ID      string
+	State   string
+	Message string
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("client: job %s %s: %s", e.ID, e.State, e.Message)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/server"
+)
+
+// dryRun prints the predicted cost of proving a rows x cols matrix, and the shape of the same size
+// that minimizes objective, without starting the server.
+func dryRun(rows, cols, logN, packing int, objective fhe.ShapeObjective) error {
+	cfg := fhe.PlanConfig{
+		Rows:             rows,
+		Cols:             cols,
+		RhoInv:           server.RhoInv,
+		SecurityBits:     server.SecurityBits,
+		LogN:             logN,
+		PlaintextModulus: server.Modulus,
+		Packing:          packing,
+	}
+	plan, err := fhe.PlanLigero(cfg)
+	if err != nil {
+		return err
+	}
+	printPlan(plan)
+
+	best, err := fhe.RecommendShape(rows*cols, cfg, objective)
+	if err != nil {
+		return err
+	}
+	if best.Rows != rows {
+		fmt.Printf("\nRecommended shape for %s %dx%d (proof %s)\n", objective, best.Rows, best.Cols, humanize.Bytes(uint64(best.ProofBytes)))
+	}
+	return nil
+}
+
+func printPlan(p *fhe.LigeroPlan) {
+	size := func(n int) string { return humanize.Bytes(uint64(n)) }
+
+	fmt.Printf("Matrix %dx%d, rate 1/%d, %d queries\n", p.Rows, p.Cols, p.RhoInv, p.Queries)
+	fmt.Printf("LogN %d, %d moduli, %d slots, %d segments per column, %d columns per ciphertext\n", p.LogN, p.Levels, p.Slots, p.Segments, p.ColumnsPerCiphertext())
+	fmt.Printf("Ciphertexts: %d matrix + %d encoded, %s each\n", p.MatrixCiphertexts, p.EncodedCiphertexts, size(p.CiphertextBytes))
+	fmt.Printf("Keys: %s (public %s, relinearization %s, Galois %s)\n",
+		size(p.KeysBytes), size(p.PublicKeyBytes), size(p.RelinearizationKeyBytes), size(p.GaloisKeysBytes))
+	fmt.Printf("Proof: %s (MatR %s, MatZ %s, QueriedCols %s, MerklePaths %s)\n",
+		size(p.ProofBytes), size(p.MatRBytes), size(p.MatZBytes), size(p.QueriedColsBytes), size(p.MerklePathsBytes))
+	fmt.Printf("Server memory: at least %s\n", size(p.ServerMemoryBytes))
+	fmt.Printf("Commit operations: %+v\n", p.CommitOps)
+	fmt.Printf("Prove operations: %+v\n", p.ProveOps)
+	fmt.Printf("Client decryptions: %d\n", p.ClientDecryptions)
+}
+
+// shapeObjectives maps the values of the -optimize flag to shape objectives.
+var shapeObjectives = map[string]fhe.ShapeObjective{
+	"proof":  fhe.MinimizeProofSize,
+	"server": fhe.MinimizeServerTime,
+	"client": fhe.MinimizeClientTime,
+}
+
+// shapeForDegree picks the matrix shape for polynomials of the given degree.
+func shapeForDegree(degree, logN int, objective fhe.ShapeObjective) (rows, cols int, err error) {
+	ligero, err := fhe.NewLigeroCommitterForDegree(degree, objective, fhe.PlanConfig{
+		RhoInv:           server.RhoInv,
+		SecurityBits:     server.SecurityBits,
+		LogN:             logN,
+		PlaintextModulus: server.Modulus,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return ligero.Rows, ligero.Cols, nil
+}
@@ -1,8 +1,10 @@
 package core
 
-func Encode(row []*Element, rhoInv int, field *PrimeField) []*Element {
+import "fmt"
+
+func Encode(row []*Element, rhoInv int, field *PrimeField) ([]*Element, error) {
 	if len(row) == 0 {
-		panic("row is empty")
+		return nil, fmt.Errorf("%w: row is empty", ErrInvalidSize)
 	}
 
 	cols := len(row)
@@ -0,0 +1,12 @@
+package core
+
+import "errors"
+
+var (
+	// ErrDimensionMismatch is returned when vectors or matrices have incompatible lengths.
+	ErrDimensionMismatch = errors.New("dimension mismatch")
+	// ErrInvalidSize is returned for empty inputs and NTT sizes that are not a power of 2.
+	ErrInvalidSize = errors.New("invalid size")
+	// ErrMerklePathInvalid is returned when a Merkle path does not authenticate a leaf against the root.
+	ErrMerklePathInvalid = errors.New("merkle path is invalid")
+)
@@ -46,6 +46,27 @@ func (f *PrimeField) RootForwardUint64(i int) uint64 {
 	return f.r.RootsForward[i]
 }
 
+// Root returns ω^k for the primitive n-th root of unity ω = ψ^(2N/n), where ψ is the primitive 2N-th root the
+// roots table is generated from. n must divide 2N.
+func (f *PrimeField) Root(n, k int) *Element {
+	return NewElement(f.RootUint64(n, k))
+}
+
+// RootUint64 returns Root(n, k) as a uint64.
+func (f *PrimeField) RootUint64(n, k int) uint64 {
+	// ψ^e for e < N is stored in Montgomery form at the bit-reversed index of e, and ψ^N = -1
+	e := (k % n) * (int(f.r.NthRoot) / n)
+	negate := e >= f.r.N
+	if negate {
+		e -= f.r.N
+	}
+	root := ring.IMForm(f.r.RootsForward[utils.BitReverse64(e, bits.Len(uint(f.r.N))-1)], f.r.Modulus, f.r.MRedConstant)
+	if negate {
+		root = f.r.Modulus - root
+	}
+	return root
+}
+
 // Mul z = x * y (mod q)
 func (f *PrimeField) Mul(x, y *Element) *Element {
 	z := Zero()
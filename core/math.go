@@ -5,9 +5,9 @@ import (
 	"math/bits"
 )
 
-func InnerProduct(v []*Element, r []*Element, field *PrimeField) *Element {
+func InnerProduct(v []*Element, r []*Element, field *PrimeField) (*Element, error) {
 	if len(v) != len(r) {
-		panic("vector lengths do not match")
+		return nil, fmt.Errorf("%w: inner product of vectors of length %d and %d", ErrDimensionMismatch, len(v), len(r))
 	}
 
 	sum := Zero()
@@ -17,27 +17,27 @@ func InnerProduct(v []*Element, r []*Element, field *PrimeField) *Element {
 		sum = field.Add(sum, product)
 	}
 
-	return sum
+	return sum, nil
 }
 
 // SqrtFactor finds the integer square root if n is a power of 2.
-// Returns sqrt(n) and panics if n is a power of 2, otherwise 0 and error.
-func SqrtFactor(n int) int {
+// Returns sqrt(n) if n is a power of 2, otherwise 0 and ErrInvalidSize.
+func SqrtFactor(n int) (int, error) {
 	if n <= 0 || (n&(n-1) != 0) {
-		panic(fmt.Sprintf("unsupported NTT size for generic case: input %d is not a positive power of 2", n))
+		return 0, fmt.Errorf("%w: NTT size %d is not a positive power of 2", ErrInvalidSize, n)
 	}
 	log2n := bits.Len(uint(n)) - 1
 	if log2n%2 != 0 {
-		return 1 << uint((log2n-1)/2)
+		return 1 << uint((log2n-1)/2), nil
 	}
 	// log2n is even, return exact sqrt
-	return 1 << uint(log2n/2)
+	return 1 << uint(log2n/2), nil
 }
 
 // transpose transposes a slice representing a matrix in row-major order.
-func Transpose[T any](matrix []T, rows, cols int) {
+func Transpose[T any](matrix []T, rows, cols int) error {
 	if len(matrix) != rows*cols {
-		panic("matrix size does not match rows*cols")
+		return fmt.Errorf("%w: matrix of size %d is not %dx%d", ErrDimensionMismatch, len(matrix), rows, cols)
 	}
 	if rows == cols {
 		// In-place transpose for square matrices
@@ -57,4 +57,5 @@ func Transpose[T any](matrix []T, rows, cols int) {
 			}
 		}
 	}
+	return nil
 }
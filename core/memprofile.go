@@ -0,0 +1,143 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// MemoryProfile is the memory usage of the process over the lifetime of a span.
+// Heap sizes are bytes of in-use heap spans; the peak is sampled, so short spikes between samples may be missed.
+type MemoryProfile struct {
+	HeapStart  uint64
+	HeapEnd    uint64
+	HeapPeak   uint64
+	AllocBytes uint64 // bytes allocated during the span, including freed ones
+	Mallocs    uint64 // heap objects allocated during the span
+	GCCycles   uint32
+}
+
+// memSnapshot is the running state of a profiled span.
+type memSnapshot struct {
+	totalAlloc uint64
+	mallocs    uint64
+	numGC      uint32
+	heapStart  uint64
+
+	mu       sync.Mutex
+	heapPeak uint64
+}
+
+func (m *memSnapshot) observe(heap uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.heapPeak = max(m.heapPeak, heap)
+}
+
+var memProfiler struct {
+	sync.Mutex
+	enabled bool
+	stop    chan struct{}
+	active  map[*memSnapshot]struct{}
+}
+
+// SetMemoryProfiling enables capturing a MemoryProfile for every span started afterwards, sampling the in-use heap
+// every interval to find the peak of each running span. A non-positive interval disables it, which is the default.
+// Profiled spans record the profile as attributes (mem.heap_peak, mem.alloc_bytes, ...) and print it on stdout.
+// Reading the memory statistics briefly stops the world, so the interval should stay in the tens of milliseconds.
+func SetMemoryProfiling(interval time.Duration) {
+	memProfiler.Lock()
+	defer memProfiler.Unlock()
+	if memProfiler.stop != nil {
+		close(memProfiler.stop)
+		memProfiler.stop = nil
+	}
+	memProfiler.enabled = interval > 0
+	if !memProfiler.enabled {
+		return
+	}
+	if memProfiler.active == nil {
+		memProfiler.active = make(map[*memSnapshot]struct{})
+	}
+	stop := make(chan struct{})
+	memProfiler.stop = stop
+	go sampleHeap(interval, stop)
+}
+
+func sampleHeap(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var stats runtime.MemStats
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		runtime.ReadMemStats(&stats)
+		memProfiler.Lock()
+		for snapshot := range memProfiler.active {
+			snapshot.observe(stats.HeapInuse)
+		}
+		memProfiler.Unlock()
+	}
+}
+
+// startMemoryProfile returns the snapshot of a span starting now, or nil if profiling is disabled.
+func startMemoryProfile() *memSnapshot {
+	memProfiler.Lock()
+	enabled := memProfiler.enabled
+	memProfiler.Unlock()
+	if !enabled {
+		return nil
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	snapshot := &memSnapshot{
+		totalAlloc: stats.TotalAlloc,
+		mallocs:    stats.Mallocs,
+		numGC:      stats.NumGC,
+		heapStart:  stats.HeapInuse,
+		heapPeak:   stats.HeapInuse,
+	}
+
+	memProfiler.Lock()
+	memProfiler.active[snapshot] = struct{}{}
+	memProfiler.Unlock()
+	return snapshot
+}
+
+// end stops sampling the snapshot and returns the profile of the span.
+func (m *memSnapshot) end() *MemoryProfile {
+	memProfiler.Lock()
+	delete(memProfiler.active, m)
+	memProfiler.Unlock()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	m.observe(stats.HeapInuse)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &MemoryProfile{
+		HeapStart:  m.heapStart,
+		HeapEnd:    stats.HeapInuse,
+		HeapPeak:   m.heapPeak,
+		AllocBytes: stats.TotalAlloc - m.totalAlloc,
+		Mallocs:    stats.Mallocs - m.mallocs,
+		GCCycles:   stats.NumGC - m.numGC,
+	}
+}
+
+// attributes returns the profile as span attributes.
+func (p *MemoryProfile) attributes() map[string]any {
+	return map[string]any{
+		"mem.heap_start":  p.HeapStart,
+		"mem.heap_end":    p.HeapEnd,
+		"mem.heap_peak":   p.HeapPeak,
+		"mem.alloc_bytes": p.AllocBytes,
+		"mem.mallocs":     p.Mallocs,
+		"mem.gc_cycles":   p.GCCycles,
+	}
+}
@@ -1,15 +1,19 @@
 package core
 
-func NTT(values []*Element, size int, field *PrimeField) []*Element {
-	nttInner(values, size, field)
-	return values
+// NTT evaluates the discrete Fourier transform of each chunk of size values in place: value k of a chunk becomes
+// the sum of v[j]·ω^(jk) over the chunk, for the primitive size-th root of unity ω = field.Root(size, 1).
+func NTT(values []*Element, size int, field *PrimeField) ([]*Element, error) {
+	if err := nttInner(values, size, field); err != nil {
+		return nil, err
+	}
+	return values, nil
 }
 
 // nttInner performs NTT on plain uint64 values (non-FHE version for testing)
-func nttInner(v []*Element, size int, field *PrimeField) {
+func nttInner(v []*Element, size int, field *PrimeField) error {
 	switch size {
 	case 0, 1:
-		return
+		return nil
 	case 2:
 		for i := 0; i < len(v); i += 2 {
 			v[i], v[i+1] = field.Add(v[i], v[i+1]), field.Sub(v[i], v[i+1])
@@ -22,7 +26,7 @@ func nttInner(v []*Element, size int, field *PrimeField) {
 			// (v[1], v[3]) = (v[1] + v[3], v[1] - v[3])
 			v[i+1], v[i+3] = field.Add(v[i+1], v[i+3]), field.Sub(v[i+1], v[i+3])
 
-			v[i+3] = field.Mul(v[i+3], field.RootForward(4))
+			v[i+3] = field.Mul(v[i+3], field.Root(4, 1))
 
 			// (v[0], v[1]) = (v[0] + v[1], v[0] - v[1])
 			v[i], v[i+1] = field.Add(v[i], v[i+1]), field.Sub(v[i], v[i+1])
@@ -42,22 +46,21 @@ func nttInner(v []*Element, size int, field *PrimeField) {
 			v[i+3], v[i+7] = field.Add(v[i+3], v[i+7]), field.Sub(v[i+3], v[i+7])
 
 			// Multiply by roots
-			v[i+5] = field.Mul(v[i+5], field.RootForward(8))
-			v[i+6] = field.Mul(v[i+6], field.RootForward(4))
-			omega8_3 := field.Pow(3, field.RootForward(8))
-			v[i+7] = field.Mul(v[i+7], omega8_3)
+			v[i+5] = field.Mul(v[i+5], field.Root(8, 1))
+			v[i+6] = field.Mul(v[i+6], field.Root(8, 2))
+			v[i+7] = field.Mul(v[i+7], field.Root(8, 3))
 
 			// Second level butterflies
 			v[i], v[i+2] = field.Add(v[i], v[i+2]), field.Sub(v[i], v[i+2])
 			v[i+1], v[i+3] = field.Add(v[i+1], v[i+3]), field.Sub(v[i+1], v[i+3])
-			v[i+3] = field.Mul(v[i+3], field.RootForward(4))
+			v[i+3] = field.Mul(v[i+3], field.Root(4, 1))
 
 			// Third level butterflies
 			v[i], v[i+1] = field.Add(v[i], v[i+1]), field.Sub(v[i], v[i+1])
 			v[i+2], v[i+3] = field.Add(v[i+2], v[i+3]), field.Sub(v[i+2], v[i+3])
 			v[i+4], v[i+6] = field.Add(v[i+4], v[i+6]), field.Sub(v[i+4], v[i+6])
 			v[i+5], v[i+7] = field.Add(v[i+5], v[i+7]), field.Sub(v[i+5], v[i+7])
-			v[i+7] = field.Mul(v[i+7], field.RootForward(4))
+			v[i+7] = field.Mul(v[i+7], field.Root(4, 1))
 
 			// Fourth level butterflies
 			v[i+4], v[i+5] = field.Add(v[i+4], v[i+5]), field.Sub(v[i+4], v[i+5])
@@ -68,31 +71,40 @@ func nttInner(v []*Element, size int, field *PrimeField) {
 			v[i+3], v[i+6] = v[i+6], v[i+3]
 		}
 	default:
-		n1 := SqrtFactor(size)
+		n1, err := SqrtFactor(size)
+		if err != nil {
+			return err
+		}
 		n2 := size / n1
-		step := field.N() / size
 
 		// Process the input slice v in chunks of 'size'
 		for chunkStart := 0; chunkStart < len(v); chunkStart += size {
 			chunk := v[chunkStart : chunkStart+size]
 
-			Transpose(chunk, n1, n2)
-			nttInner(chunk, n1, field)
-			Transpose(chunk, n2, n1)
+			if err := Transpose(chunk, n1, n2); err != nil {
+				return err
+			}
+			if err := nttInner(chunk, n1, field); err != nil {
+				return err
+			}
+			if err := Transpose(chunk, n2, n1); err != nil {
+				return err
+			}
 
 			for i := 1; i < n1; i++ {
-				step = (i * step) % field.N()
-				idx := step
 				for j := 1; j < n2; j++ {
-					idx %= field.N()
-					twiddle := field.RootForward(idx)
+					twiddle := field.Root(size, i*j)
 					chunk[i*n2+j] = field.Mul(chunk[i*n2+j], twiddle)
-					idx += step
 				}
 			}
 
-			nttInner(chunk, n2, field)
-			Transpose(chunk, n1, n2)
+			if err := nttInner(chunk, n2, field); err != nil {
+				return err
+			}
+			if err := Transpose(chunk, n1, n2); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,50 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/nulltea/lumenos/core"
+)
+
+// dft evaluates the discrete Fourier transform of v by its definition.
+func dft(v []*core.Element, field *core.PrimeField) []*core.Element {
+	out := make([]*core.Element, len(v))
+	for k := range out {
+		out[k] = core.Zero()
+		for j, x := range v {
+			out[k] = field.Add(out[k], field.Mul(x, field.Root(len(v), j*k)))
+		}
+	}
+	return out
+}
+
+func TestNTT(t *testing.T) {
+	const modulus = 144115188075593729
+	for _, size := range []int{2, 4, 8, 16, 32, 64, 128} {
+		field, err := core.NewPrimeField(modulus, max(size, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root := field.Root(size, 1); field.Pow(uint64(size/2), root).Equal(core.One()) || !field.Pow(uint64(size), root).Equal(core.One()) {
+			t.Fatalf("root of size %d is not primitive", size)
+		}
+
+		// Two chunks are transformed separately
+		values, _, err := core.RandomMatrixRowMajor(2, size, modulus, func([]uint64) *struct{} { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := append(append([]*core.Element{}, values[0]...), values[1]...)
+		got, err := core.NTT(v, size, &field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for c, chunk := range values {
+			for k, expected := range dft(chunk, &field) {
+				if !got[c*size+k].Equal(expected) {
+					t.Fatalf("NTT of size %d differs from the DFT at %d of chunk %d", size, k, c)
+				}
+			}
+		}
+	}
+}
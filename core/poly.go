@@ -1,5 +1,7 @@
 package core
 
+import "fmt"
+
 type DensePoly struct {
 	Coefficients []*Element
 }
@@ -17,6 +19,26 @@ func NewDensePolyFromMatrix(matrix [][]*Element) *DensePoly {
 	}
 }
 
+// Matrix lays out the coefficients in a rows x cols row-major matrix, the inverse of NewDensePolyFromMatrix.
+// Coefficients past the polynomial's degree are zero, so that any degree below rows*cols can be committed to.
+func (p *DensePoly) Matrix(rows, cols int) ([][]*Element, error) {
+	if rows <= 0 || cols <= 0 || len(p.Coefficients) > rows*cols {
+		return nil, fmt.Errorf("%w: %d coefficients do not fit in a %dx%d matrix", ErrInvalidSize, len(p.Coefficients), rows, cols)
+	}
+	matrix := make([][]*Element, rows)
+	for i := range matrix {
+		matrix[i] = make([]*Element, cols)
+		for j := range matrix[i] {
+			if k := i*cols + j; k < len(p.Coefficients) {
+				matrix[i][j] = p.Coefficients[k]
+			} else {
+				matrix[i][j] = Zero()
+			}
+		}
+	}
+	return matrix, nil
+}
+
 // Evaluate computes the value of the polynomial at the given point using Horner's method
 func (p *DensePoly) Evaluate(field *PrimeField, point *Element) *Element {
 	result := Zero()
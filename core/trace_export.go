@@ -0,0 +1,342 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SpanRecord is a snapshot of an ended span, as collected and exported by the sinks of this file.
+type SpanRecord struct {
+	TraceID    TraceID        `json:"traceId"`
+	SpanID     SpanID         `json:"spanId"`
+	ParentID   SpanID         `json:"parentSpanId"`
+	Name       string         `json:"name"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Duration   time.Duration  `json:"durationNs"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// MemoryCollector keeps the records of ended spans in memory, in the order they ended. It is meant for tests.
+type MemoryCollector struct {
+	mu    sync.Mutex
+	spans []SpanRecord
+}
+
+func NewMemoryCollector() *MemoryCollector {
+	return &MemoryCollector{}
+}
+
+func (c *MemoryCollector) SpanStarted(*Span) {}
+
+func (c *MemoryCollector) SpanEnded(span *Span, _ time.Duration) {
+	record := span.Record()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = append(c.spans, record)
+}
+
+// Spans returns the records collected so far.
+func (c *MemoryCollector) Spans() []SpanRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SpanRecord{}, c.spans...)
+}
+
+// Find returns the collected records with the given name.
+func (c *MemoryCollector) Find(name string) []SpanRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var found []SpanRecord
+	for _, record := range c.spans {
+		if record.Name == name {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// Reset discards the collected records.
+func (c *MemoryCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = nil
+}
+
+// JSONLinesExporter writes every ended span as a JSON-encoded SpanRecord on its own line.
+type JSONLinesExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	err    error
+}
+
+func NewJSONLinesExporter(w io.Writer) *JSONLinesExporter {
+	return &JSONLinesExporter{w: w}
+}
+
+// CreateJSONLinesFile creates (or truncates) the file at path and returns an exporter writing to it.
+func CreateJSONLinesFile(path string) (*JSONLinesExporter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesExporter{w: f, closer: f}, nil
+}
+
+func (e *JSONLinesExporter) SpanStarted(*Span) {}
+
+func (e *JSONLinesExporter) SpanEnded(span *Span, _ time.Duration) {
+	line, err := json.Marshal(span.Record())
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return
+	}
+	if err != nil {
+		e.err = err
+		return
+	}
+	_, e.err = e.w.Write(append(line, '\n'))
+}
+
+// Err returns the first error encountered while writing, after which the exporter stops writing.
+func (e *JSONLinesExporter) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Close closes the underlying file if the exporter created it, and returns the first write error if any.
+func (e *JSONLinesExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closer != nil {
+		if err := e.closer.Close(); err != nil && e.err == nil {
+			e.err = err
+		}
+		e.closer = nil
+	}
+	return e.err
+}
+
+// DefaultOTLPEndpoint is the traces endpoint of an OpenTelemetry collector listening for OTLP/HTTP on localhost.
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// OTLPExporter sends spans to an OpenTelemetry collector over OTLP/HTTP with the JSON encoding.
+// Ended spans are buffered and sent in one request once the root span of their trace ends, or on Flush.
+// Export failures do not affect the traced code; they are logged, or passed to OnError when set.
+type OTLPExporter struct {
+	Endpoint    string
+	ServiceName string
+	Client      *http.Client
+	OnError     func(error)
+
+	mu      sync.Mutex
+	pending []SpanRecord
+}
+
+// NewOTLPExporter returns an exporter posting to endpoint (DefaultOTLPEndpoint when empty) under serviceName.
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+	return &OTLPExporter{
+		Endpoint:    endpoint,
+		ServiceName: serviceName,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OTLPExporter) SpanStarted(*Span) {}
+
+func (e *OTLPExporter) SpanEnded(span *Span, _ time.Duration) {
+	e.mu.Lock()
+	e.pending = append(e.pending, span.Record())
+	e.mu.Unlock()
+
+	if span.Parent() != nil {
+		return
+	}
+	if err := e.Flush(context.Background()); err != nil {
+		if e.OnError != nil {
+			e.OnError(err)
+		} else {
+			log.Printf("otlp export: %v", err)
+		}
+	}
+}
+
+// Flush sends the buffered spans. They are dropped even if the request fails.
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	records := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(otlpRequest(e.ServiceName, records))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// The types below mirror the OTLP/JSON encoding of ExportTraceServiceRequest.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           TraceID        `json:"traceId"`
+	SpanID            SpanID         `json:"spanId"`
+	ParentSpanID      SpanID         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpSpanKindInternal is SPAN_KIND_INTERNAL.
+const otlpSpanKindInternal = 1
+
+func otlpRequest(serviceName string, records []SpanRecord) otlpTraces {
+	spans := make([]otlpSpan, len(records))
+	for i, record := range records {
+		spans[i] = otlpSpan{
+			TraceID:           record.TraceID,
+			SpanID:            record.SpanID,
+			ParentSpanID:      record.ParentID,
+			Name:              record.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(record.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(record.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(record.Attributes),
+		}
+	}
+
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": serviceName})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/nulltea/lumenos/core"}, Spans: spans}},
+	}}}
+}
+
+// otlpAttributes converts attributes to OTLP key-values sorted by key. Integers are encoded as decimal strings.
+func otlpAttributes(attributes map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, len(keys))
+	for i, key := range keys {
+		var value otlpAnyValue
+		switch v := attributes[key].(type) {
+		case bool:
+			value.BoolValue = &v
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			s := fmt.Sprint(v)
+			value.IntValue = &s
+		case float32:
+			f := float64(v)
+			value.DoubleValue = &f
+		case float64:
+			value.DoubleValue = &v
+		case string:
+			value.StringValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		kvs[i] = otlpKeyValue{Key: key, Value: value}
+	}
+	return kvs
+}
+
+// AddExporters registers a JSON-lines exporter writing to jsonPath and an OTLP exporter posting to otlpEndpoint
+// alongside the current sinks, skipping those left empty. The returned function flushes and closes them.
+func AddExporters(jsonPath, otlpEndpoint, serviceName string) (func() error, error) {
+	var closers []func() error
+	if jsonPath != "" {
+		exporter, err := CreateJSONLinesFile(jsonPath)
+		if err != nil {
+			return nil, err
+		}
+		AddSink(exporter)
+		closers = append(closers, exporter.Close)
+	}
+	if otlpEndpoint != "" {
+		exporter := NewOTLPExporter(otlpEndpoint, serviceName)
+		AddSink(exporter)
+		closers = append(closers, func() error { return exporter.Flush(context.Background()) })
+	}
+
+	return func() error {
+		var errs []error
+		for _, close := range closers {
+			errs = append(errs, close())
+		}
+		return errors.Join(errs...)
+	}, nil
+}
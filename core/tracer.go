@@ -1,49 +1,138 @@
 package core
 
 import (
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"maps"
+	"math/rand/v2"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/dustin/go-humanize"
 )
 
+// TraceID identifies the span tree rooted at a span started without a parent.
+type TraceID [16]byte
+
+// SpanID identifies a span within its trace. The zero SpanID is the parent ID of root spans.
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsZero reports whether id is the zero SpanID.
+func (id SpanID) IsZero() bool { return id == SpanID{} }
+
+// MarshalText encodes the ID as lowercase hex, as in OTLP/JSON.
+func (id TraceID) MarshalText() ([]byte, error) { return []byte(id.String()), nil }
+
+// MarshalText encodes the ID as lowercase hex, as in OTLP/JSON. The zero SpanID is encoded as an empty string.
+func (id SpanID) MarshalText() ([]byte, error) {
+	if id.IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(id.String()), nil
+}
+
 type Span struct {
 	name      string
+	message   string
+	id        SpanID
+	traceID   TraceID
 	startTime time.Time
+	endTime   time.Time
 	parent    *Span
 	depth     int
+	observer  SpanObserver
+	newline   bool
+	mem       *memSnapshot
+	memory    *MemoryProfile
+
+	attrMu     sync.Mutex
+	attributes map[string]any
+}
+
+// SpanObserver is notified when spans start and end. Observers are inherited
+// by child spans, so attaching one to a root span watches its whole tree.
+// Sinks registered with SetSinks or AddSink are observers of every span.
+type SpanObserver interface {
+	SpanStarted(span *Span)
+	SpanEnded(span *Span, duration time.Duration)
 }
 
 var (
-	mu sync.Mutex
+	mu    sync.Mutex
+	sinks = []SpanObserver{StdoutSink{}}
 )
 
-// StartSpan starts a new span with the given name and optional parent span
-func StartSpan(name string, parent *Span, message ...string) *Span {
+// SetSinks replaces the sinks notified of every span. Printing to stdout is the default sink;
+// calling SetSinks without arguments silences tracing.
+func SetSinks(s ...SpanObserver) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = append([]SpanObserver{}, s...)
+}
+
+// AddSink registers an additional sink notified of every span.
+func AddSink(sink SpanObserver) {
 	mu.Lock()
 	defer mu.Unlock()
+	sinks = append(append([]SpanObserver{}, sinks...), sink)
+}
 
+// StartSpan starts a new span with the given name and optional parent span
+func StartSpan(name string, parent *Span, message ...string) *Span {
+	mu.Lock()
 	depth := 0
+	var observer SpanObserver
+	var traceID TraceID
 	if parent != nil {
 		depth = parent.depth + 1
+		observer = parent.observer
+		traceID = parent.traceID
+	} else {
+		binary.BigEndian.PutUint64(traceID[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(traceID[8:], rand.Uint64())
 	}
 
 	span := &Span{
 		name:      name,
+		message:   strings.Join(message, " "),
+		traceID:   traceID,
 		startTime: time.Now(),
 		parent:    parent,
 		depth:     depth,
+		observer:  observer,
 	}
+	binary.BigEndian.PutUint64(span.id[:], rand.Uint64())
+	current := sinks
+	mu.Unlock()
 
-	// Print start message for root spans
-	if len(message) > 0 {
-		indent := strings.Repeat("  ", depth)
-		fmt.Printf("%s%s\n", indent, strings.Join(message, " "))
+	span.mem = startMemoryProfile()
+
+	for _, sink := range current {
+		sink.SpanStarted(span)
+	}
+	if observer != nil {
+		observer.SpanStarted(span)
 	}
 
 	return span
 }
 
+// StartObservedSpan starts a new root span whose tree reports to observer.
+func StartObservedSpan(name string, observer SpanObserver, message ...string) *Span {
+	span := StartSpan(name, nil, message...)
+	span.observer = observer
+	if observer != nil {
+		observer.SpanStarted(span)
+	}
+	return span
+}
+
 // WithSpan executes the given function within a span and returns its result
 func WithSpan[T any](name string, parent *Span, fn func(*Span) T) T {
 	span := StartSpan(name, parent)
@@ -51,15 +140,143 @@ func WithSpan[T any](name string, parent *Span, fn func(*Span) T) T {
 	return fn(span)
 }
 
-// End ends the span and prints its duration
+// Name returns the name of the span.
+func (s *Span) Name() string {
+	return s.name
+}
+
+// Message returns the message the span was started with, if any.
+func (s *Span) Message() string {
+	return s.message
+}
+
+// Parent returns the parent span, or nil for root spans.
+func (s *Span) Parent() *Span {
+	return s.parent
+}
+
+// ID returns the identifier of the span.
+func (s *Span) ID() SpanID {
+	return s.id
+}
+
+// ParentID returns the identifier of the parent span, or the zero SpanID for root spans.
+func (s *Span) ParentID() SpanID {
+	if s.parent == nil {
+		return SpanID{}
+	}
+	return s.parent.id
+}
+
+// TraceID returns the identifier shared by all spans of the tree.
+func (s *Span) TraceID() TraceID {
+	return s.traceID
+}
+
+// Depth returns the number of ancestors of the span.
+func (s *Span) Depth() int {
+	return s.depth
+}
+
+// StartTime returns the time the span was started.
+func (s *Span) StartTime() time.Time {
+	return s.startTime
+}
+
+// SetAttribute records a key-value pair on the span, e.g. the matrix dimensions or the size of a marshaled object.
+// Values should be booleans, integers, floats or strings; other types are exported in their fmt representation.
+// It is safe to call from several goroutines, and a no-op on a nil span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attrMu.Lock()
+	defer s.attrMu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]any)
+	}
+	s.attributes[key] = value
+}
+
+// Attributes returns a copy of the attributes recorded on the span.
+func (s *Span) Attributes() map[string]any {
+	s.attrMu.Lock()
+	defer s.attrMu.Unlock()
+	return maps.Clone(s.attributes)
+}
+
+// Memory returns the memory profile of an ended span, or nil if memory profiling was disabled when it started.
+func (s *Span) Memory() *MemoryProfile {
+	return s.memory
+}
+
+// Record returns a snapshot of the span for exporters. The end time is zero until the span ends.
+func (s *Span) Record() SpanRecord {
+	record := SpanRecord{
+		TraceID:    s.traceID,
+		SpanID:     s.id,
+		ParentID:   s.ParentID(),
+		Name:       s.name,
+		Start:      s.startTime,
+		End:        s.endTime,
+		Attributes: s.Attributes(),
+	}
+	if !s.endTime.IsZero() {
+		record.Duration = s.endTime.Sub(s.startTime)
+	}
+	return record
+}
+
+// End ends the span and reports its duration to the sinks
 func (s *Span) End() {
-	duration := time.Since(s.startTime)
-	indent := strings.Repeat("  ", s.depth)
-	fmt.Printf("%s%s (%v)\n", indent, s.name, duration)
+	s.endTime = time.Now()
+	duration := s.endTime.Sub(s.startTime)
+	if s.mem != nil {
+		s.memory = s.mem.end()
+		for key, value := range s.memory.attributes() {
+			s.SetAttribute(key, value)
+		}
+	}
+
+	mu.Lock()
+	current := sinks
+	mu.Unlock()
+
+	for _, sink := range current {
+		sink.SpanEnded(s, duration)
+	}
+	if s.observer != nil {
+		s.observer.SpanEnded(s, duration)
+	}
 }
 
-// End ends the span and prints its duration
+// EndWithNewline ends the span like End, followed by a blank line on stdout
 func (s *Span) EndWithNewline() {
+	s.newline = true
 	s.End()
-	fmt.Println()
+}
+
+// StdoutSink prints indented span messages and durations to stdout. It is the default sink.
+type StdoutSink struct{}
+
+// SpanStarted prints the message the span was started with, if any.
+func (StdoutSink) SpanStarted(span *Span) {
+	if span.message != "" {
+		indent := strings.Repeat("  ", span.depth)
+		fmt.Printf("%s%s\n", indent, span.message)
+	}
+}
+
+// SpanEnded prints the span name and its duration, followed by its memory profile if any.
+func (StdoutSink) SpanEnded(span *Span, duration time.Duration) {
+	indent := strings.Repeat("  ", span.depth)
+	if m := span.memory; m != nil {
+		fmt.Printf("%s%s (%v) [heap peak %s, allocated %s, %d GC]\n", indent, span.name, duration,
+			humanize.Bytes(m.HeapPeak), humanize.Bytes(m.AllocBytes), m.GCCycles)
+	} else {
+		fmt.Printf("%s%s (%v)\n", indent, span.name, duration)
+	}
+	if span.newline {
+		fmt.Println()
+	}
 }
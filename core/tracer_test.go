@@ -0,0 +1,218 @@
+package core_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/nulltea/lumenos/core"
+)
+
+// traceTree records a root span with a child and a grandchild.
+func traceTree() {
+	root := core.StartSpan("root", nil)
+	root.SetAttribute("rows", 4)
+	child := core.StartSpan("child", root)
+	child.SetAttribute("logN", 11)
+	grandchild := core.StartSpan("grandchild", child)
+	grandchild.SetAttribute("bytes", uint64(1024))
+	grandchild.End()
+	child.End()
+	root.End()
+}
+
+func TestMemoryCollector(t *testing.T) {
+	collector := core.NewMemoryCollector()
+	core.SetSinks(collector)
+	defer core.SetSinks(core.StdoutSink{})
+
+	traceTree()
+
+	spans := collector.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	grandchild, child, root := spans[0], spans[1], spans[2]
+	if root.Name != "root" || child.Name != "child" || grandchild.Name != "grandchild" {
+		t.Fatalf("unexpected span order: %s, %s, %s", grandchild.Name, child.Name, root.Name)
+	}
+	if !root.ParentID.IsZero() {
+		t.Fatalf("root span has parent %s", root.ParentID)
+	}
+	if child.ParentID != root.SpanID || grandchild.ParentID != child.SpanID {
+		t.Fatal("parent IDs do not link the tree")
+	}
+	if child.TraceID != root.TraceID || grandchild.TraceID != root.TraceID {
+		t.Fatal("spans of the tree have different trace IDs")
+	}
+	if root.SpanID == child.SpanID || child.SpanID == grandchild.SpanID {
+		t.Fatal("span IDs are not unique")
+	}
+	if root.Attributes["rows"] != 4 || child.Attributes["logN"] != 11 || grandchild.Attributes["bytes"] != uint64(1024) {
+		t.Fatalf("unexpected attributes: %v, %v, %v", root.Attributes, child.Attributes, grandchild.Attributes)
+	}
+	if root.Duration < child.Duration || root.End.Before(root.Start) {
+		t.Fatalf("inconsistent timing: root %v, child %v", root.Duration, child.Duration)
+	}
+	if len(collector.Find("child")) != 1 {
+		t.Fatal("expected to find the child span")
+	}
+
+	collector.Reset()
+	if len(collector.Spans()) != 0 {
+		t.Fatal("expected no spans after reset")
+	}
+}
+
+func TestJSONLinesExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := core.NewJSONLinesExporter(&buf)
+	core.SetSinks(exporter)
+	defer core.SetSinks(core.StdoutSink{})
+
+	traceTree()
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	root := lines[2]
+	if root["name"] != "root" || root["parentSpanId"] != "" || len(root["traceId"].(string)) != 32 {
+		t.Fatalf("unexpected root record: %v", root)
+	}
+	if lines[1]["parentSpanId"] != root["spanId"] {
+		t.Fatalf("child parent %v, expected %v", lines[1]["parentSpanId"], root["spanId"])
+	}
+	if attrs := lines[0]["attributes"].(map[string]any); attrs["bytes"] != float64(1024) {
+		t.Fatalf("unexpected attributes: %v", attrs)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- body
+	}))
+	defer collector.Close()
+
+	exporter := core.NewOTLPExporter(collector.URL+"/v1/traces", "lumenos-test")
+	exporter.OnError = func(err error) { t.Error(err) }
+	core.SetSinks(exporter)
+	defer core.SetSinks(core.StdoutSink{})
+
+	// Spans are sent once the root span ends
+	traceTree()
+
+	var request struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string            `json:"key"`
+					Value map[string]string `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Attributes   []struct {
+						Key   string            `json:"key"`
+						Value map[string]string `json:"value"`
+					} `json:"attributes"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	select {
+	case body := <-requests:
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatal("no spans were exported after the root span ended")
+	}
+
+	resource := request.ResourceSpans[0]
+	if attr := resource.Resource.Attributes[0]; attr.Key != "service.name" || attr.Value["stringValue"] != "lumenos-test" {
+		t.Fatalf("unexpected resource attribute: %v", attr)
+	}
+	spans := resource.ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	if spans[1].ParentSpanID != spans[2].SpanID || spans[0].TraceID != spans[2].TraceID {
+		t.Fatal("exported spans do not link the tree")
+	}
+	if attr := spans[1].Attributes[0]; attr.Key != "logN" || attr.Value["intValue"] != "11" {
+		t.Fatalf("unexpected attribute: %v", attr)
+	}
+
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryProfiling(t *testing.T) {
+	collector := core.NewMemoryCollector()
+	core.SetSinks(collector)
+	defer core.SetSinks(core.StdoutSink{})
+
+	unprofiled := core.StartSpan("unprofiled", nil)
+	unprofiled.End()
+	if unprofiled.Memory() != nil {
+		t.Fatal("memory profile recorded while profiling is disabled")
+	}
+
+	core.SetMemoryProfiling(time.Millisecond)
+	defer core.SetMemoryProfiling(0)
+
+	const size = 64 << 20
+	span := core.StartSpan("allocate", nil)
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	runtime.KeepAlive(buf)
+	span.End()
+
+	profile := span.Memory()
+	if profile == nil {
+		t.Fatal("no memory profile recorded")
+	}
+	if profile.AllocBytes < size {
+		t.Fatalf("allocated %d bytes, expected at least %d", profile.AllocBytes, size)
+	}
+	if profile.HeapPeak < size || profile.HeapPeak < profile.HeapStart || profile.HeapPeak < profile.HeapEnd {
+		t.Fatalf("heap peak %d below %d, start %d or end %d", profile.HeapPeak, size, profile.HeapStart, profile.HeapEnd)
+	}
+	record := collector.Find("allocate")[0]
+	if record.Attributes["mem.heap_peak"] != profile.HeapPeak || record.Attributes["mem.alloc_bytes"] != profile.AllocBytes {
+		t.Fatalf("memory attributes %v do not match the profile", record.Attributes)
+	}
+}
@@ -1,8 +1,8 @@
 package core
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
-	"fmt"
 
 	"github.com/gtank/merlin"
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
@@ -30,14 +30,14 @@ func (t *Transcript) AppendFields(label string, elements []*Element) {
 	}
 }
 
+// AppendCiphertext appends the SHA-256 digest of the ciphertext's binary encoding,
+// streaming it into the hash instead of marshalling the whole ciphertext.
 func (t *Transcript) AppendCiphertext(label string, ciphertext *rlwe.Ciphertext) {
-	fmt.Printf("ciphertext values: %v\n", len(ciphertext.Element.Value))
-	fmt.Printf("ciphertext [0]coeffs: %v\n", len(ciphertext.Element.Value[0].Coeffs))
-	bytes, err := ciphertext.MarshalBinary()
-	if err != nil {
+	h := sha256.New()
+	if _, err := ciphertext.WriteTo(h); err != nil {
 		panic(err)
 	}
-	t.AppendMessage([]byte(label), bytes)
+	t.AppendMessage([]byte(label), h.Sum(nil))
 }
 
 func (t *Transcript) SampleField(label string) *Element {
@@ -110,13 +110,69 @@ func NewTreeWithHashStrategy(leafs []Leaf, hashStrategy func() hash.Hash) (*Merk
 		tree.Leafs = append(tree.Leafs, node)
 	}
 
-	if len(tree.Leafs) == 1 {
-		tree.Root = tree.Leafs[0]
-		tree.merkleRoot = tree.Leafs[0].Hash
+	if err := tree.build(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// NewTreeFromLeafHashes builds the SHA-256 tree NewTree would over leaves hashed beforehand with LeafHash.
+// The tree does not hold the content of its leaves, so that large leaves can be hashed and dropped one at a time.
+func NewTreeFromLeafHashes(hashes [][]byte) (*MerkleTree, error) {
+	tree := &MerkleTree{
+		hashStrategy: sha256.New,
+		Leafs:        make([]*Node, 0, len(hashes)),
+	}
+
+	if len(hashes) == 0 {
+		tree.merkleRoot = nil
 		return tree, nil
 	}
 
-	currentLevelNodes := tree.Leafs
+	for _, h := range hashes {
+		if h == nil {
+			return nil, errors.New("leaf hash cannot be nil")
+		}
+		tree.Leafs = append(tree.Leafs, &Node{
+			Tree: tree,
+			leaf: true,
+			Hash: h,
+		})
+	}
+
+	if err := tree.build(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// LeafHash returns the hash of the leaf in a tree built by NewTree.
+func LeafHash(l Leaf) ([]byte, error) {
+	h := sha256.New()
+	if _, err := l.WriteTo(h); err != nil {
+		return nil, fmt.Errorf("failed to write leaf content to hash: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// LeafHashes returns the hashes of the leaves in order, from which NewTreeFromLeafHashes rebuilds the tree.
+func (m *MerkleTree) LeafHashes() [][]byte {
+	hashes := make([][]byte, len(m.Leafs))
+	for i, leaf := range m.Leafs {
+		hashes[i] = leaf.Hash
+	}
+	return hashes
+}
+
+// build hashes the levels of the tree above its leaves up to the root.
+func (m *MerkleTree) build() error {
+	if len(m.Leafs) == 1 {
+		m.Root = m.Leafs[0]
+		m.merkleRoot = m.Leafs[0].Hash
+		return nil
+	}
+
+	currentLevelNodes := m.Leafs
 	for len(currentLevelNodes) > 1 {
 		var nextLevelNodes []*Node
 
@@ -131,7 +187,7 @@ func NewTreeWithHashStrategy(leafs []Leaf, hashStrategy func() hash.Hash) (*Merk
 			}
 
 			parent := &Node{
-				Tree:  tree,
+				Tree:  m,
 				leaf:  false,
 				Left:  left,
 				Right: right,
@@ -140,7 +196,7 @@ func NewTreeWithHashStrategy(leafs []Leaf, hashStrategy func() hash.Hash) (*Merk
 			var err error
 			parent.Hash, err = calculateNodeHash(parent)
 			if err != nil {
-				return nil, fmt.Errorf("failed to calculate hash for internal node: %w", err)
+				return fmt.Errorf("failed to calculate hash for internal node: %w", err)
 			}
 
 			left.Parent = parent
@@ -154,12 +210,12 @@ func NewTreeWithHashStrategy(leafs []Leaf, hashStrategy func() hash.Hash) (*Merk
 	}
 
 	if len(currentLevelNodes) != 1 {
-		return nil, errors.New("tree construction finished with != 1 node at the root level")
+		return errors.New("tree construction finished with != 1 node at the root level")
 	}
-	tree.Root = currentLevelNodes[0]
-	tree.merkleRoot = tree.Root.Hash
+	m.Root = currentLevelNodes[0]
+	m.merkleRoot = m.Root.Hash
 
-	return tree, nil
+	return nil
 }
 
 func (m *MerkleTree) MerkleRoot() []byte {
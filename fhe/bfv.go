@@ -16,33 +16,38 @@ type ServerBFV struct {
 	*bgv.Evaluator
 	*bgv.Encoder
 	*rlwe.Encryptor
-	rs         *RingSwitchServer
-	mulCounter int
+	rs   *RingSwitchServer
+	cost *CostAccountant
 }
 
 func NewBackendBFV(plaintextField *core.PrimeField, params bgv.Parameters, pk *rlwe.PublicKey, evk rlwe.EvaluationKeySet) *ServerBFV {
 	evaluator := bgv.NewEvaluator(params, evk) // TODO: use BFV scaleInvariant=true and use MulScaleInvariant instead of MulNew
 	encoder := bgv.NewEncoder(params)
 	encryptor := rlwe.NewEncryptor(params, pk)
-	return &ServerBFV{plaintextField, params, evaluator, encoder, encryptor, nil, 0}
+	return &ServerBFV{plaintextField, params, evaluator, encoder, encryptor, nil, NewCostAccountant()}
 }
 
 func (b *ServerBFV) Field() *core.PrimeField {
 	return b.ptField
 }
 
-func (b *ServerBFV) Mul(op0 *rlwe.Ciphertext, op1 rlwe.Operand, opOut *rlwe.Ciphertext) (err error) {
-	b.mulCounter++
-	return b.Evaluator.Mul(op0, op1, opOut)
+// MulCounter returns the number of multiplications performed by the backend and all its copies.
+func (b *ServerBFV) MulCounter() int {
+	ops := b.cost.Counts()
+	return int(ops.MulPlain + ops.MulCt)
 }
 
-func (b *ServerBFV) MulNew(op0 *rlwe.Ciphertext, op1 rlwe.Operand) (opOut *rlwe.Ciphertext, err error) {
-	b.mulCounter++
-	return b.Evaluator.MulNew(op0, op1)
+// Ops returns the operations performed by the backend and all its copies, see Scoped.
+func (b *ServerBFV) Ops() OpCounts {
+	return b.cost.Counts()
 }
 
-func (b *ServerBFV) MulCounter() int {
-	return b.mulCounter
+// Scoped returns a copy of the backend that counts its operations, and those of its copies, separately from b.
+// They are still counted by b, so that concurrent phases can report their own costs.
+func (b *ServerBFV) Scoped() *ServerBFV {
+	scoped := b.CopyNew()
+	scoped.cost = b.cost.Scope()
+	return scoped
 }
 
 func (b *ServerBFV) SetRingSwitchServer(rs *RingSwitchServer) {
@@ -54,7 +59,7 @@ func (b *ServerBFV) RingSwitch() *RingSwitchServer {
 }
 
 func (b *ServerBFV) CopyNew() *ServerBFV {
-	return &ServerBFV{b.ptField, b.params, b.Evaluator.ShallowCopy(), b.Encoder.ShallowCopy(), b.Encryptor.ShallowCopy(), b.rs, b.mulCounter}
+	return &ServerBFV{b.ptField, b.params, b.Evaluator.ShallowCopy(), b.Encoder.ShallowCopy(), b.Encryptor.ShallowCopy(), b.rs, b.cost}
 }
 
 type ClientBFV struct {
@@ -120,7 +125,16 @@ func (b *ClientBFV) RingSwitch() *RingSwitch {
 //   - Xe, Xs: Left empty to use Lattigo defaults (Gaussian error, Ternary secret).
 func GenerateBGVParamsForNTT(nttSize int, logN int, plaintextModulus uint64) (bgv.ParametersLiteral, error) {
 	fmt.Printf("LogN: %v\n", logN)
+	paramsLit, err := bgvParamsForNTT(nttSize, logN, plaintextModulus)
+	if err != nil {
+		return bgv.ParametersLiteral{}, err
+	}
+	fmt.Println("ModQ chain length", len(paramsLit.LogQ))
+	return paramsLit, nil
+}
 
+// bgvParamsForNTT is GenerateBGVParamsForNTT without logging, for the planner to try many shapes.
+func bgvParamsForNTT(nttSize int, logN int, plaintextModulus uint64) (bgv.ParametersLiteral, error) {
 	// --- Input Validation (Simplified) ---
 	if nttSize < 2 {
 		return bgv.ParametersLiteral{}, errors.New("nttSize must be >= 2")
@@ -157,8 +171,6 @@ func GenerateBGVParamsForNTT(nttSize int, logN int, plaintextModulus uint64) (bg
 	// The formula k+1 works directly for k=1 (nttSize=2) as well.
 	numQPrimes := k
 
-	fmt.Println("ModQ chain length", numQPrimes)
-
 	// Generate LogQ slice: Use [60, 59, 59, ...] pattern
 	logQ := make([]int, numQPrimes)
 	if numQPrimes > 0 {
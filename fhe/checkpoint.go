@@ -0,0 +1,193 @@
+package fhe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// Checkpoint writes the commitment to w, so that ResumeLigeroProver can open it later, e.g. after a restart,
+// without encoding the matrix again. It holds the metadata, the matrix Prove evaluates the inner products on, the
+// encoded matrix, each ciphertext prefixed with its size, and the leaf hashes and root of the Merkle tree.
+// Ciphertexts are loaded and written one at a time.
+func (c *LigeroProver) Checkpoint(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	header := bytes.NewBuffer(nil)
+	if err := c.Committer.LigeroMetadata.WriteTo(header); err != nil {
+		return err
+	}
+	for _, n := range []int{c.Matrix.Len(), c.EncodedMatrix.Len()} {
+		if err := binary.Write(header, binary.LittleEndian, uint32(n)); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	for _, store := range []CiphertextStore{c.Matrix, c.EncodedMatrix} {
+		for i := range store.Len() {
+			ct, err := store.Load(i)
+			if err != nil {
+				return err
+			}
+			data, err := ct.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err := binary.Write(bw, binary.LittleEndian, uint32(len(data))); err != nil {
+				return err
+			}
+			if _, err := bw.Write(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, hash := range c.Tree.LeafHashes() {
+		if _, err := bw.Write(hash); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.Write(c.Tree.MerkleRoot()); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ResumeLigeroProver reads a commitment written by Checkpoint under the parameters of backend, loading its matrix
+// and encoded matrix into stores made by newStore, or in memory if nil, one ciphertext at a time. The Merkle tree is
+// rebuilt from its leaf hashes, and the encoded columns are hashed again with backend; a checkpoint whose shape,
+// root or encoded columns do not match returns an error wrapping ErrCorruptCheckpoint. The matrix itself is not
+// bound to the root: a corrupt one is only caught by the verifier of the proofs opening it. The resumed prover closes
+// both stores on Close. r may be read past the checkpoint. Cancelling ctx aborts hashing the columns.
+func ResumeLigeroProver(ctx context.Context, r io.Reader, backend *ServerBFV, newStore NewStoreFunc) (*LigeroProver, error) {
+	params := *backend.GetParameters()
+	if newStore == nil {
+		newStore = NewMemoryStore
+	}
+	br := bufio.NewReader(r)
+
+	var metadata LigeroMetadata
+	var matrixLen, encodedLen uint32
+	header := make([]byte, 12+2*4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptCheckpoint, err)
+	}
+	buf := bytes.NewBuffer(header)
+	if err := metadata.ReadFrom(buf); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptCheckpoint, err)
+	}
+	// The header was read in full, so the lengths cannot be short
+	binary.Read(buf, binary.LittleEndian, &matrixLen)
+	binary.Read(buf, binary.LittleEndian, &encodedLen)
+
+	k := metadata.ColumnsPerCiphertext()
+	if metadata.Rows <= 0 || metadata.RhoInv <= 0 || metadata.Cols%k != 0 {
+		return nil, fmt.Errorf("%w: %dx%d matrix at rate 1/%d in ciphertexts of %d columns", ErrCorruptCheckpoint, metadata.Rows, metadata.Cols, metadata.RhoInv, k)
+	}
+	leaves := metadata.Cols * metadata.RhoInv / k
+	if expected := metadata.Cols / k * metadata.Segments(params); int(matrixLen) != expected || int(encodedLen) != expected*metadata.RhoInv {
+		return nil, fmt.Errorf("%w: %d and %d ciphertexts, expected %d and %d under the parameters", ErrCorruptCheckpoint, matrixLen, encodedLen, expected, expected*metadata.RhoInv)
+	}
+
+	c := &LigeroProver{
+		Committer:  &LigeroCommitter{LigeroMetadata: metadata, NewStore: newStore},
+		ownsMatrix: true,
+	}
+	var err error
+	if c.Matrix, err = readStore(br, int(matrixLen), newStore); err != nil {
+		return nil, err
+	}
+	if c.EncodedMatrix, err = readStore(br, int(encodedLen), newStore); err != nil {
+		c.Matrix.Close()
+		return nil, err
+	}
+
+	if c.Tree, err = readTree(br, leaves); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	hashes, err := processLeafParallel(ctx, c.EncodedMatrix, metadata.Segments(params), backend.Scoped())
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	for i, hash := range c.Tree.LeafHashes() {
+		if !bytes.Equal(hashes[i], hash) {
+			c.Close()
+			return nil, fmt.Errorf("%w: encoded column %d does not match its leaf hash", ErrCorruptCheckpoint, i)
+		}
+	}
+	return c, nil
+}
+
+// readStore reads n ciphertexts into a store made by newStore.
+func readStore(r io.Reader, n int, newStore NewStoreFunc) (CiphertextStore, error) {
+	store, err := newStore(n)
+	if err != nil {
+		return nil, err
+	}
+	for i := range n {
+		ct, err := readCiphertext(r)
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("%w: ciphertext %d of %d: %w", ErrCorruptCheckpoint, i, n, err)
+		}
+		if err := store.Store(i, ct); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// readCiphertext reads a ciphertext written by Checkpoint, prefixed with its size.
+func readCiphertext(r io.Reader) (*rlwe.Ciphertext, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	ct := new(rlwe.Ciphertext)
+	if err := ct.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// readTree reads the hashes of the given number of leaves and the root, and rebuilds the tree.
+func readTree(r io.Reader, leaves int) (*core.MerkleTree, error) {
+	hashes := make([][]byte, leaves)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		if _, err := io.ReadFull(r, hashes[i]); err != nil {
+			return nil, fmt.Errorf("%w: leaf hash %d of %d: %w", ErrCorruptCheckpoint, i, leaves, err)
+		}
+	}
+	root := make([]byte, 32)
+	if _, err := io.ReadFull(r, root); err != nil {
+		return nil, fmt.Errorf("%w: root: %w", ErrCorruptCheckpoint, err)
+	}
+
+	tree, err := core.NewTreeFromLeafHashes(hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tree.MerkleRoot(), root) {
+		return nil, fmt.Errorf("%w: leaf hashes do not match the root", ErrCorruptCheckpoint)
+	}
+	return tree, nil
+}
@@ -0,0 +1,122 @@
+package fhe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+func TestLigeroCheckpoint(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		rows, packing int
+	}{
+		{"segments", 80, 1},
+		{"packed", 6, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) { testLigeroCheckpoint(t, tc.rows, tc.packing) })
+	}
+}
+
+// testLigeroCheckpoint checks that a resumed commitment opens to the proof of the original one.
+func testLigeroCheckpoint(t *testing.T, rows, packing int) {
+	const cols = 8
+	paramsLiteral, err := fhe.GenerateBGVParamsForNTT(cols, 5, Modulus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _, ciphertexts := setupSmallLigero(t, rows, cols, packing, true, paramsLiteral)
+	params := *server.GetParameters()
+
+	ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ligero.Packing = packing
+	comm, root, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comm.Close()
+
+	var checkpoint bytes.Buffer
+	if err := comm.Checkpoint(&checkpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	resumed, err := fhe.ResumeLigeroProver(context.Background(), bytes.NewReader(checkpoint.Bytes()), server, fhe.FileStores(dir, params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Committer.LigeroMetadata != ligero.LigeroMetadata {
+		t.Fatalf("resumed %+v, committed %+v", resumed.Committer.LigeroMetadata, ligero.LigeroMetadata)
+	}
+	if !bytes.Equal(resumed.Tree.MerkleRoot(), root) {
+		t.Fatal("resumed commitment has a different root")
+	}
+
+	// Both open at new points to the same proof
+	for _, point := range []uint64{3, 5} {
+		proof, err := comm.Prove(context.Background(), core.NewElement(point), server, core.NewTranscript("test"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumedProof, err := resumed.Prove(context.Background(), core.NewElement(point), server, core.NewTranscript("test"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		marshaled, err := proof.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumedMarshaled, err := resumedProof.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(marshaled, resumedMarshaled) {
+			t.Fatalf("resumed commitment opens differently at %d", point)
+		}
+	}
+
+	if err := resumed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("expected the store files to be removed, found %v, %v", entries, err)
+	}
+
+	// A flipped leaf hash no longer matches the root, and a truncated checkpoint fails to read
+	corrupt := bytes.Clone(checkpoint.Bytes())
+	corrupt[len(corrupt)-33] ^= 1
+	if _, err := fhe.ResumeLigeroProver(context.Background(), bytes.NewReader(corrupt), server, nil); !errors.Is(err, fhe.ErrCorruptCheckpoint) {
+		t.Fatalf("expected ErrCorruptCheckpoint for a corrupt leaf hash, got %v", err)
+	}
+	if _, err := fhe.ResumeLigeroProver(context.Background(), bytes.NewReader(checkpoint.Bytes()[:checkpoint.Len()/2]), server, nil); !errors.Is(err, fhe.ErrCorruptCheckpoint) {
+		t.Fatalf("expected ErrCorruptCheckpoint for a truncated checkpoint, got %v", err)
+	}
+
+	// An encoded column that no longer matches its leaf hash is caught on resume
+	encoded := make([]*rlwe.Ciphertext, comm.EncodedMatrix.Len())
+	for i := range encoded {
+		if encoded[i], err = comm.EncodedMatrix.Load(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encoded[1] = encoded[1].CopyNew()
+	encoded[1].Value[0].Coeffs[0][0] ^= 1
+	tampered := &fhe.LigeroProver{Committer: comm.Committer, Matrix: comm.Matrix, EncodedMatrix: fhe.MemoryStore(encoded), Tree: comm.Tree}
+	checkpoint.Reset()
+	if err := tampered.Checkpoint(&checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fhe.ResumeLigeroProver(context.Background(), bytes.NewReader(checkpoint.Bytes()), server, nil); !errors.Is(err, fhe.ErrCorruptCheckpoint) {
+		t.Fatalf("expected ErrCorruptCheckpoint for a tampered encoded column, got %v", err)
+	}
+}
@@ -1,19 +1,46 @@
 package fhe
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/nulltea/lumenos/core"
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
 )
 
-func Encode(matrix []*rlwe.Ciphertext, rows, rhoInv int, backend *ServerBFV) ([]*rlwe.Ciphertext, error) {
-	cols := len(matrix)
-	encoded := make([]*rlwe.Ciphertext, cols*rhoInv)
-	for i := 0; i < cols; i++ {
-		encoded[i] = matrix[i].CopyNew()
+// Encode Reed-Solomon encodes the rows of the encrypted column-major matrix with rate 1/rhoInv.
+// Matrices with more rows than slots are split into segments as described by LigeroMetadata.Segments; the rows
+// of each block are encoded separately and the result is laid out alike.
+// Cancelling ctx aborts the homomorphic NTT.
+func Encode(ctx context.Context, matrix []*rlwe.Ciphertext, rows, rhoInv int, backend *ServerBFV) ([]*rlwe.Ciphertext, error) {
+	encoded, err := EncodeStore(ctx, MemoryStore(matrix), LigeroMetadata{Rows: rows, RhoInv: rhoInv}, NewMemoryStore, backend)
+	if err != nil {
+		return nil, err
 	}
+	return encoded.(MemoryStore), nil
+}
+
+// EncodeStore is Encode on a matrix in a store, laid out and packed as described by m, writing the encoded matrix
+// to a store made by newStore. It holds O(sqrt(Cols*RhoInv)) ciphertexts in memory at a time, keeping the partial
+// transforms in stores made by newStore too, see nttStream.
+// See LigeroMetadata.CheckPacking for the shapes packing supports.
+func EncodeStore(ctx context.Context, matrix CiphertextStore, m LigeroMetadata, newStore NewStoreFunc, backend *ServerBFV) (CiphertextStore, error) {
+	slots := backend.params.MaxSlots()
+	blocks := segments(m.Rows, slots)
+	if matrix.Len()%blocks != 0 {
+		return nil, fmt.Errorf("%w: %d ciphertexts do not split into %d segments of %d rows", core.ErrDimensionMismatch, matrix.Len(), blocks, m.Rows)
+	}
+	k := m.ColumnsPerCiphertext()
+	window := min(m.Rows, slots)
+	if k > 1 {
+		window = m.Window()
+	}
+	cts := matrix.Len() / blocks
+	extCts := cts * m.RhoInv
 
 	zeroColPt := bgv.NewPlaintext(backend.params, backend.params.MaxLevel())
-	if err := backend.Encode(make([]uint64, rows), zeroColPt); err != nil {
+	if err := backend.Encode(make([]uint64, k*window), zeroColPt); err != nil {
 		return nil, err
 	}
 	zeroCol, err := backend.EncryptNew(zeroColPt)
@@ -21,14 +48,85 @@ func Encode(matrix []*rlwe.Ciphertext, rows, rhoInv int, backend *ServerBFV) ([]
 		return nil, err
 	}
 
-	for i := cols; i < cols*rhoInv; i++ {
-		encoded[i] = zeroCol.CopyNew()
-	}
-
-	ntt, err := NTT(encoded, cols*rhoInv, backend)
+	encoded, err := newStore(blocks * extCts)
 	if err != nil {
 		return nil, err
 	}
+	for s := range blocks {
+		in := func(x int) (*rlwe.Ciphertext, error) {
+			if x < cts {
+				return matrix.Load(s*cts + x)
+			}
+			return zeroCol, nil
+		}
+		out := func(x int, ct *rlwe.Ciphertext) error {
+			return encoded.Store(s*extCts+x, ct)
+		}
+
+		if err := nttStream(ctx, in, out, extCts*k, k, window, newStore, backend); err != nil {
+			encoded.Close()
+			return nil, err
+		}
+	}
+
+	return encoded, nil
+}
+
+// MatrixEncryptor batch encodes and encrypts plaintexts; ServerBFV and ClientBFV implement it.
+type MatrixEncryptor interface {
+	Encode(values interface{}, pt *rlwe.Plaintext) error
+	EncryptNew(pt *rlwe.Plaintext) (*rlwe.Ciphertext, error)
+}
+
+// EncryptMatrix encrypts the row-major matrix column by column in the layout Encode and LigeroCommitter.Commit
+// expect: columns with more rows than params has slots are split into segments (see LigeroMetadata.Segments).
+// With packing above 1, that many consecutive columns share a ciphertext as described by LigeroMetadata.Window.
+// Cancelling ctx aborts the encryption.
+func EncryptMatrix(ctx context.Context, matrix [][]*core.Element, packing int, params bgv.Parameters, encryptor MatrixEncryptor) ([]*rlwe.Ciphertext, error) {
+	if len(matrix) == 0 {
+		return nil, fmt.Errorf("%w: empty matrix", core.ErrInvalidSize)
+	}
+	rows, cols := len(matrix), len(matrix[0])
+	slots := params.MaxSlots()
+	blocks := segments(rows, slots)
+	packing = max(packing, 1)
+	window := LigeroMetadata{Rows: rows}.Window()
+	if packing > 1 && (packing*window > slots || cols%packing != 0) {
+		return nil, fmt.Errorf("%w: %dx%d matrix by %d columns per ciphertext of %d slots", ErrPacking, rows, cols, packing, slots)
+	}
+	if packing == 1 {
+		window = min(rows, slots)
+	}
+
+	ciphertexts := make([]*rlwe.Ciphertext, blocks*cols/packing)
+	for s := range blocks {
+		block := matrix[s*slots : min((s+1)*slots, rows)]
+		for c := range cols / packing {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			column := make([]uint64, packing*window)
+			for w := range packing {
+				j := c*packing + w
+				for i, row := range block {
+					if len(row) != cols {
+						return nil, fmt.Errorf("%w: row %d has %d columns, expected %d", core.ErrDimensionMismatch, s*slots+i, len(row), cols)
+					}
+					column[w*window+i] = row[j].Uint64()
+				}
+			}
+
+			plaintext := bgv.NewPlaintext(params, params.MaxLevel())
+			if err := encryptor.Encode(column, plaintext); err != nil {
+				return nil, err
+			}
+			ct, err := encryptor.EncryptNew(plaintext)
+			if err != nil {
+				return nil, err
+			}
+			ciphertexts[s*cols/packing+c] = ct
+		}
+	}
 
-	return ntt, nil
+	return ciphertexts, nil
 }
@@ -1,6 +1,7 @@
 package fhe_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -71,7 +72,7 @@ func TestEncode(t *testing.T) {
 
 	// Apply NTT
 	start = time.Now()
-	result, err := fhe.Encode(ciphertexts, rows, rhoInv, backend)
+	result, err := fhe.Encode(context.Background(), ciphertexts, rows, rhoInv, backend)
 	if err != nil {
 		panic(err)
 	}
@@ -101,7 +102,10 @@ func TestEncode(t *testing.T) {
 	start = time.Now()
 	encodedMatrixCheck := make([][]*core.Element, rows)
 	for i := range matrix {
-		encodedMatrixCheck[i] = core.Encode(matrix[i], rhoInv, &ptField)
+		encodedMatrixCheck[i], err = core.Encode(matrix[i], rhoInv, &ptField)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 	fmt.Printf("Plain RS encoding: %v\n", time.Since(start))
 	// fmt.Printf("Encoded matrix check: %v\n", encodedMatrixCheck)
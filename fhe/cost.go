@@ -0,0 +1,190 @@
+package fhe
+
+import (
+	"sync/atomic"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// OpCounts is the number of homomorphic operations of each kind.
+// InnerSum counts calls, not the rotations they perform internally.
+type OpCounts struct {
+	Add       uint64
+	Sub       uint64
+	MulPlain  uint64 // ciphertext-plaintext and ciphertext-scalar multiplications
+	MulCt     uint64 // ciphertext-ciphertext multiplications
+	Rescale   uint64
+	Rotate    uint64
+	InnerSum  uint64
+	KeySwitch uint64 // relinearizations and explicit evaluation key applications, e.g. ring switching
+	Encrypt   uint64
+}
+
+// Total returns the number of operations of all kinds.
+func (c OpCounts) Total() uint64 {
+	return c.Add + c.Sub + c.MulPlain + c.MulCt + c.Rescale + c.Rotate + c.InnerSum + c.KeySwitch + c.Encrypt
+}
+
+// Attributes records the non-zero counts on span as "ops.<kind>" attributes.
+func (c OpCounts) Attributes(span *core.Span) {
+	for _, op := range []struct {
+		key   string
+		count uint64
+	}{
+		{"ops.add", c.Add},
+		{"ops.sub", c.Sub},
+		{"ops.mul_plain", c.MulPlain},
+		{"ops.mul_ct", c.MulCt},
+		{"ops.rescale", c.Rescale},
+		{"ops.rotate", c.Rotate},
+		{"ops.inner_sum", c.InnerSum},
+		{"ops.key_switch", c.KeySwitch},
+		{"ops.encrypt", c.Encrypt},
+	} {
+		if op.count > 0 {
+			span.SetAttribute(op.key, op.count)
+		}
+	}
+}
+
+// CostAccountant counts homomorphic operations. It is safe for concurrent use, so that every worker copy of a
+// backend can share it. Operations counted by a scope are also counted by its parent.
+type CostAccountant struct {
+	parent *CostAccountant
+
+	add, sub, mulPlain, mulCt, rescale, rotate, innerSum, keySwitch, encrypt atomic.Uint64
+}
+
+func NewCostAccountant() *CostAccountant {
+	return &CostAccountant{}
+}
+
+// Scope returns an accountant whose operations are also counted by a.
+func (a *CostAccountant) Scope() *CostAccountant {
+	return &CostAccountant{parent: a}
+}
+
+// Counts returns the operations counted so far.
+func (a *CostAccountant) Counts() OpCounts {
+	return OpCounts{
+		Add:       a.add.Load(),
+		Sub:       a.sub.Load(),
+		MulPlain:  a.mulPlain.Load(),
+		MulCt:     a.mulCt.Load(),
+		Rescale:   a.rescale.Load(),
+		Rotate:    a.rotate.Load(),
+		InnerSum:  a.innerSum.Load(),
+		KeySwitch: a.keySwitch.Load(),
+		Encrypt:   a.encrypt.Load(),
+	}
+}
+
+// count increments the counter selected by op on a and all its parents.
+func (a *CostAccountant) count(op func(*CostAccountant) *atomic.Uint64) {
+	for ; a != nil; a = a.parent {
+		op(a).Add(1)
+	}
+}
+
+func (a *CostAccountant) countMul(op1 rlwe.Operand) {
+	if _, ok := op1.(*rlwe.Ciphertext); ok {
+		a.count(func(a *CostAccountant) *atomic.Uint64 { return &a.mulCt })
+	} else {
+		a.count(func(a *CostAccountant) *atomic.Uint64 { return &a.mulPlain })
+	}
+}
+
+// The methods below shadow the ones of the embedded evaluator and encryptor to count operations.
+
+func (b *ServerBFV) Add(op0 *rlwe.Ciphertext, op1 rlwe.Operand, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.add })
+	return b.Evaluator.Add(op0, op1, opOut)
+}
+
+func (b *ServerBFV) AddNew(op0 *rlwe.Ciphertext, op1 rlwe.Operand) (opOut *rlwe.Ciphertext, err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.add })
+	return b.Evaluator.AddNew(op0, op1)
+}
+
+func (b *ServerBFV) Sub(op0 *rlwe.Ciphertext, op1 rlwe.Operand, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.sub })
+	return b.Evaluator.Sub(op0, op1, opOut)
+}
+
+func (b *ServerBFV) SubNew(op0 *rlwe.Ciphertext, op1 rlwe.Operand) (opOut *rlwe.Ciphertext, err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.sub })
+	return b.Evaluator.SubNew(op0, op1)
+}
+
+func (b *ServerBFV) Mul(op0 *rlwe.Ciphertext, op1 rlwe.Operand, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.countMul(op1)
+	return b.Evaluator.Mul(op0, op1, opOut)
+}
+
+func (b *ServerBFV) MulNew(op0 *rlwe.Ciphertext, op1 rlwe.Operand) (opOut *rlwe.Ciphertext, err error) {
+	b.cost.countMul(op1)
+	return b.Evaluator.MulNew(op0, op1)
+}
+
+func (b *ServerBFV) MulRelin(op0 *rlwe.Ciphertext, op1 rlwe.Operand, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.countMul(op1)
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.keySwitch })
+	return b.Evaluator.MulRelin(op0, op1, opOut)
+}
+
+func (b *ServerBFV) MulRelinNew(op0 *rlwe.Ciphertext, op1 rlwe.Operand) (opOut *rlwe.Ciphertext, err error) {
+	b.cost.countMul(op1)
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.keySwitch })
+	return b.Evaluator.MulRelinNew(op0, op1)
+}
+
+func (b *ServerBFV) Rescale(op0, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.rescale })
+	return b.Evaluator.Rescale(op0, opOut)
+}
+
+func (b *ServerBFV) RotateColumns(op0 *rlwe.Ciphertext, k int, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.rotate })
+	return b.Evaluator.RotateColumns(op0, k, opOut)
+}
+
+func (b *ServerBFV) RotateColumnsNew(op0 *rlwe.Ciphertext, k int) (opOut *rlwe.Ciphertext, err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.rotate })
+	return b.Evaluator.RotateColumnsNew(op0, k)
+}
+
+func (b *ServerBFV) RotateRows(op0, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.rotate })
+	return b.Evaluator.RotateRows(op0, opOut)
+}
+
+func (b *ServerBFV) RotateRowsNew(op0 *rlwe.Ciphertext) (opOut *rlwe.Ciphertext, err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.rotate })
+	return b.Evaluator.RotateRowsNew(op0)
+}
+
+func (b *ServerBFV) InnerSum(ctIn *rlwe.Ciphertext, batchSize, n int, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.innerSum })
+	return b.Evaluator.InnerSum(ctIn, batchSize, n, opOut)
+}
+
+func (b *ServerBFV) ApplyEvaluationKey(ctIn *rlwe.Ciphertext, evk *rlwe.EvaluationKey, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.keySwitch })
+	return b.Evaluator.ApplyEvaluationKey(ctIn, evk, opOut)
+}
+
+func (b *ServerBFV) Relinearize(ctIn *rlwe.Ciphertext, opOut *rlwe.Ciphertext) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.keySwitch })
+	return b.Evaluator.Relinearize(ctIn, opOut)
+}
+
+func (b *ServerBFV) Encrypt(pt *rlwe.Plaintext, ct interface{}) (err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.encrypt })
+	return b.Encryptor.Encrypt(pt, ct)
+}
+
+func (b *ServerBFV) EncryptNew(pt *rlwe.Plaintext) (ct *rlwe.Ciphertext, err error) {
+	b.cost.count(func(a *CostAccountant) *atomic.Uint64 { return &a.encrypt })
+	return b.Encryptor.EncryptNew(pt)
+}
@@ -0,0 +1,18 @@
+package fhe
+
+import "errors"
+
+var (
+	// ErrMalformedProof is returned when a proof's shape does not match its metadata.
+	ErrMalformedProof = errors.New("malformed proof")
+	// ErrWellFormedness is returned when a queried column is inconsistent with the encoded inner products.
+	ErrWellFormedness = errors.New("well-formedness check failed")
+	// ErrValueMismatch is returned when the claimed value does not match the evaluation of the committed polynomial.
+	ErrValueMismatch = errors.New("claimed value does not match the evaluation of the committed polynomial")
+	// ErrMissingDecryptionProof is returned when verifying decryption of a proof that carries no decryption proof.
+	ErrMissingDecryptionProof = errors.New("missing decryption proof")
+	// ErrNotStored is returned when loading a ciphertext from a store that never had it stored.
+	ErrNotStored = errors.New("ciphertext not stored")
+	// ErrCorruptCheckpoint is returned when a commitment checkpoint does not match its metadata or Merkle root.
+	ErrCorruptCheckpoint = errors.New("corrupt commitment checkpoint")
+)
@@ -2,16 +2,20 @@ package fhe
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/bits"
-	"runtime"
+	"slices"
 	"sync"
 
 	"github.com/dustin/go-humanize"
 	"github.com/nulltea/lumenos/core"
 	"github.com/nulltea/lumenos/vdec"
+	"github.com/nulltea/lumenos/vdec/batching"
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
 )
@@ -21,19 +25,64 @@ type LigeroMetadata struct {
 	Cols    int
 	RhoInv  int
 	Queries int
+	// Packing is the number of columns each ciphertext holds, see Window. 0 and 1 leave a column per ciphertext.
+	Packing int
+}
+
+// Segments returns the number of ciphertexts each column of the matrix is split into under params.
+// A ciphertext holds as many rows as params has slots, so taller matrices are cut into blocks of rows and the
+// encrypted matrix lists the columns of the first block, then those of the second, and so on.
+func (m LigeroMetadata) Segments(params bgv.Parameters) int {
+	return segments(m.Rows, params.MaxSlots())
+}
+
+// GaloisElements returns the Galois elements of the keys the server needs to compute the inner products of
+// the segments of a column, see innerSumSlots, and to encode packed columns, see nttStream.
+func (m LigeroMetadata) GaloisElements(params bgv.Parameters) []uint64 {
+	if k := m.ColumnsPerCiphertext(); k > 1 {
+		galEls := append(params.GaloisElementsForInnerSum(1, m.Window()), packedGaloisElements(k, m.Window(), params)...)
+		slices.Sort(galEls)
+		return slices.Compact(galEls)
+	}
+	half := params.MaxSlots() / 2
+	galEls := params.GaloisElementsForInnerSum(1, min(m.Rows, half))
+	if m.Rows > half {
+		galEls = append(galEls, params.GaloisElementForRowRotation())
+	}
+	return galEls
+}
+
+func segments(rows, slots int) int {
+	return (rows + slots - 1) / slots
 }
 
 // LigeroCommitter holds the parameters for the Ligero commitment scheme.
 type LigeroCommitter struct {
 	LigeroMetadata
+	// NewStore creates the stores Commit writes the encoded matrix and the partial transforms of the encoding to,
+	// NewMemoryStore if nil. Use FileStores to prove matrices larger than memory.
+	NewStore NewStoreFunc
 }
 
-// LigeroProver holds the commitment data.
+// LigeroProver holds the commitment data. Close releases the encoded matrix.
 type LigeroProver struct {
 	Committer     *LigeroCommitter
-	Matrix        []*rlwe.Ciphertext
-	EncodedMatrix []*rlwe.Ciphertext
+	Matrix        CiphertextStore
+	EncodedMatrix CiphertextStore
 	Tree          *core.MerkleTree
+
+	// ownsMatrix is set when the prover created Matrix, on ResumeLigeroProver, and releases it on Close.
+	ownsMatrix bool
+}
+
+// Close releases the encoded matrix, leaving the matrix to its owner unless the prover was resumed from a
+// checkpoint. The prover must not be used afterwards.
+func (c *LigeroProver) Close() error {
+	err := c.EncodedMatrix.Close()
+	if c.ownsMatrix {
+		err = errors.Join(err, c.Matrix.Close())
+	}
+	return err
 }
 
 // NewLigeroCommitter creates a new LigeroCommitter based on security bits and size.
@@ -48,9 +97,7 @@ func NewLigeroCommitter(securityBits float64, rows int, cols int, rhoInv int) (*
 
 	queries := calculateQueries(securityBits, rhoInv)
 
-	// Pick matrix aspect ratio to minimize proof size.
-	// cols := math.Ceil(math.Sqrt(float64(size)))
-	// rows := math.Ceil(float64(size) / cols)
+	// The aspect ratio is the caller's choice, RecommendShape picks the one minimizing the proof size.
 
 	return &LigeroCommitter{
 		LigeroMetadata: LigeroMetadata{
@@ -92,25 +139,50 @@ func CalculateQueriesBCI20(securityBits float64, rhoInv int, rows int, modulus u
 	return int(math.Ceil(nom / denom)), nil
 }
 
-func (c *LigeroCommitter) Commit(matrix []*rlwe.Ciphertext, backend *ServerBFV, ctx *core.Span) (*LigeroProver, []byte, error) {
-	encoded, err := func() ([]*rlwe.Ciphertext, error) {
-		span := core.StartSpan("Encode", ctx)
+// Commit encodes the encrypted matrix and builds the Merkle tree over its encoded columns.
+// The matrix is laid out as described by LigeroMetadata.Segments, or LigeroMetadata.Window if packed; a packed
+// ciphertext is a single leaf that opens all its columns.
+// The prover loads the matrix from its store, which must outlive it.
+// Cancelling ctx stops all workers and aborts the commitment.
+func (c *LigeroCommitter) Commit(ctx context.Context, matrix CiphertextStore, backend *ServerBFV, parentSpan *core.Span) (*LigeroProver, []byte, error) {
+	if err := c.CheckPacking(backend.params); err != nil {
+		return nil, nil, err
+	}
+	newStore := c.NewStore
+	if newStore == nil {
+		newStore = NewMemoryStore
+	}
+	encoded, err := func() (CiphertextStore, error) {
+		span := core.StartSpan("Encode", parentSpan)
 		defer span.End()
-		return Encode(matrix, c.Rows, c.RhoInv, backend)
+		span.SetAttribute("rows", c.Rows)
+		span.SetAttribute("cols", c.Cols)
+		span.SetAttribute("logN", backend.GetParameters().LogN())
+		backend := backend.Scoped()
+		defer func() { backend.Ops().Attributes(span) }()
+		if k := c.ColumnsPerCiphertext(); k > 1 {
+			span.SetAttribute("packing", k)
+		}
+		return EncodeStore(ctx, matrix, c.LigeroMetadata, newStore, backend)
 	}()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	span := core.StartSpan("Merkle tree built", ctx)
-	leafs, err := processLeafParallel(encoded, backend)
+	span := core.StartSpan("Merkle tree built", parentSpan)
+	merkleBackend := backend.Scoped()
+	hashes, err := processLeafParallel(ctx, encoded, c.Segments(backend.params), merkleBackend)
+	merkleBackend.Ops().Attributes(span)
 	if err != nil {
+		span.End()
+		encoded.Close()
 		return nil, nil, err
 	}
 
 	// TODO: Merkle tree with leafs -- inner prouducts of columns and some random vector, cheaper?
-	tree, err := core.NewTree(leafs)
+	tree, err := core.NewTreeFromLeafHashes(hashes)
 	if err != nil {
+		encoded.Close()
 		return nil, nil, err
 	}
 	span.End()
@@ -123,86 +195,110 @@ func (c *LigeroCommitter) Commit(matrix []*rlwe.Ciphertext, backend *ServerBFV,
 	}, tree.MerkleRoot(), nil
 }
 
-func processLeafParallel(encoded []*rlwe.Ciphertext, backend *ServerBFV) ([]core.Leaf, error) {
-	type leafResult struct {
-		index int
-		leaf  core.Leaf
-		err   error
-	}
-
-	leafs := make([]core.Leaf, len(encoded))
-	resultChan := make(chan leafResult, len(encoded))
-
-	numWorkers := determineOptimalWorkers(len(encoded))
-	workChan := make(chan int, len(encoded))
-
-	var wg sync.WaitGroup
-	for w := 0; w < numWorkers; w++ {
-		wg.Add(1)
+// processLeafParallel hashes every encoded column, with its segments switched down to level 1, into a leaf hash.
+// Only the leaves being hashed are held in memory.
+func processLeafParallel(ctx context.Context, encoded CiphertextStore, segments int, backend *ServerBFV) ([][]byte, error) {
+	extCols := encoded.Len() / segments
+	return ParallelMap(ctx, extCols, func() func(int) ([]byte, error) {
 		backend := backend.CopyNew()
-		go func() {
-			defer wg.Done()
-			for i := range workChan {
-				ct := encoded[i].CopyNew()
+		return func(i int) ([]byte, error) {
+			leaf := make(columnLeaf, segments)
+			for s := range segments {
+				ct, err := encoded.Load(s*extCols + i)
+				if err != nil {
+					return nil, err
+				}
+				ct = ct.CopyNew()
 
 				// Mod switch
 				for ct.Level() > 1 {
 					if err := backend.Rescale(ct, ct); err != nil {
-						resultChan <- leafResult{index: i, err: err}
-						return
+						return nil, err
 					}
 				}
-
-				buf := bytes.NewBuffer(nil)
-				ct.WriteTo(buf)
-
-				resultChan <- leafResult{index: i, leaf: buf}
+				leaf[s] = ct
 			}
-		}()
-	}
 
-	for i := range encoded {
-		workChan <- i
-	}
-	close(workChan)
+			return core.LeafHash(leaf)
+		}
+	})
+}
 
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+// columnLeaf is the Merkle leaf of an encoded column: the serialization of its segments in order,
+// as hashed by processLeafParallel.
+type columnLeaf []*rlwe.Ciphertext
 
-	for i := 0; i < len(encoded); i++ {
-		res := <-resultChan
-		if res.err != nil {
-			return nil, res.err
+func (l columnLeaf) WriteTo(w io.Writer) (n int64, err error) {
+	for _, ct := range l {
+		m, err := ct.WriteTo(w)
+		n += m
+		if err != nil {
+			return n, err
 		}
-		leafs[res.index] = res.leaf
 	}
-
-	return leafs, nil
+	return n, nil
 }
 
 type EncryptedProof struct {
-	Metadata    LigeroMetadata
-	MatR        []*rlwe.Ciphertext
-	MatZ        []*rlwe.Ciphertext
+	Metadata LigeroMetadata
+	// MatR and MatZ hold the inner product of each column in slot 0, or of each column of a packed ciphertext at
+	// the start of its window.
+	MatR []*rlwe.Ciphertext
+	MatZ []*rlwe.Ciphertext
+	// QueriedCols holds the segments of each queried column in turn, or the ciphertext it is packed in.
 	QueriedCols []*rlwe.Ciphertext
 	MerklePaths []core.MerklePath
 	Root        []byte
 }
 
-func (c *LigeroProver) Prove(point *core.Element, backend *ServerBFV, transcript *core.Transcript, ctx *core.Span) (*EncryptedProof, error) {
+// Prove homomorphically evaluates the Ligero opening at point.
+// Cancelling ctx stops all workers and aborts the proof.
+func (c *LigeroProver) Prove(ctx context.Context, point *core.Element, backend *ServerBFV, transcript *core.Transcript, parentSpan *core.Span) (*EncryptedProof, error) {
 	cols := c.Committer.Cols
 	rows := c.Committer.Rows
+	segments := c.Committer.Segments(backend.params)
+	packing, window := c.Committer.ColumnsPerCiphertext(), c.Committer.Window()
+	if packing > 1 && backend.RingSwitch() != nil {
+		return nil, fmt.Errorf("%w: ring switching keeps only slot 0 of the inner products", ErrPacking)
+	}
 
 	// don't write root to transcript for compatability with LigeroProveReference
 	// transcript.AppendBytes("root", c.Tree.MerkleRoot())
 
+	// Packed columns are multiplied with the vectors repeated in every window, and their inner products are
+	// masked down to the first slot of each window
+	encodeVector := func(values []uint64) ([]*rlwe.Plaintext, error) {
+		if packing == 1 {
+			return encodeSegments(values, backend)
+		}
+		pt, err := encodeRepeated(values, packing, window, backend)
+		return []*rlwe.Plaintext{pt}, err
+	}
+	sumSlots := min(rows, backend.params.MaxSlots())
+	var firstSlots *rlwe.Plaintext
+	if packing > 1 {
+		sumSlots = window
+		mask, err := encodeRepeated([]uint64{1}, packing, window, backend)
+		if err != nil {
+			return nil, err
+		}
+		firstSlots = mask
+	}
+	if rs := backend.RingSwitch(); rs != nil {
+		// Switching to a ring of degree N' averages every slot with the N/N'-1 slots folded onto it, so the inner
+		// product is kept alone in slot 0 and scaled by N/N' for the switched ciphertext to decrypt to it
+		mask, err := encodeRepeated([]uint64{uint64(backend.params.N() / rs.paramsNew.N())}, 1, 1, backend)
+		if err != nil {
+			return nil, err
+		}
+		firstSlots = mask
+	}
+
 	// Encode r vector
 	r := make([]uint64, rows)
 	transcript.SampleUints("r", r)
-	rPt := bgv.NewPlaintext(backend.params, backend.params.MaxLevel())
-	if err := backend.Encode(r, rPt); err != nil {
+	rPts, err := encodeVector(r)
+	if err != nil {
 		return nil, err
 	}
 
@@ -215,69 +311,61 @@ func (c *LigeroProver) Prove(point *core.Element, backend *ServerBFV, transcript
 		backend.Field().MulAssign(powB, zPow, powB)
 	}
 
-	bPt := bgv.NewPlaintext(backend.params, backend.params.MaxLevel())
-	if err := backend.Encode(b, bPt); err != nil {
+	bPts, err := encodeVector(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
 	// Run Matrix R and Matrix Z operations concurrently
-	matrixRSpan := core.StartSpan("InnerProduct(Matrix, r)", ctx)
-	matrixZSpan := core.StartSpan("InnerProduct(Matrix, b)", ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	matrixRSpan := core.StartSpan("InnerProduct(Matrix, r)", parentSpan)
+	matrixZSpan := core.StartSpan("InnerProduct(Matrix, b)", parentSpan)
 
 	matRChan := make(chan matrixOperationResult, 1)
 	matZChan := make(chan matrixOperationResult, 1)
 
 	// Matrix R operations
 	go func() {
-		result := matrixInnerSumEval(c.Matrix, rPt, c.Committer.Rows, backend.CopyNew(), matrixRSpan)
+		result := matrixInnerSumEval(ctx, c.Matrix, rPts, sumSlots, firstSlots, backend.Scoped(), matrixRSpan)
 		matrixRSpan.End()
 		matRChan <- result
 	}()
 
 	// Matrix Z operations
 	go func() {
-		result := matrixInnerSumEval(c.Matrix, bPt, c.Committer.Rows, backend.CopyNew(), matrixZSpan)
+		result := matrixInnerSumEval(ctx, c.Matrix, bPts, sumSlots, firstSlots, backend.Scoped(), matrixZSpan)
 		matrixZSpan.End()
 		matZChan <- result
 	}()
 
-	// Collect results
-	matRResult := <-matRChan
-	if matRResult.err != nil {
-		matrixRSpan.End()
-		return nil, matRResult.err
-	}
-
-	matZResult := <-matZChan
-	if matZResult.err != nil {
-		return nil, matZResult.err
+	// Collect results, the first failure cancels the other evaluation
+	var matR, matZ []*rlwe.Ciphertext
+	for range 2 {
+		var result matrixOperationResult
+		select {
+		case result = <-matRChan:
+			matR = result.matrix
+		case result = <-matZChan:
+			matZ = result.matrix
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
 	}
 
-	matR := matRResult.matrix
-	matZ := matZResult.matrix
-
 	transcript.AppendField("point", point)
 
 	// Query operations
-	querySpan := core.StartSpan("Query columns", ctx)
-	queriedCols := make([]*rlwe.Ciphertext, c.Committer.Queries)
-	merklePaths := make([]core.MerklePath, c.Committer.Queries)
-	extCols := c.Committer.Cols * c.Committer.RhoInv
-	queryIndices := sampleQueryIndices(transcript, c.Committer.Queries, extCols)
-
-	for i, queryColIdx := range queryIndices {
-		queriedCols[i] = c.EncodedMatrix[queryColIdx]
-		// Mod switch
-		for queriedCols[i].Level() > 1 {
-			backend.Rescale(queriedCols[i], queriedCols[i])
-		}
-		var err error
-		merklePaths[i], err = c.Tree.GetMerklePath(uint(queryColIdx))
-		if err != nil {
-			return nil, err
-		}
+	queriedCols, merklePaths, err := c.queryColumns(ctx, transcript, segments, packing, backend, parentSpan)
+	if err != nil {
+		return nil, err
 	}
-	querySpan.End()
 	proof := &EncryptedProof{
 		Metadata:    c.Committer.LigeroMetadata,
 		Root:        c.Tree.MerkleRoot(),
@@ -290,123 +378,213 @@ func (c *LigeroProver) Prove(point *core.Element, backend *ServerBFV, transcript
 	return proof, nil
 }
 
+// queryColumns samples the query indices from the transcript and loads the queried columns of every segment with their Merkle paths.
+func (c *LigeroProver) queryColumns(ctx context.Context, transcript *core.Transcript, segments, packing int, backend *ServerBFV, parentSpan *core.Span) ([]*rlwe.Ciphertext, []core.MerklePath, error) {
+	querySpan := core.StartSpan("Query columns", parentSpan)
+	defer querySpan.End()
+	queryBackend := backend.Scoped()
+	defer queryBackend.Ops().Attributes(querySpan)
+	queriedCols := make([]*rlwe.Ciphertext, c.Committer.Queries*segments)
+	merklePaths := make([]core.MerklePath, c.Committer.Queries)
+	extCols := c.Committer.Cols * c.Committer.RhoInv
+	queryIndices := sampleQueryIndices(transcript, c.Committer.Queries, extCols)
+	leaves := extCols / packing
+
+	for i, queryColIdx := range queryIndices {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		leafIdx := queryColIdx / packing
+		for s := range segments {
+			ct, err := c.EncodedMatrix.Load(s*leaves + leafIdx)
+			if err != nil {
+				return nil, nil, err
+			}
+			ct = ct.CopyNew()
+			// Mod switch
+			for ct.Level() > 1 {
+				if err := queryBackend.Rescale(ct, ct); err != nil {
+					return nil, nil, err
+				}
+			}
+			queriedCols[i*segments+s] = ct
+		}
+		var err error
+		merklePaths[i], err = c.Tree.GetMerklePath(uint(leafIdx))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return queriedCols, merklePaths, nil
+}
+
 // matrixOperationResult holds the result of a matrix operation
 type matrixOperationResult struct {
 	matrix []*rlwe.Ciphertext
 	err    error
 }
 
-func matrixInnerSumEval(matrix []*rlwe.Ciphertext, plaintext *rlwe.Plaintext, rows int, backend *ServerBFV, span *core.Span) matrixOperationResult {
-	result := make([]*rlwe.Ciphertext, len(matrix))
-	type matrixElementResult struct {
-		index int
-		col   *rlwe.Ciphertext
-		err   error
+// encodeSegments batch encodes values into one plaintext per segment of rows, in the layout of the matrix.
+func encodeSegments(values []uint64, backend *ServerBFV) ([]*rlwe.Plaintext, error) {
+	slots := backend.params.MaxSlots()
+	plaintexts := make([]*rlwe.Plaintext, segments(len(values), slots))
+	for s := range plaintexts {
+		plaintexts[s] = bgv.NewPlaintext(backend.params, backend.params.MaxLevel())
+		if err := backend.Encode(values[s*slots:min((s+1)*slots, len(values))], plaintexts[s]); err != nil {
+			return nil, err
+		}
 	}
-	resultChan := make(chan matrixElementResult, len(matrix))
+	return plaintexts, nil
+}
 
-	numWorkers := determineOptimalWorkers(len(matrix))
-	workChan := make(chan int, len(matrix))
+// innerSumSlots sums the first n slots of ct into slot 0. BGV slots form two rows of N/2 that InnerSum does not
+// rotate across, so a sum over more than a row adds up the inner sums of both rows with a row rotation.
+func innerSumSlots(ct *rlwe.Ciphertext, n int, backend *ServerBFV) error {
+	half := backend.params.MaxSlots() / 2
+	if err := backend.InnerSum(ct, 1, min(n, half), ct); err != nil {
+		return err
+	}
+	if n <= half {
+		return nil
+	}
 
-	// Start workers
-	var wg sync.WaitGroup
-	for w := 0; w < numWorkers; w++ {
-		wg.Add(1)
+	rotated, err := backend.RotateRowsNew(ct)
+	if err != nil {
+		return err
+	}
+	return backend.Add(ct, rotated, ct)
+}
+
+// matrixInnerSumEval computes the inner product of every column with the vector encoded in plaintexts, one per
+// segment, summing n slots. The inner sums of the segments of a column are added up, so that each column yields
+// one ciphertext. If mask is not nil, the sums are multiplied with it, which keeps only the slots holding inner
+// products.
+func matrixInnerSumEval(ctx context.Context, matrix CiphertextStore, plaintexts []*rlwe.Plaintext, n int, mask *rlwe.Plaintext, backend *ServerBFV, span *core.Span) matrixOperationResult {
+	cols := matrix.Len() / len(plaintexts)
+	result, err := ParallelMap(ctx, cols, func() func(int) (*rlwe.Ciphertext, error) {
 		backend := backend.CopyNew()
-		go func() {
-			defer wg.Done()
-			for i := range workChan {
-				col, err := backend.MulNew(matrix[i], plaintext)
+		return func(i int) (*rlwe.Ciphertext, error) {
+			var col *rlwe.Ciphertext
+			for s, plaintext := range plaintexts {
+				ct, err := matrix.Load(s*cols + i)
 				if err != nil {
-					resultChan <- matrixElementResult{index: i, err: err}
-					continue
+					return nil, err
 				}
-
-				if err := backend.InnerSum(col, 1, rows, col); err != nil {
-					resultChan <- matrixElementResult{index: i, err: err}
-					continue
+				segment, err := backend.MulNew(ct, plaintext)
+				if err != nil {
+					return nil, err
 				}
 
-				// Mod switch
-				for col.Level() > 1 {
-					backend.Rescale(col, col)
+				if err := innerSumSlots(segment, n, backend); err != nil {
+					return nil, err
 				}
 
-				// TODO: ring switch to discard garbage slots
-				if backend.RingSwitch() != nil {
-					col, err = backend.RingSwitch().RingSwitchNew(col, backend)
-					if err != nil {
-						resultChan <- matrixElementResult{index: i, err: err}
-						continue
-					}
+				if col == nil {
+					col = segment
+				} else if err := backend.Add(col, segment, col); err != nil {
+					return nil, err
 				}
+			}
 
-				resultChan <- matrixElementResult{index: i, col: col}
+			if mask != nil {
+				if err := backend.Mul(col, mask, col); err != nil {
+					return nil, err
+				}
 			}
-		}()
-	}
 
-	for i := range matrix {
-		workChan <- i
-	}
-	close(workChan)
+			// Mod switch
+			for col.Level() > 1 {
+				if err := backend.Rescale(col, col); err != nil {
+					return nil, err
+				}
+			}
 
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+			// TODO: ring switch to discard garbage slots
+			if backend.RingSwitch() != nil {
+				switched, err := backend.RingSwitch().RingSwitchNew(col, backend)
+				if err != nil {
+					return nil, err
+				}
+				col = switched
+			}
 
-	for res := range resultChan {
-		if res.err != nil {
-			span.End()
-			return matrixOperationResult{nil, res.err}
+			return col, nil
 		}
-		result[res.index] = res.col
+	})
+	if err != nil {
+		return matrixOperationResult{nil, err}
 	}
 
-	// TODO: aggregate multiplication counts
+	backend.Ops().Attributes(span)
 
 	return matrixOperationResult{result, nil}
 }
 
 type Proof struct {
-	Metadata    LigeroMetadata
-	Root        []byte
-	MatR        []*core.Element
-	MatZ        []*core.Element
-	QueriedCols []*vdec.ColumnInstance
+	Metadata LigeroMetadata
+	Root     []byte
+	MatR     []*core.Element
+	MatZ     []*core.Element
+	// QueriedCols holds the segments of each queried column in turn, as EncryptedProof.QueriedCols. Every segment
+	// of a column spread over several ciphertexts holds all their slots, the last one zero padded past the last row.
+	QueriedCols []*batching.ColumnInstance
 	MerklePaths []core.MerklePath
+
+	// MatRCts and MatZCts are the inner product ciphertexts MatR and MatZ are decrypted from (slot 0 of each, or
+	// the first slot of each window if packed). They are ring switched if the client requested it, and must match
+	// the server's EncryptedProof.
+	MatRCts []*rlwe.Ciphertext
+	MatZCts []*rlwe.Ciphertext
+
+	// DecryptionProof is the serialized proof of correct decryption of QueriedCols, set by ProveDecrypt.
+	DecryptionProof []byte
+	// InnerProductsDecryptionProof is the serialized proof of correct decryption of MatR and MatZ, set by ProveDecrypt.
+	InnerProductsDecryptionProof []byte
 }
 
-func (p EncryptedProof) Decrypt(client *ClientBFV, ctx *core.Span) (*Proof, error) {
+// Decrypt decrypts the encrypted proof. Cancelling ctx stops all workers and aborts the decryption.
+func (p EncryptedProof) Decrypt(ctx context.Context, client *ClientBFV, parentSpan *core.Span) (*Proof, error) {
 	rows := p.Metadata.Rows
+	slots := client.paramsFHE.MaxSlots()
+	segments := p.Metadata.Segments(client.paramsFHE)
+	packing, window := p.Metadata.ColumnsPerCiphertext(), p.Metadata.Window()
+	// A packed ciphertext is decrypted up to the last row of its last window
+	colSlots := min(rows, slots)
+	if packing > 1 {
+		colSlots = (packing-1)*window + rows
+	}
+	if len(p.QueriedCols) != p.Metadata.Queries*segments {
+		return nil, fmt.Errorf("%w: expected %d queried column segments, got %d", ErrMalformedProof, p.Metadata.Queries*segments, len(p.QueriedCols))
+	}
 
 	// Decrypt queried columns
-	span := core.StartSpan("Decrypt queried columns", ctx)
+	span := core.StartSpan("Decrypt queried columns", parentSpan)
 	queriedColsResult, err := decryptBatchedParallel(
+		ctx,
 		p.QueriedCols,
 		client,
 		func(encoder *bgv.Encoder, pt *rlwe.Plaintext) ([]*core.Element, error) {
-			column := make([]uint64, rows)
+			column := make([]uint64, colSlots)
 			if err := encoder.Decode(pt, column); err != nil {
 				return nil, err
 			}
 
-			result := make([]*core.Element, rows)
+			result := make([]*core.Element, len(column))
 			for i := range column {
 				result[i] = core.NewElement(column[i])
 			}
 			return result, nil
 		},
-		span,
 	)
 	if err != nil {
 		span.End()
 		return nil, err
 	}
-	queriedColsPairs := make([]*vdec.ColumnInstance, len(p.QueriedCols))
+	// Segments keep all their decrypted slots, so that they can be batched together: the last one is zero past the
+	// remaining rows
+	queriedColsPairs := make([]*batching.ColumnInstance, len(p.QueriedCols))
 	for i := range p.QueriedCols {
-		queriedColsPairs[i] = &vdec.ColumnInstance{
+		queriedColsPairs[i] = &batching.ColumnInstance{
 			Ct:     p.QueriedCols[i],
 			Values: queriedColsResult[i],
 		}
@@ -414,106 +592,177 @@ func (p EncryptedProof) Decrypt(client *ClientBFV, ctx *core.Span) (*Proof, erro
 	span.End()
 
 	// Decrypt row inner products concurrently
-	span = core.StartSpan("Decrypt row inner products", ctx)
-
-	matRChan := make(chan struct {
-		matR []*core.Element
-		err  error
-	}, 1)
-	matZChan := make(chan struct {
-		matZ []*core.Element
-		err  error
-	}, 1)
-
-	decodeSingleElement := func(encoder *bgv.Encoder, pt *rlwe.Plaintext) (*core.Element, error) {
-		column := make([]uint64, 1)
+	span = core.StartSpan("Decrypt row inner products", parentSpan)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type decryptionResult struct {
+		values []*core.Element
+		err    error
+	}
+	matRChan := make(chan decryptionResult, 1)
+	matZChan := make(chan decryptionResult, 1)
+
+	decodeInnerProducts := func(encoder *bgv.Encoder, pt *rlwe.Plaintext) ([]*core.Element, error) {
+		column := make([]uint64, (packing-1)*window+1)
 		if err := encoder.Decode(pt, column); err != nil {
 			return nil, err
 		}
-		return core.NewElement(column[0]), nil
-	}
-
-	// Concurrent decryption of MatR and MatZ
-	go func() {
-		useClient := client.CopyNew()
-		if client.RingSwitch() != nil {
-			useClient = client.RingSwitch().NewClient(client)
+		values := make([]*core.Element, packing)
+		for c := range values {
+			values[c] = core.NewElement(column[c*window])
 		}
+		return values, nil
+	}
 
-		matR, err := decryptBatchedParallel(
-			p.MatR,
-			useClient,
-			func(encoder *bgv.Encoder, pt *rlwe.Plaintext) (*core.Element, error) {
-				return decodeSingleElement(encoder, pt)
-			},
-			span,
-		)
-		matRChan <- struct {
-			matR []*core.Element
-			err  error
-		}{matR, err}
-	}()
-
-	go func() {
+	decryptInnerProducts := func(cts []*rlwe.Ciphertext, resultChan chan<- decryptionResult) {
 		useClient := client.CopyNew()
 		if client.RingSwitch() != nil {
 			useClient = client.RingSwitch().NewClient(client)
 		}
 
-		matZ, err := decryptBatchedParallel(
-			p.MatZ,
-			useClient,
-			func(encoder *bgv.Encoder, pt *rlwe.Plaintext) (*core.Element, error) {
-				return decodeSingleElement(encoder, pt)
-			},
-			span,
-		)
-		matZChan <- struct {
-			matZ []*core.Element
-			err  error
-		}{matZ, err}
-	}()
-
-	matRResult := <-matRChan
-	if matRResult.err != nil {
-		span.End()
-		return nil, matRResult.err
+		values, err := decryptBatchedParallel(ctx, cts, useClient, decodeInnerProducts)
+		resultChan <- decryptionResult{slices.Concat(values...), err}
 	}
 
-	matZResult := <-matZChan
-	if matZResult.err != nil {
-		span.End()
-		return nil, matZResult.err
+	// Concurrent decryption of MatR and MatZ
+	go decryptInnerProducts(p.MatR, matRChan)
+	go decryptInnerProducts(p.MatZ, matZChan)
+
+	// The first failure cancels the other decryption
+	var matR, matZ []*core.Element
+	for range 2 {
+		var result decryptionResult
+		select {
+		case result = <-matRChan:
+			matR = result.values
+		case result = <-matZChan:
+			matZ = result.values
+		}
+		if result.err != nil {
+			span.End()
+			return nil, result.err
+		}
 	}
 
 	span.End()
-	ctx.EndWithNewline()
+	parentSpan.EndWithNewline()
 
 	proof := &Proof{
 		Metadata:    p.Metadata,
 		Root:        p.Root,
-		MatR:        matRResult.matR,
-		MatZ:        matZResult.matZ,
+		MatR:        matR,
+		MatZ:        matZ,
 		QueriedCols: queriedColsPairs,
 		MerklePaths: p.MerklePaths,
+		MatRCts:     p.MatR,
+		MatZCts:     p.MatZ,
 	}
 
 	return proof, nil
 }
 
-func (p *Proof) ProveDecrypt(client *ClientBFV, ctx *core.Span, isGBFV ...bool) error {
-	span := core.StartSpan("Verifiable decrypt", nil, "Verifiable decrypt...")
-	transcript := core.NewTranscript("vdec")
+// ProveDecrypt proves that the queried columns and the row inner products are the decryptions of their ciphertexts
+// under scheme and stores the proofs in p. Each instance is reduced to batches random linear combinations
+// (see vdec.DefaultBatches). Ring switched inner products are proven under the ring switched secret key.
+func (p *Proof) ProveDecrypt(client *ClientBFV, scheme vdec.Scheme, batches int, parentSpan *core.Span) error {
+	span := core.StartSpan("Verifiable decrypt", parentSpan, "Verifiable decrypt...")
+	defer span.End()
+	transcript := p.decryptTranscript()
 
-	err := vdec.ProveBfvDecBatched(p.QueriedCols, client.SecretKey(), client.Evaluator, client.Field(), transcript, span, isGBFV...)
+	proof, err := vdec.ProveBfvDecBatched(p.QueriedCols, client.SecretKey(), client.Evaluator, client.Field(), transcript, scheme, batches, span)
 	if err != nil {
-		span.End()
-		panic(err)
+		return err
 	}
-	span.End()
+
+	innerProducts, err := p.innerProductsInstance()
+	if err != nil {
+		return err
+	}
+	innerClient := client
+	if client.RingSwitch() != nil {
+		innerClient = client.RingSwitch().NewClient(client)
+	}
+	innerProof, err := vdec.ProveBfvDecBatched(innerProducts, innerClient.SecretKey(), innerClient.Evaluator, client.Field(), transcript, scheme, batches, span)
+	if err != nil {
+		return err
+	}
+
+	p.DecryptionProof = proof
+	p.InnerProductsDecryptionProof = innerProof
 	return nil
 }
 
+// VerifyDecrypt checks the proofs of correct decryption of the queried columns and the row inner products,
+// each made under scheme with batches random linear combinations.
+// The parameters of ring switched inner products are derived from params and the ring degree of their ciphertexts.
+func (p *Proof) VerifyDecrypt(params bgv.Parameters, field *core.PrimeField, scheme vdec.Scheme, batches int) error {
+	if p.DecryptionProof == nil || p.InnerProductsDecryptionProof == nil {
+		return ErrMissingDecryptionProof
+	}
+	transcript := p.decryptTranscript()
+
+	if err := vdec.VerifyBfvDecBatched(p.DecryptionProof, p.QueriedCols, params, field, transcript, scheme, batches); err != nil {
+		return err
+	}
+
+	innerProducts, err := p.innerProductsInstance()
+	if err != nil {
+		return err
+	}
+	innerParams := params
+	if n := innerProducts[0].Ct.Value[0].N(); n != params.N() {
+		innerParams, err = bgv.NewParametersFromLiteral(RingSwitchParametersLiteral(params, bits.Len(uint(n))-1))
+		if err != nil {
+			return err
+		}
+	}
+
+	return vdec.VerifyBfvDecBatched(p.InnerProductsDecryptionProof, innerProducts, innerParams, field, transcript, scheme, batches)
+}
+
+// innerProductsInstance pairs the MatR and MatZ ciphertexts with their decrypted values, which are in slot 0.
+// Packed inner products are at the start of each window and the slots between them are masked to zero.
+func (p *Proof) innerProductsInstance() ([]*batching.ColumnInstance, error) {
+	packing, window := p.Metadata.ColumnsPerCiphertext(), p.Metadata.Window()
+	if len(p.MatRCts)*packing != len(p.MatR) || len(p.MatZCts)*packing != len(p.MatZ) || len(p.MatRCts) == 0 {
+		return nil, fmt.Errorf("%w: %d and %d inner product ciphertexts for %d and %d values", ErrMalformedProof, len(p.MatRCts), len(p.MatZCts), len(p.MatR), len(p.MatZ))
+	}
+
+	instance := make([]*batching.ColumnInstance, 0, len(p.MatRCts)+len(p.MatZCts))
+	for _, mat := range []struct {
+		cts    []*rlwe.Ciphertext
+		values []*core.Element
+	}{{p.MatRCts, p.MatR}, {p.MatZCts, p.MatZ}} {
+		for i, ct := range mat.cts {
+			values := make([]*core.Element, (packing-1)*window+1)
+			for j := range values {
+				values[j] = core.Zero()
+			}
+			for c := range packing {
+				values[c*window] = mat.values[i*packing+c]
+			}
+			instance = append(instance, &batching.ColumnInstance{Ct: ct, Values: values})
+		}
+	}
+	return instance, nil
+}
+
+// decryptTranscript returns the transcript of the decryption proof, bound to the commitment root and to the
+// inner product ciphertexts.
+func (p *Proof) decryptTranscript() *core.Transcript {
+	transcript := core.NewTranscript("vdec")
+	transcript.AppendBytes("root", p.Root)
+	for _, ct := range p.MatRCts {
+		transcript.AppendCiphertext("mat_r", ct)
+	}
+	for _, ct := range p.MatZCts {
+		transcript.AppendCiphertext("mat_z", ct)
+	}
+	return transcript
+}
+
 func (p *Proof) Verify(point *core.Element, value *core.Element, field *core.PrimeField, transcript *core.Transcript) error {
 	rows := p.Metadata.Rows
 	cols := p.Metadata.Cols
@@ -522,9 +771,24 @@ func (p *Proof) Verify(point *core.Element, value *core.Element, field *core.Pri
 	r := make([]*core.Element, rows)
 	transcript.SampleFields("r", r)
 
+	if len(p.MatR) != cols || len(p.MatZ) != cols {
+		return fmt.Errorf("%w: expected %d inner products, got %d and %d", ErrMalformedProof, cols, len(p.MatR), len(p.MatZ))
+	}
+	if len(p.QueriedCols) == 0 || len(p.QueriedCols)%p.Metadata.Queries != 0 || len(p.MerklePaths) != p.Metadata.Queries {
+		return fmt.Errorf("%w: expected %d queried columns, got %d column segments and %d paths", ErrMalformedProof, p.Metadata.Queries, len(p.QueriedCols), len(p.MerklePaths))
+	}
+	segments := len(p.QueriedCols) / p.Metadata.Queries
+	packing, window := p.Metadata.ColumnsPerCiphertext(), p.Metadata.Window()
+
 	// Encode row inner products
-	encodedMatR := core.Encode(p.MatR, p.Metadata.RhoInv, field)
-	encodedMatZ := core.Encode(p.MatZ, p.Metadata.RhoInv, field)
+	encodedMatR, err := core.Encode(p.MatR, p.Metadata.RhoInv, field)
+	if err != nil {
+		return err
+	}
+	encodedMatZ, err := core.Encode(p.MatZ, p.Metadata.RhoInv, field)
+	if err != nil {
+		return err
+	}
 
 	transcript.AppendField("point", point)
 
@@ -540,7 +804,7 @@ func (p *Proof) Verify(point *core.Element, value *core.Element, field *core.Pri
 	b := make([]*core.Element, rows)
 	zPow := field.Pow(uint64(cols), point)
 	if zPow.NotEqual(powA) {
-		panic("zPow is not equal to powA")
+		return fmt.Errorf("%w: z^cols does not match the last power of a", ErrMalformedProof)
 	}
 	powB := core.One()
 	for i := range b {
@@ -552,22 +816,50 @@ func (p *Proof) Verify(point *core.Element, value *core.Element, field *core.Pri
 	queryIndices := sampleQueryIndices(transcript, p.Metadata.Queries, extCols)
 
 	for i, queryColIdx := range queryIndices {
-		if ok, err := core.VerifyMerklePath(p.QueriedCols[i].Ct, p.MerklePaths[i], root, uint(queryColIdx)); err != nil || !ok {
-			return fmt.Errorf("failed to verify merkle path for column %d", queryColIdx)
+		leaf := make(columnLeaf, segments)
+		var values []*core.Element
+		for s, segment := range p.QueriedCols[i*segments : (i+1)*segments] {
+			leaf[s] = segment.Ct
+			values = append(values, segment.Values...)
+		}
+		if ok, err := core.VerifyMerklePath(leaf, p.MerklePaths[i], root, uint(queryColIdx/packing)); err != nil || !ok {
+			return fmt.Errorf("%w: column %d", core.ErrMerklePathInvalid, queryColIdx)
+		}
+		if packing > 1 {
+			// The leaf opens every column packed with the queried one
+			offset := (queryColIdx % packing) * window
+			if len(values) < offset+rows {
+				return fmt.Errorf("%w: column %d has %d packed values, expected at least %d", ErrMalformedProof, queryColIdx, len(values), offset+rows)
+			}
+			values = values[offset : offset+rows]
+		} else if len(values) >= rows {
+			// Drop the padding of the last segment
+			values = values[:rows]
 		}
 
-		if core.InnerProduct(p.QueriedCols[i].Values, r, field).NotEqual(encodedMatR[queryColIdx]) {
-			fmt.Println("well-formedness R check failed for column expected", encodedMatR[queryColIdx], "got", core.InnerProduct(p.QueriedCols[i].Values, r, field))
-			return fmt.Errorf("well-formedness R check failed for column %d", queryColIdx)
+		rCheck, err := core.InnerProduct(values, r, field)
+		if err != nil {
+			return fmt.Errorf("%w: column %d: %w", ErrMalformedProof, queryColIdx, err)
+		}
+		if rCheck.NotEqual(encodedMatR[queryColIdx]) {
+			return fmt.Errorf("%w: R check for column %d", ErrWellFormedness, queryColIdx)
 		}
 
-		if core.InnerProduct(p.QueriedCols[i].Values, b, field).NotEqual(encodedMatZ[queryColIdx]) {
-			return fmt.Errorf("well-formedness B check failed for column %d", queryColIdx)
+		bCheck, err := core.InnerProduct(values, b, field)
+		if err != nil {
+			return fmt.Errorf("%w: column %d: %w", ErrMalformedProof, queryColIdx, err)
+		}
+		if bCheck.NotEqual(encodedMatZ[queryColIdx]) {
+			return fmt.Errorf("%w: B check for column %d", ErrWellFormedness, queryColIdx)
 		}
 	}
 
-	if core.InnerProduct(p.MatZ, a, field).NotEqual(value) {
-		return fmt.Errorf(" claimed value does not match the evaluation of the committed polynomial")
+	eval, err := core.InnerProduct(p.MatZ, a, field)
+	if err != nil {
+		return err
+	}
+	if eval.NotEqual(value) {
+		return ErrValueMismatch
 	}
 
 	return nil
@@ -575,64 +867,18 @@ func (p *Proof) Verify(point *core.Element, value *core.Element, field *core.Pri
 
 // decryptBatchedParallel decrypts ciphertexts in parallel using the provided decoder function
 func decryptBatchedParallel[T any](
+	ctx context.Context,
 	matrix []*rlwe.Ciphertext,
 	client *ClientBFV,
 	decoder func(*bgv.Encoder, *rlwe.Plaintext) (T, error),
-	span *core.Span,
 ) ([]T, error) {
-	type decryptionResult[T any] struct {
-		index int
-		value T
-		err   error
-	}
-
-	result := make([]T, len(matrix))
-	resultChan := make(chan decryptionResult[T], len(matrix))
-
-	numWorkers := determineOptimalWorkers(len(matrix))
-	workChan := make(chan int, len(matrix))
-
-	var wg sync.WaitGroup
-	for w := 0; w < numWorkers; w++ {
-		wg.Add(1)
+	return ParallelMap(ctx, len(matrix), func() func(int) (T, error) {
 		client := client.CopyNew()
-		go func() {
-			defer wg.Done()
-			for i := range workChan {
-				pt := client.DecryptNew(matrix[i])
-				value, err := decoder(client.Encoder, pt)
-				if err != nil {
-					resultChan <- decryptionResult[T]{index: i, err: err}
-					continue
-				}
-
-				resultChan <- decryptionResult[T]{
-					index: i,
-					value: value,
-				}
-			}
-		}()
-	}
-
-	for i := range matrix {
-		workChan <- i
-	}
-	close(workChan)
-
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	for res := range resultChan {
-		if res.err != nil {
-			span.End()
-			return nil, res.err
+		return func(i int) (T, error) {
+			pt := client.DecryptNew(matrix[i])
+			return decoder(client.Encoder, pt)
 		}
-		result[res.index] = res.value
-	}
-
-	return result, nil
+	})
 }
 
 func sampleQueryIndices(transcript *core.Transcript, queries int, extCols int) []int {
@@ -709,7 +955,8 @@ func (p *EncryptedProof) ReadFrom(buf *bytes.Buffer, params *bgv.Parameters) err
 		return err
 	}
 
-	p.MatR = make([]*rlwe.Ciphertext, p.Metadata.Cols)
+	innerProducts := p.Metadata.Cols / p.Metadata.ColumnsPerCiphertext()
+	p.MatR = make([]*rlwe.Ciphertext, innerProducts)
 	for i := range p.MatR {
 		p.MatR[i] = rlwe.NewCiphertext(params, params.MaxLevel())
 		if _, err := p.MatR[i].ReadFrom(buf); err != nil {
@@ -717,7 +964,7 @@ func (p *EncryptedProof) ReadFrom(buf *bytes.Buffer, params *bgv.Parameters) err
 		}
 	}
 
-	p.MatZ = make([]*rlwe.Ciphertext, p.Metadata.Cols)
+	p.MatZ = make([]*rlwe.Ciphertext, innerProducts)
 	for i := range p.MatZ {
 		p.MatZ[i] = rlwe.NewCiphertext(params, params.MaxLevel())
 		if _, err := p.MatZ[i].ReadFrom(buf); err != nil {
@@ -725,7 +972,7 @@ func (p *EncryptedProof) ReadFrom(buf *bytes.Buffer, params *bgv.Parameters) err
 		}
 	}
 
-	p.QueriedCols = make([]*rlwe.Ciphertext, p.Metadata.Queries)
+	p.QueriedCols = make([]*rlwe.Ciphertext, p.Metadata.Queries*p.Metadata.Segments(*params))
 	for i := range p.QueriedCols {
 		p.QueriedCols[i] = rlwe.NewCiphertext(params, params.MaxLevel())
 		if _, err := p.QueriedCols[i].ReadFrom(buf); err != nil {
@@ -734,7 +981,7 @@ func (p *EncryptedProof) ReadFrom(buf *bytes.Buffer, params *bgv.Parameters) err
 	}
 
 	p.MerklePaths = make([]core.MerklePath, p.Metadata.Queries)
-	merkleLen := (p.Metadata.Cols * p.Metadata.RhoInv)
+	merkleLen := p.Metadata.Cols * p.Metadata.RhoInv / p.Metadata.ColumnsPerCiphertext()
 	nextPow2 := 1 << (64 - bits.LeadingZeros64(uint64(merkleLen-1)))
 	merkleDepth := int(math.Log2(float64(nextPow2)))
 	for i := range p.MerklePaths {
@@ -757,45 +1004,29 @@ func (p *LigeroMetadata) WriteTo(buf *bytes.Buffer) error {
 	binary.Write(buf, binary.LittleEndian, uint32(p.Cols))
 	binary.Write(buf, binary.LittleEndian, uint8(p.RhoInv))
 	binary.Write(buf, binary.LittleEndian, uint16(p.Queries))
+	binary.Write(buf, binary.LittleEndian, uint8(p.Packing))
 	return nil
 }
 
 func (p *LigeroMetadata) ReadFrom(buf *bytes.Buffer) error {
 	var rows, cols uint32
-	var rhoInv uint8
+	var rhoInv, packing uint8
 	var queries uint16
 
 	binary.Read(buf, binary.LittleEndian, &rows)
 	binary.Read(buf, binary.LittleEndian, &cols)
 	binary.Read(buf, binary.LittleEndian, &rhoInv)
 	binary.Read(buf, binary.LittleEndian, &queries)
+	binary.Read(buf, binary.LittleEndian, &packing)
 
 	p.Rows = int(rows)
 	p.Cols = int(cols)
 	p.RhoInv = int(rhoInv)
 	p.Queries = int(queries)
+	p.Packing = int(packing)
 	return nil
 }
 
-// determineOptimalWorkers calculates the optimal number of workers based on system resources and workload
-func determineOptimalWorkers(matrixSize int) int {
-	numCPU := runtime.NumCPU()
-
-	// For small matrices, use fewer workers to avoid overhead
-	if matrixSize < numCPU {
-		return matrixSize
-	}
-
-	// For medium matrices, use number of CPU cores
-	if matrixSize <= numCPU*4 {
-		return numCPU
-	}
-
-	// For large matrices, use more workers but cap at 2x CPU cores
-	// to avoid excessive context switching
-	return min(numCPU*2, matrixSize)
-}
-
 func (c *LigeroCommitter) LigeroProveReference(matrix [][]*core.Element, point *core.Element, field *core.PrimeField, transcript *core.Transcript, parentSpan *core.Span) (*Proof, error) {
 	rows := c.Rows
 	cols := c.Cols
@@ -826,8 +1057,8 @@ func (c *LigeroCommitter) LigeroProveReference(matrix [][]*core.Element, point *
 			go func() {
 				defer wg.Done()
 				for i := range workChan {
-					encoded := core.Encode(matrix[i], rhoInv, field)
-					resultChan <- encodingResult{index: i, row: encoded}
+					encoded, err := core.Encode(matrix[i], rhoInv, field)
+					resultChan <- encodingResult{index: i, row: encoded, err: err}
 				}
 			}()
 		}
@@ -923,13 +1154,13 @@ func (c *LigeroCommitter) LigeroProveReference(matrix [][]*core.Element, point *
 	transcript.AppendField("point", point)
 
 	span = core.StartSpan("Query columns", proveSpan)
-	queriedCols := make([]*vdec.ColumnInstance, queries)
+	queriedCols := make([]*batching.ColumnInstance, queries)
 	merklePaths := make([]core.MerklePath, queries)
 	extCols := cols * rhoInv
 	queryIndices := sampleQueryIndices(transcript, queries, extCols)
 
 	for i, queryColIdx := range queryIndices {
-		queriedCols[i] = &vdec.ColumnInstance{
+		queriedCols[i] = &batching.ColumnInstance{
 			Values: encoded[queryColIdx],
 		}
 		var err error
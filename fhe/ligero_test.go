@@ -1,11 +1,19 @@
 package fhe_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"runtime"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/nulltea/lumenos/core"
 	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/vdec"
+	"github.com/nulltea/lumenos/vdec/batching"
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
 )
@@ -33,7 +41,7 @@ func TestLigeroRLC(t *testing.T) {
 	run(t, testLigeroRLC, false)
 }
 
-func run(t *testing.T, test func(bgv.Parameters, *fhe.ServerBFV, *fhe.ClientBFV, *testing.T, bool), vdec bool) {
+func run(t *testing.T, test func(bgv.Parameters, *fhe.ServerBFV, *fhe.ClientBFV, *testing.T, bool), withVdec bool) {
 	paramsLiteral, err := fhe.GenerateBGVParamsForNTT(cols, LogN, Modulus)
 	if err != nil {
 		panic(err)
@@ -64,10 +72,10 @@ func run(t *testing.T, test func(bgv.Parameters, *fhe.ServerBFV, *fhe.ClientBFV,
 	server := fhe.NewBackendBFV(&ptField, params, pk, evk)
 	client := fhe.NewClientBFV(&ptField, params, sk)
 
-	test(params, server, client, t, vdec)
+	test(params, server, client, t, withVdec)
 }
 
-func testLigeroE2E(params bgv.Parameters, s *fhe.ServerBFV, c *fhe.ClientBFV, t *testing.T, vdec bool) {
+func testLigeroE2E(params bgv.Parameters, s *fhe.ServerBFV, c *fhe.ClientBFV, t *testing.T, withVdec bool) {
 	matrix, batchedCols, err := core.RandomMatrixRowMajor(rows, cols, Modulus, func(u []uint64) *rlwe.Plaintext {
 		plaintext := bgv.NewPlaintext(params, params.MaxLevel())
 		if err := c.Encode(u, plaintext); err != nil {
@@ -101,7 +109,7 @@ func testLigeroE2E(params bgv.Parameters, s *fhe.ServerBFV, c *fhe.ClientBFV, t
 	span.End()
 
 	span = core.StartSpan("Commit FHE evaluation", nil, "Commit FHE evaluation...")
-	comm, _, err := ligero.Commit(ciphertexts, s, span)
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), s, span)
 	if err != nil {
 		panic(err)
 	}
@@ -109,7 +117,7 @@ func testLigeroE2E(params bgv.Parameters, s *fhe.ServerBFV, c *fhe.ClientBFV, t
 
 	transcript := core.NewTranscript("test")
 	span = core.StartSpan("Prove FHE evaluation", nil, "Prove FHE evaluation...")
-	encryptedProof, err := comm.Prove(z, s, transcript, span)
+	encryptedProof, err := comm.Prove(context.Background(), z, s, transcript, span)
 	if err != nil {
 		panic(err)
 	}
@@ -131,17 +139,20 @@ func testLigeroE2E(params bgv.Parameters, s *fhe.ServerBFV, c *fhe.ClientBFV, t
 	poly := core.NewDensePolyFromMatrix(matrix)
 	value := poly.Evaluate(s.Field(), z)
 
-	proof, err := encryptedProof.Decrypt(c, span)
+	proof, err := encryptedProof.Decrypt(context.Background(), c, span)
 	if err != nil {
 		panic(err)
 	}
 	span.EndWithNewline()
 
-	if vdec {
-		err = proof.ProveDecrypt(c, span)
+	if withVdec {
+		err = proof.ProveDecrypt(c, vdec.SchemeBFV, vdec.DefaultBatches, span)
 		if err != nil {
 			panic(err)
 		}
+		if err := proof.VerifyDecrypt(params, c.Field(), vdec.SchemeBFV, vdec.DefaultBatches); err != nil {
+			t.Fatal(err)
+		}
 	}
 
 	fmt.Printf("Number of multiplications: %d\n", s.MulCounter())
@@ -201,7 +212,7 @@ func testLigeroRLC(params bgv.Parameters, s *fhe.ServerBFV, c *fhe.ClientBFV, t
 		panic(err)
 	}
 
-	comm, _, err := ligero.Commit(ciphertexts, s, nil)
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), s, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -210,7 +221,7 @@ func testLigeroRLC(params bgv.Parameters, s *fhe.ServerBFV, c *fhe.ClientBFV, t
 
 	transcript := core.NewTranscript("test")
 	span := core.StartSpan("Prove FHE evaluation", nil)
-	result, err := comm.Prove(z, s, transcript, span)
+	result, err := comm.Prove(context.Background(), z, s, transcript, span)
 	if err != nil {
 		panic(err)
 	}
@@ -268,3 +279,588 @@ func ligeroProveReference(matrix [][]*core.Element, field *core.PrimeField, tran
 
 	return rowProducts, nil
 }
+
+func TestLigeroCancel(t *testing.T) {
+	const rows, cols = 16, 8
+	server, _, ciphertexts := setupSmallLigero(t, rows, cols, 1, true, smallLigeroParams(t, cols))
+	ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := ligero.Commit(ctx, fhe.MemoryStore(ciphertexts), server, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Commit returned %v, expected %v", err, context.Canceled)
+	}
+
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transcript := core.NewTranscript("test")
+	if _, err := comm.Prove(ctx, core.NewElement(1), server, transcript, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Prove returned %v, expected %v", err, context.Canceled)
+	}
+
+	assertNoLeakedGoroutines(t, goroutines)
+}
+
+func TestLigeroWorkerError(t *testing.T) {
+	const rows, cols = 16, 8
+	server, _, ciphertexts := setupSmallLigero(t, rows, cols, 1, false, smallLigeroParams(t, cols))
+	ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goroutines := runtime.NumGoroutine()
+
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without Galois keys every InnerSum fails, the first error must abort both inner products.
+	transcript := core.NewTranscript("test")
+	_, err = comm.Prove(context.Background(), core.NewElement(1), server, transcript, nil)
+	if err == nil || errors.Is(err, context.Canceled) {
+		t.Fatalf("Prove returned %v, expected missing Galois key error", err)
+	}
+
+	assertNoLeakedGoroutines(t, goroutines)
+}
+
+func TestLigeroOpCounts(t *testing.T) {
+	const rows, cols = 16, 8
+	server, _, ciphertexts := setupSmallLigero(t, rows, cols, 1, true, smallLigeroParams(t, cols))
+	if ops := server.Ops(); ops.Encrypt != cols || ops.Total() != cols {
+		t.Fatalf("expected %d encryptions, got %+v", cols, ops)
+	}
+	ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector := core.NewMemoryCollector()
+	core.SetSinks(collector)
+	defer core.SetSinks(core.StdoutSink{})
+
+	span := core.StartSpan("Prove job", nil)
+	backend := server.Scoped()
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), backend, span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comm.Prove(context.Background(), core.NewElement(1), backend, core.NewTranscript("test"), span); err != nil {
+		t.Fatal(err)
+	}
+	span.End()
+
+	// Every worker copy counts into the scope of its phase, and the phases into the backend they were scoped from
+	for _, name := range []string{"InnerProduct(Matrix, r)", "InnerProduct(Matrix, b)"} {
+		attrs := collector.Find(name)[0].Attributes
+		if attrs["ops.mul_plain"] != uint64(cols) || attrs["ops.inner_sum"] != uint64(cols) {
+			t.Fatalf("%s: expected %d multiplications and inner sums, got %v", name, cols, attrs)
+		}
+	}
+	if attrs := collector.Find("Encode")[0].Attributes; attrs["ops.add"] == nil || attrs["ops.sub"] == nil || attrs["ops.encrypt"] != uint64(1) {
+		t.Fatalf("unexpected Encode operations: %v", attrs)
+	}
+	ops := backend.Ops()
+	if ops.InnerSum != 2*cols || ops.Encrypt != 1 || ops.Rescale == 0 {
+		t.Fatalf("unexpected total operations: %+v", ops)
+	}
+	if server.Ops().Total() != ops.Total()+cols {
+		t.Fatalf("scoped operations %+v were not counted by the parent %+v", ops, server.Ops())
+	}
+}
+
+func TestLigeroVerifyDecrypt(t *testing.T) {
+	t.Run("plain", func(t *testing.T) { testLigeroVerifyDecrypt(t, 0) })
+	t.Run("ring switched", func(t *testing.T) { testLigeroVerifyDecrypt(t, LogN-1) })
+}
+
+func testLigeroVerifyDecrypt(t *testing.T, ringSwitchLogN int) {
+	const rows, cols = 16, 8
+	// The pure-Go vdec prover needs Δ = q/t to leave room for the decryption noise, hence the smaller plaintext modulus,
+	// and batching needs a spare level to rescale.
+	server, client, ciphertexts := setupSmallLigero(t, rows, cols, 1, true, bgv.ParametersLiteral{
+		LogN:             LogN,
+		LogQ:             []int{60, 55, 55, 55, 55, 55},
+		LogP:             []int{55, 55},
+		PlaintextModulus: 0x3ee0001,
+	})
+	params := *server.GetParameters()
+
+	ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	span := core.StartSpan("Decrypt proof", nil)
+	prove := func() *fhe.Proof {
+		encryptedProof, err := comm.Prove(context.Background(), core.NewElement(1), server, core.NewTranscript("test"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := encryptedProof.Decrypt(context.Background(), client, span)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proof
+	}
+
+	proof := prove()
+	if ringSwitchLogN != 0 {
+		rs, err := fhe.NewRingSwitchClient(client, ringSwitchLogN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SetRingSwitch(rs)
+		rsServer, err := fhe.NewRingSwitchServer(rs.RingSwitchEvk, rs.ParamsLit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.SetRingSwitchServer(rsServer)
+
+		// Ring switched inner products must decrypt to the same values as the plain ones.
+		plain := proof
+		proof = prove()
+		for i := range plain.MatR {
+			if !proof.MatR[i].Equal(plain.MatR[i]) || !proof.MatZ[i].Equal(plain.MatZ[i]) {
+				t.Fatalf("ring switched inner products of column %d are %v and %v, expected %v and %v", i, proof.MatR[i], proof.MatZ[i], plain.MatR[i], plain.MatZ[i])
+			}
+		}
+	}
+
+	if err := proof.ProveDecrypt(client, vdec.SchemeBFV, vdec.DefaultBatches, span); err != nil {
+		t.Fatal(err)
+	}
+	if err := proof.VerifyDecrypt(params, client.Field(), vdec.SchemeBFV, vdec.DefaultBatches); err != nil {
+		t.Fatal(err)
+	}
+
+	// The decryption proofs are bound to the root, the queried columns and the inner product ciphertexts.
+	root := proof.Root
+	proof.Root = slices.Clone(root)
+	proof.Root[0] ^= 1
+	if err := proof.VerifyDecrypt(params, client.Field(), vdec.SchemeBFV, vdec.DefaultBatches); err == nil {
+		t.Fatal("decryption proof verified under a different root")
+	}
+	proof.Root = root
+
+	column := proof.QueriedCols[0]
+	proof.QueriedCols[0] = &batching.ColumnInstance{Values: column.Values, Ct: column.Ct.CopyNew()}
+	proof.QueriedCols[0].Ct.Value[0].Coeffs[0][0]++
+	if err := proof.VerifyDecrypt(params, client.Field(), vdec.SchemeBFV, vdec.DefaultBatches); err == nil {
+		t.Fatal("decryption proof verified for a tampered queried column")
+	}
+	proof.QueriedCols[0] = column
+
+	matR := proof.MatRCts[0]
+	proof.MatRCts[0] = matR.CopyNew()
+	proof.MatRCts[0].Value[1].Coeffs[0][0]++
+	if err := proof.VerifyDecrypt(params, client.Field(), vdec.SchemeBFV, vdec.DefaultBatches); err == nil {
+		t.Fatal("decryption proof verified for a tampered inner product ciphertext")
+	}
+	proof.MatRCts[0] = matR
+
+	// A wrong inner product must be rejected.
+	proof.MatR[0] = client.Field().Add(proof.MatR[0], core.One())
+	if err := proof.VerifyDecrypt(params, client.Field(), vdec.SchemeBFV, vdec.DefaultBatches); err == nil {
+		t.Fatal("decryption proof verified for a wrong inner product")
+	}
+}
+
+func TestLigeroSegments(t *testing.T) {
+	// 80 rows in 32 slots: two full segments and one holding the last 16 rows. The small plaintext modulus and
+	// spare levels leave room for the noise of the encoding, whose output is decrypted below.
+	const rows, cols, segments = 80, 8, 3
+	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             5,
+		LogQ:             []int{60, 55, 55, 55, 55, 55},
+		LogP:             []int{55, 55},
+		PlaintextModulus: 0x3ee0001,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ligero.Segments(params) != segments {
+		t.Fatalf("expected %d segments, got %d", segments, ligero.Segments(params))
+	}
+
+	kgen := rlwe.NewKeyGenerator(params)
+	sk, pk := kgen.GenKeyPairNew()
+	evk := rlwe.NewMemEvaluationKeySet(kgen.GenRelinearizationKeyNew(sk), kgen.GenGaloisKeysNew(ligero.GaloisElements(params), sk)...)
+	ptField, err := core.NewPrimeField(params.PlaintextModulus(), cols*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fhe.NewBackendBFV(&ptField, params, pk, evk)
+	client := fhe.NewClientBFV(&ptField, params, sk)
+
+	matrix, _, err := core.RandomMatrixRowMajor(rows, cols, params.PlaintextModulus(), func(u []uint64) *struct{} { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertexts, err := fhe.EncryptMatrix(context.Background(), matrix, 1, params, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertexts) != cols*segments {
+		t.Fatalf("expected %d column segments, got %d", cols*segments, len(ciphertexts))
+	}
+
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each block of rows is encoded as a matrix of its own
+	slots := params.MaxSlots()
+	extCols := cols * rhoInv
+	for s := range segments {
+		block := matrix[s*slots : min((s+1)*slots, rows)]
+		blockCiphertexts, err := fhe.EncryptMatrix(context.Background(), block, 1, params, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := fhe.Encode(context.Background(), blockCiphertexts, len(block), rhoInv, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range encoded {
+			expected, got := make([]uint64, len(block)), make([]uint64, len(block))
+			if err := client.Decode(client.DecryptNew(encoded[j]), expected); err != nil {
+				t.Fatal(err)
+			}
+			ct, err := comm.EncodedMatrix.Load(s*extCols + j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.Decode(client.DecryptNew(ct), got); err != nil {
+				t.Fatal(err)
+			}
+			for i := range expected {
+				if expected[i] != got[i] {
+					t.Fatalf("encoded column %d of segment %d differs at row %d", j, s, i)
+				}
+			}
+		}
+	}
+
+	z := core.NewElement(3)
+	encryptedProof, err := comm.Prove(context.Background(), z, server, core.NewTranscript("test"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encryptedProof.MatR) != cols || len(encryptedProof.QueriedCols) != ligero.Queries*segments {
+		t.Fatalf("expected %d inner products and %d queried column segments, got %d and %d", cols, ligero.Queries*segments, len(encryptedProof.MatR), len(encryptedProof.QueriedCols))
+	}
+
+	proof, err := encryptedProof.Decrypt(context.Background(), client, core.StartSpan("Decrypt proof", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, col := range proof.QueriedCols {
+		if len(col.Values) != slots {
+			t.Fatalf("queried column segment %d has %d rows, expected %d", i, len(col.Values), slots)
+		}
+		// The last segment is zero padded past the last row
+		for j := rows - (i%segments)*slots; j < slots; j++ {
+			if !col.Values[j].IsZero() {
+				t.Fatalf("queried column segment %d is not zero padded at slot %d", i, j)
+			}
+		}
+	}
+
+	reference, err := ligero.LigeroProveReference(matrix, z, &ptField, core.NewTranscript("test"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range proof.MatR {
+		if !proof.MatR[i].Equal(reference.MatR[i]) || !proof.MatZ[i].Equal(reference.MatZ[i]) {
+			t.Fatalf("inner products of column %d differ from the reference", i)
+		}
+	}
+
+	value := core.NewDensePolyFromMatrix(matrix).Evaluate(&ptField, z)
+	if err := proof.Verify(z, value, &ptField, core.NewTranscript("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proof.ProveDecrypt(client, vdec.SchemeBFV, vdec.DefaultBatches, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := proof.VerifyDecrypt(params, client.Field(), vdec.SchemeBFV, vdec.DefaultBatches); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLigeroPacked(t *testing.T) {
+	// 6 rows in windows of 8 slots: 4 columns fill both rows of the 32 slots, so that encoding moves windows
+	// with column and row rotations.
+	const rows, cols, packing = 6, 8, 4
+	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             5,
+		LogQ:             []int{60, 55, 55, 55, 55, 55},
+		LogP:             []int{55, 55},
+		PlaintextModulus: 0x3ee0001,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ligero.Packing = packing
+	if err := ligero.CheckPacking(params); err != nil {
+		t.Fatal(err)
+	}
+	window := ligero.Window()
+
+	kgen := rlwe.NewKeyGenerator(params)
+	sk, pk := kgen.GenKeyPairNew()
+	evk := rlwe.NewMemEvaluationKeySet(kgen.GenRelinearizationKeyNew(sk), kgen.GenGaloisKeysNew(ligero.GaloisElements(params), sk)...)
+	ptField, err := core.NewPrimeField(params.PlaintextModulus(), cols*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fhe.NewBackendBFV(&ptField, params, pk, evk)
+	client := fhe.NewClientBFV(&ptField, params, sk)
+
+	matrix, _, err := core.RandomMatrixRowMajor(rows, cols, params.PlaintextModulus(), func(u []uint64) *struct{} { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertexts, err := fhe.EncryptMatrix(context.Background(), matrix, packing, params, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertexts) != cols/packing {
+		t.Fatalf("expected %d packed ciphertexts, got %d", cols/packing, len(ciphertexts))
+	}
+
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comm.EncodedMatrix.Len() != cols*rhoInv/packing {
+		t.Fatalf("expected %d encoded ciphertexts, got %d", cols*rhoInv/packing, comm.EncodedMatrix.Len())
+	}
+
+	// The packed encoding matches the encoding of one column per ciphertext
+	unpacked, err := fhe.EncryptMatrix(context.Background(), matrix, 1, params, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := fhe.Encode(context.Background(), unpacked, rows, rhoInv, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := range encoded {
+		expected, got := make([]uint64, rows), make([]uint64, packing*window)
+		if err := client.Decode(client.DecryptNew(encoded[j]), expected); err != nil {
+			t.Fatal(err)
+		}
+		ct, err := comm.EncodedMatrix.Load(j / packing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Decode(client.DecryptNew(ct), got); err != nil {
+			t.Fatal(err)
+		}
+		for i := range expected {
+			if expected[i] != got[(j%packing)*window+i] {
+				t.Fatalf("packed encoded column %d differs at row %d", j, i)
+			}
+		}
+	}
+
+	z := core.NewElement(3)
+	encryptedProof, err := comm.Prove(context.Background(), z, server, core.NewTranscript("test"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encryptedProof.MatR) != cols/packing || len(encryptedProof.QueriedCols) != ligero.Queries {
+		t.Fatalf("expected %d inner products and %d queried ciphertexts, got %d and %d", cols/packing, ligero.Queries, len(encryptedProof.MatR), len(encryptedProof.QueriedCols))
+	}
+
+	proof, err := encryptedProof.Decrypt(context.Background(), client, core.StartSpan("Decrypt proof", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.MatR) != cols {
+		t.Fatalf("expected %d inner products, got %d", cols, len(proof.MatR))
+	}
+
+	reference, err := ligero.LigeroProveReference(matrix, z, &ptField, core.NewTranscript("test"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range proof.MatR {
+		if !proof.MatR[i].Equal(reference.MatR[i]) || !proof.MatZ[i].Equal(reference.MatZ[i]) {
+			t.Fatalf("inner products of column %d differ from the reference", i)
+		}
+	}
+
+	value := core.NewDensePolyFromMatrix(matrix).Evaluate(&ptField, z)
+	if err := proof.Verify(z, value, &ptField, core.NewTranscript("test")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupSmallLigero(t *testing.T, rows, cols, packing int, galoisKeys bool, paramsLiteral bgv.ParametersLiteral) (*fhe.ServerBFV, *fhe.ClientBFV, []*rlwe.Ciphertext) {
+	params, err := bgv.NewParametersFromLiteral(paramsLiteral)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kgen := rlwe.NewKeyGenerator(params)
+	sk, pk := kgen.GenKeyPairNew()
+	rlk := kgen.GenRelinearizationKeyNew(sk)
+
+	var rotKeys []*rlwe.GaloisKey
+	if galoisKeys {
+		rotKeys = kgen.GenGaloisKeysNew(fhe.LigeroMetadata{Rows: rows, Packing: packing}.GaloisElements(params), sk)
+	}
+	evk := rlwe.NewMemEvaluationKeySet(rlk, rotKeys...)
+
+	ptField, err := core.NewPrimeField(params.PlaintextModulus(), cols*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := fhe.NewBackendBFV(&ptField, params, pk, evk)
+
+	matrix, _, err := core.RandomMatrixRowMajor(rows, cols, params.PlaintextModulus(), func(u []uint64) *struct{} { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertexts, err := fhe.EncryptMatrix(context.Background(), matrix, packing, params, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server, fhe.NewClientBFV(&ptField, params, sk), ciphertexts
+}
+
+func smallLigeroParams(t *testing.T, cols int) bgv.ParametersLiteral {
+	paramsLiteral, err := fhe.GenerateBGVParamsForNTT(cols, LogN, Modulus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paramsLiteral
+}
+
+// assertNoLeakedGoroutines waits for worker goroutines to exit and fails if more remain than before.
+func assertNoLeakedGoroutines(t *testing.T, before int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked goroutines: %d running, %d before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLigeroFileStore(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		rows, packing int
+	}{
+		{"segments", 80, 1},
+		{"packed", 6, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) { testLigeroFileStore(t, tc.rows, tc.packing) })
+	}
+}
+
+// testLigeroFileStore checks that committing with file stores encodes the matrix and evaluates the inner products
+// as memory stores do. Encode encrypts fresh zero columns, so the commitments are compared decrypted.
+func testLigeroFileStore(t *testing.T, rows, packing int) {
+	const cols = 8
+	// Spare levels leave room for the noise of the encoding, as in TestLigeroSegments
+	server, client, ciphertexts := setupSmallLigero(t, rows, cols, packing, true, bgv.ParametersLiteral{
+		LogN:             5,
+		LogQ:             []int{60, 55, 55, 55, 55, 55},
+		LogP:             []int{55, 55},
+		PlaintextModulus: 0x3ee0001,
+	})
+	params := *server.GetParameters()
+
+	decrypt := func(ct *rlwe.Ciphertext) []uint64 {
+		values := make([]uint64, params.MaxSlots())
+		if err := client.Decode(client.DecryptNew(ct), values); err != nil {
+			t.Fatal(err)
+		}
+		return values
+	}
+	prove := func(newStore fhe.NewStoreFunc) ([][]uint64, []*core.Element) {
+		ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ligero.Packing = packing
+		ligero.NewStore = newStore
+
+		matrix, err := fhe.StoreAll(ciphertexts, newStore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer matrix.Close()
+		comm, _, err := ligero.Commit(context.Background(), matrix, server, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer comm.Close()
+
+		encoded := make([][]uint64, comm.EncodedMatrix.Len())
+		for i := range encoded {
+			ct, err := comm.EncodedMatrix.Load(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded[i] = decrypt(ct)
+		}
+
+		encryptedProof, err := comm.Prove(context.Background(), core.NewElement(3), server, core.NewTranscript("test"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, err := encryptedProof.Decrypt(context.Background(), client, core.StartSpan("Decrypt proof", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded, proof.MatR
+	}
+
+	encoded, matR := prove(fhe.NewMemoryStore)
+	dir := t.TempDir()
+	fileEncoded, fileMatR := prove(fhe.FileStores(dir, params))
+	for i := range encoded {
+		if !slices.Equal(encoded[i], fileEncoded[i]) {
+			t.Fatalf("encoded ciphertext %d differs with file stores", i)
+		}
+	}
+	for i := range matR {
+		if !matR[i].Equal(fileMatR[i]) {
+			t.Fatalf("inner product of column %d differs with file stores", i)
+		}
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("expected the store files to be removed, found %v, %v", entries, err)
+	}
+}
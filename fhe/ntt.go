@@ -4,25 +4,199 @@
 package fhe
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/nulltea/lumenos/core"
 
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 )
 
-func NTT(values []*rlwe.Ciphertext, size int, backend *ServerBFV) ([]*rlwe.Ciphertext, error) {
-	if err := nttInner(values, size, backend); err != nil {
+// NTT performs the NTT of the given size on batched ciphertexts, slot by slot, as core.NTT does on plain values.
+// The context is checked between butterfly blocks; a cancelled context aborts the transform.
+func NTT(ctx context.Context, values []*rlwe.Ciphertext, size int, backend *ServerBFV) ([]*rlwe.Ciphertext, error) {
+	if err := nttInner(ctx, values, size, backend); err != nil {
 		return nil, err
 	}
 	return values, nil
 }
 
+// nttStream performs the NTT of the given size on values loaded with in and writes the result with out, holding
+// O(sqrt(size)) ciphertexts at a time. It follows the six-step algorithm of nttInner: the transforms of size n1 run
+// on groups of values loaded with in and are kept in a store made by newStore, from which the transforms of size
+// n2 load theirs. Both run in parallel.
+//
+// Values may be packed by packing per ciphertext in windows of window slots: value x is in window x%packing of
+// ciphertext x/packing, and so is the transformed value x written out. The transforms then run on whole
+// ciphertexts, one per window, and between them each packing x packing tile of values is transposed from the
+// windows to the ciphertexts with masks and rotations, which also apply the twiddles.
+// See LigeroMetadata.CheckPacking for the sizes packing supports.
+func nttStream(ctx context.Context, in func(int) (*rlwe.Ciphertext, error), out func(int, *rlwe.Ciphertext) error, size, packing, window int, newStore NewStoreFunc, backend *ServerBFV) error {
+	k := packing
+	if size < 16 && k == 1 {
+		v := make([]*rlwe.Ciphertext, size)
+		for x := range v {
+			ct, err := in(x)
+			if err != nil {
+				return err
+			}
+			v[x] = ct.CopyNew()
+		}
+		if err := nttInner(ctx, v, size, backend); err != nil {
+			return err
+		}
+		for x, ct := range v {
+			if err := out(x, ct); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	n1, err := core.SqrtFactor(size)
+	if err != nil {
+		return err
+	}
+	n2 := size / n1
+	if size < 16 || n1%k != 0 {
+		return fmt.Errorf("%w: NTT of size %d cannot transform %d windows together", core.ErrDimensionMismatch, size, k)
+	}
+	p, q := n2/k, n1/k
+
+	work, err := newStore(size / k)
+	if err != nil {
+		return err
+	}
+	defer work.Close()
+
+	// Value (i, j) of the n1 x n2 matrix is in window j%k of ciphertext i*p+j/k, transform along i
+	_, err = ParallelMap(ctx, p, func() func(int) (struct{}, error) {
+		backend := backend.CopyNew()
+		return func(c int) (struct{}, error) {
+			chunk := make([]*rlwe.Ciphertext, n1)
+			for i := range chunk {
+				ct, err := in(i*p + c)
+				if err != nil {
+					return struct{}{}, err
+				}
+				chunk[i] = ct.CopyNew()
+			}
+			if err := nttInner(ctx, chunk, n1, backend); err != nil {
+				return struct{}{}, err
+			}
+			for i, ct := range chunk {
+				if err := work.Store(i*p+c, ct); err != nil {
+					return struct{}{}, err
+				}
+			}
+			return struct{}{}, nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Multiply with the twiddles and transform along j the values (i, j) with i/k = r, moved to window i%k of
+	// ciphertext j if packed. The result is laid out by index j*n1+i.
+	_, err = ParallelMap(ctx, q, func() func(int) (struct{}, error) {
+		backend := backend.CopyNew()
+		field := backend.Field()
+		return func(r int) (struct{}, error) {
+			row := make([]*rlwe.Ciphertext, n2)
+			for t := range p {
+				tile := make([]*rlwe.Ciphertext, k)
+				for a := range tile {
+					ct, err := work.Load((r*k+a)*p + t)
+					if err != nil {
+						return struct{}{}, err
+					}
+					tile[a] = ct
+				}
+
+				if k == 1 {
+					ct := tile[0]
+					if r > 0 && t > 0 {
+						twiddle := field.RootUint64(size, r*t)
+						var err error
+						if ct, err = backend.MulNew(ct, twiddle); err != nil {
+							return struct{}{}, err
+						}
+					} else {
+						ct = ct.CopyNew()
+					}
+					row[t] = ct
+					continue
+				}
+
+				transposed, err := transposeTile(tile, r, t, size, window, backend)
+				if err != nil {
+					return struct{}{}, err
+				}
+				copy(row[t*k:], transposed)
+			}
+
+			if err := nttInner(ctx, row, n2, backend); err != nil {
+				return struct{}{}, err
+			}
+			for j, ct := range row {
+				if err := out(j*q+r, ct); err != nil {
+					return struct{}{}, err
+				}
+			}
+			return struct{}{}, nil
+		}
+	})
+	return err
+}
+
+// transposeTile moves value (i, j) of tile (r, t) of the six-step matrix, for i = r*k+a and j = t*k+b, from window
+// b of tile[a] to window a of ciphertext b of the result, multiplied by its twiddle for an NTT of the given size.
+func transposeTile(tile []*rlwe.Ciphertext, r, t, size, window int, backend *ServerBFV) ([]*rlwe.Ciphertext, error) {
+	k := len(tile)
+	field := backend.Field()
+	out := make([]*rlwe.Ciphertext, k)
+	for a, ct := range tile {
+		i := r*k + a
+		for b := range k {
+			j := t*k + b
+			twiddles := make([]uint64, k)
+			twiddles[b] = 1
+			if i > 0 && j > 0 {
+				twiddles[b] = field.RootUint64(size, i*j)
+			}
+			pt, err := encodeWindows(twiddles, window, backend)
+			if err != nil {
+				return nil, err
+			}
+			term, err := backend.MulNew(ct, pt)
+			if err != nil {
+				return nil, err
+			}
+			if term, err = moveWindow(term, b, a, window, backend); err != nil {
+				return nil, err
+			}
+
+			if out[b] == nil {
+				out[b] = term
+			} else if err := backend.Add(out[b], term, out[b]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
 // nttInner performs NTT on batched ciphertexts using the BGV evaluator
-func nttInner(v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
+func nttInner(ctx context.Context, v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
 	switch size {
 	case 0, 1:
 		return nil
 	case 2:
 		for i := 0; i < len(v); i += 2 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			v0, v1 := v[i].CopyNew(), v[i+1].CopyNew()
 			err := backend.Add(v0, v1, v[i])
 			if err != nil {
@@ -35,6 +209,10 @@ func nttInner(v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
 		}
 	case 4:
 		for i := 0; i < len(v); i += 4 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			// (v[0], v[2]) = (v[0] + v[2], v[0] - v[2])
 			v0, v2 := v[i].CopyNew(), v[i+2].CopyNew()
 			err := backend.Add(v0, v2, v[i])
@@ -57,7 +235,7 @@ func nttInner(v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
 				return err
 			}
 
-			err = backend.Mul(v[i+3], backend.Field().RootForwardUint64(4), v[i+3])
+			err = backend.Mul(v[i+3], backend.Field().RootUint64(4, 1), v[i+3])
 			if err != nil {
 				return err
 			}
@@ -89,6 +267,10 @@ func nttInner(v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
 		}
 	case 8:
 		for i := 0; i < len(v); i += 8 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			// First level butterflies
 			v0, v4 := v[i].CopyNew(), v[i+4].CopyNew()
 			err := backend.Add(v0, v4, v[i])
@@ -131,16 +313,15 @@ func nttInner(v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
 			}
 
 			// Multiply by roots
-			err = backend.Mul(v[i+5], backend.Field().RootForwardUint64(8), v[i+5])
+			err = backend.Mul(v[i+5], backend.Field().RootUint64(8, 1), v[i+5])
 			if err != nil {
 				return err
 			}
-			err = backend.Mul(v[i+6], backend.Field().RootForwardUint64(4), v[i+6])
+			err = backend.Mul(v[i+6], backend.Field().RootUint64(8, 2), v[i+6])
 			if err != nil {
 				return err
 			}
-			omega8_3 := backend.Field().Pow(3, backend.Field().RootForward(8)).Uint64()
-			err = backend.Mul(v[i+7], omega8_3, v[i+7])
+			err = backend.Mul(v[i+7], backend.Field().RootUint64(8, 3), v[i+7])
 			if err != nil {
 				return err
 			}
@@ -166,7 +347,7 @@ func nttInner(v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
 				return err
 			}
 
-			err = backend.Mul(v[i+3], backend.Field().RootForwardUint64(4), v[i+3])
+			err = backend.Mul(v[i+3], backend.Field().RootUint64(4, 1), v[i+3])
 			if err != nil {
 				return err
 			}
@@ -212,7 +393,7 @@ func nttInner(v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
 				return err
 			}
 
-			err = backend.Mul(v[i+7], backend.Field().RootForwardUint64(4), v[i+7])
+			err = backend.Mul(v[i+7], backend.Field().RootUint64(4, 1), v[i+7])
 			if err != nil {
 				return err
 			}
@@ -244,37 +425,49 @@ func nttInner(v []*rlwe.Ciphertext, size int, backend *ServerBFV) error {
 		}
 	default:
 		// Six-step Algorithm
-		n1 := core.SqrtFactor(size)
+		n1, err := core.SqrtFactor(size)
+		if err != nil {
+			return err
+		}
 		n2 := size / n1
-		step := backend.Field().N() / size
 
 		for chunkStart := 0; chunkStart < len(v); chunkStart += size {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			chunk := v[chunkStart : chunkStart+size]
 
-			core.Transpose(chunk, n1, n2)
+			if err := core.Transpose(chunk, n1, n2); err != nil {
+				return err
+			}
 
 			// Perform n2 NTTs of size n1 (on columns of original matrix)
 			// apply NTTs row-wise now with size n1.
-			nttInner(chunk, n1, backend)
+			if err := nttInner(ctx, chunk, n1, backend); err != nil {
+				return err
+			}
 
-			core.Transpose(chunk, n2, n1)
+			if err := core.Transpose(chunk, n2, n1); err != nil {
+				return err
+			}
 
 			for i := 1; i < n1; i++ {
-				step = (i * step) % backend.Field().N()
-				idx := step
 				for j := 1; j < n2; j++ {
-					idx %= backend.Field().N()
-					twiddle := backend.Field().RootForwardUint64(idx)
+					twiddle := backend.Field().RootUint64(size, i*j)
 					err := backend.Mul(chunk[i*n2+j], twiddle, chunk[i*n2+j])
 					if err != nil {
 						return err
 					}
-					idx += step
 				}
 			}
 
-			nttInner(chunk, n2, backend)
-			core.Transpose(chunk, n1, n2)
+			if err := nttInner(ctx, chunk, n2, backend); err != nil {
+				return err
+			}
+			if err := core.Transpose(chunk, n1, n2); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,84 @@
+package fhe_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// dft evaluates the discrete Fourier transform of v by its definition.
+func dft(v []*core.Element, field *core.PrimeField) []*core.Element {
+	out := make([]*core.Element, len(v))
+	for k := range out {
+		out[k] = core.Zero()
+		for j, x := range v {
+			out[k] = field.Add(out[k], field.Mul(x, field.Root(len(v), j*k)))
+		}
+	}
+	return out
+}
+
+// TestNTTMatchesDFT checks the homomorphic NTT, and the Reed-Solomon encoding built on it, against the DFT of
+// every row of the encrypted columns.
+func TestNTTMatchesDFT(t *testing.T) {
+	const rows, cols = 4, 32
+	// The parameters leave a noise budget for the longest transform, that of Encode
+	server, client, ciphertexts := setupSmallLigero(t, rows, cols, 1, false, smallLigeroParams(t, cols*rhoInv))
+	field := client.Field()
+
+	decrypt := func(cts []*rlwe.Ciphertext) [][]*core.Element {
+		matrix := make([][]*core.Element, rows)
+		for i := range matrix {
+			matrix[i] = make([]*core.Element, len(cts))
+		}
+		for j, ct := range cts {
+			column := make([]uint64, rows)
+			if err := client.Decode(client.DecryptNew(ct), column); err != nil {
+				t.Fatal(err)
+			}
+			for i := range column {
+				matrix[i][j] = core.NewElement(column[i])
+			}
+		}
+		return matrix
+	}
+	matrix := decrypt(ciphertexts)
+
+	check := func(name string, got [][]*core.Element, rowsOf func(int) []*core.Element) {
+		for i := range got {
+			for k, expected := range dft(rowsOf(i), field) {
+				if !got[i][k].Equal(expected) {
+					t.Fatalf("%s differs from the DFT at [%d][%d]", name, i, k)
+				}
+			}
+		}
+	}
+
+	for _, size := range []int{4, 8, 16, 32} {
+		cts := make([]*rlwe.Ciphertext, size)
+		for j := range cts {
+			cts[j] = ciphertexts[j].CopyNew()
+		}
+		transformed, err := fhe.NTT(context.Background(), cts, size, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("NTT", decrypt(transformed), func(i int) []*core.Element { return matrix[i][:size] })
+	}
+
+	encoded, err := fhe.Encode(context.Background(), ciphertexts, rows, rhoInv, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("Encode", decrypt(encoded), func(i int) []*core.Element {
+		row := make([]*core.Element, cols*rhoInv)
+		for j := range row {
+			row[j] = core.Zero()
+		}
+		copy(row, matrix[i])
+		return row
+	})
+}
@@ -0,0 +1,127 @@
+package fhe
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// ErrPacking is returned when the matrix cannot be packed with the requested number of columns per ciphertext.
+var ErrPacking = errors.New("unsupported column packing")
+
+// ColumnsPerCiphertext returns the number of columns packed into one ciphertext, at least 1.
+func (m LigeroMetadata) ColumnsPerCiphertext() int {
+	return max(m.Packing, 1)
+}
+
+// Window returns the number of slots of a packed column: the rows rounded up to a power of two, so that windows
+// tile the rows of slots and InnerSum adds up a column without reaching into the next one.
+// Column j of the matrix, and of the encoded matrix, is in window j%Packing of ciphertext j/Packing;
+// window w starts at slot w*Window.
+func (m LigeroMetadata) Window() int {
+	return 1 << bits.Len(uint(m.Rows-1))
+}
+
+// CheckPacking returns an error wrapping ErrPacking if the matrix cannot be packed as requested under params.
+// Packing needs windows that fit in the slots, a number of columns it divides, and an encoded row long enough for
+// the six-step NTT to transform the windows together (see nttStream).
+func (m LigeroMetadata) CheckPacking(params bgv.Parameters) error {
+	k := m.ColumnsPerCiphertext()
+	if k == 1 {
+		return nil
+	}
+	if k&(k-1) != 0 {
+		return fmt.Errorf("%w: %d columns per ciphertext is not a power of two", ErrPacking, k)
+	}
+	if k*m.Window() > params.MaxSlots() {
+		return fmt.Errorf("%w: %d windows of %d slots exceed %d slots", ErrPacking, k, m.Window(), params.MaxSlots())
+	}
+	if m.Cols%k != 0 {
+		return fmt.Errorf("%w: %d columns do not split into ciphertexts of %d", ErrPacking, m.Cols, k)
+	}
+	extCols := m.Cols * m.RhoInv
+	n1, err := core.SqrtFactor(extCols)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPacking, err)
+	}
+	if extCols < 16 || n1%k != 0 {
+		return fmt.Errorf("%w: NTT of size %d cannot transform %d windows together", ErrPacking, extCols, k)
+	}
+	return nil
+}
+
+// packedGaloisElements returns the Galois elements of the rotations nttStream moves windows with, see moveWindow.
+func packedGaloisElements(packing, window int, params bgv.Parameters) []uint64 {
+	var galEls []uint64
+	for src := range packing {
+		for dst := range packing {
+			shift, swap := windowRotation(src, dst, window, params.MaxSlots())
+			if shift != 0 {
+				galEls = append(galEls, params.GaloisElement(shift))
+			}
+			if swap {
+				galEls = append(galEls, params.GaloisElementForRowRotation())
+			}
+		}
+	}
+	slices.Sort(galEls)
+	return slices.Compact(galEls)
+}
+
+// windowRotation returns the column rotation and whether a row rotation is needed to move window src onto window
+// dst. BGV slots form two rows of N/2 that column rotations turn separately.
+func windowRotation(src, dst, window, slots int) (shift int, swap bool) {
+	perRow := slots / 2 / window
+	shift = ((src%perRow - dst%perRow + perRow) % perRow) * window
+	return shift, src/perRow != dst/perRow
+}
+
+// moveWindow returns a copy of ct rotated so that its window src lands on window dst.
+func moveWindow(ct *rlwe.Ciphertext, src, dst, window int, backend *ServerBFV) (*rlwe.Ciphertext, error) {
+	shift, swap := windowRotation(src, dst, window, backend.params.MaxSlots())
+	var err error
+	if shift != 0 {
+		if ct, err = backend.RotateColumnsNew(ct, shift); err != nil {
+			return nil, err
+		}
+	}
+	if swap {
+		if ct, err = backend.RotateRowsNew(ct); err != nil {
+			return nil, err
+		}
+	}
+	return ct, nil
+}
+
+// encodeWindows encodes a plaintext holding values[w] in every slot of window w.
+func encodeWindows(values []uint64, window int, backend *ServerBFV) (*rlwe.Plaintext, error) {
+	slots := make([]uint64, len(values)*window)
+	for w, value := range values {
+		for i := range window {
+			slots[w*window+i] = value
+		}
+	}
+	pt := bgv.NewPlaintext(backend.params, backend.params.MaxLevel())
+	if err := backend.Encode(slots, pt); err != nil {
+		return nil, err
+	}
+	return pt, nil
+}
+
+// encodeRepeated encodes a plaintext holding values at the start of each of packing windows.
+func encodeRepeated(values []uint64, packing, window int, backend *ServerBFV) (*rlwe.Plaintext, error) {
+	slots := make([]uint64, packing*window)
+	for w := range packing {
+		copy(slots[w*window:], values)
+	}
+	pt := bgv.NewPlaintext(backend.params, backend.params.MaxLevel())
+	if err := backend.Encode(slots, pt); err != nil {
+		return nil, err
+	}
+	return pt, nil
+}
@@ -0,0 +1,96 @@
+package fhe
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// ParallelMap evaluates work for every index in [0, n) on a pool of workers and collects the results in order.
+// newWorker is called once per worker, so that each one can hold its own copy of the backend.
+// The first error, or cancellation of ctx, stops all workers and is returned once they have exited.
+func ParallelMap[T any](ctx context.Context, n int, newWorker func() func(i int) (T, error)) ([]T, error) {
+	type workResult struct {
+		index int
+		value T
+		err   error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := make([]T, n)
+	resultChan := make(chan workResult, n)
+
+	numWorkers := determineOptimalWorkers(n)
+	workChan := make(chan int, n)
+
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		work := newWorker()
+		go func() {
+			defer wg.Done()
+			for i := range workChan {
+				if ctx.Err() != nil {
+					return
+				}
+
+				value, err := work(i)
+				if err != nil {
+					resultChan <- workResult{index: i, err: err}
+					return
+				}
+
+				resultChan <- workResult{index: i, value: value}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		workChan <- i
+	}
+	close(workChan)
+
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	var firstErr error
+	for res := range resultChan {
+		if res.err != nil && firstErr == nil {
+			firstErr = res.err
+			cancel()
+		}
+		result[res.index] = res.value
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// determineOptimalWorkers calculates the optimal number of workers based on system resources and workload
+func determineOptimalWorkers(matrixSize int) int {
+	numCPU := runtime.NumCPU()
+
+	// For small matrices, use fewer workers to avoid overhead
+	if matrixSize < numCPU {
+		return matrixSize
+	}
+
+	// For medium matrices, use number of CPU cores
+	if matrixSize <= numCPU*4 {
+		return numCPU
+	}
+
+	// For large matrices, use more workers but cap at 2x CPU cores
+	// to avoid excessive context switching
+	return min(numCPU*2, matrixSize)
+}
@@ -0,0 +1,336 @@
+package fhe
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// PlanConfig describes a Ligero FHE proving job to plan. The BGV parameters are those the server derives with
+// GenerateBGVParamsForNTT(Cols, LogN, PlaintextModulus).
+type PlanConfig struct {
+	Rows             int
+	Cols             int
+	RhoInv           int
+	SecurityBits     float64
+	LogN             int
+	PlaintextModulus uint64
+	// RingSwitchLogN is the ring degree the inner products are switched to, or 0 to keep them in the FHE ring.
+	RingSwitchLogN int
+	// Packing is the number of columns per ciphertext, see LigeroMetadata.Window.
+	Packing int
+}
+
+// LigeroPlan is the predicted cost of a Ligero FHE proving job, computed without running it.
+// Sizes are in bytes and follow the binary encodings of the protocol; the memory footprint counts the live
+// ciphertexts, keys and buffers of the server pipeline and is a lower bound of the process peak.
+type LigeroPlan struct {
+	LigeroMetadata
+	LogN   int
+	Levels int // number of ciphertext moduli
+	Slots  int
+	// Segments is the number of ciphertexts each column is split into, see LigeroMetadata.Segments.
+	Segments int
+
+	MatrixCiphertexts  int // encrypted column segments, or packed columns, of the witness
+	EncodedCiphertexts int // column segments, or packed columns, of the Reed-Solomon encoded matrix
+	CiphertextBytes    int // a fresh ciphertext
+	LeafBytes          int // an encoded column switched down to the Merkle leaf level
+
+	MatRBytes        int
+	MatZBytes        int
+	QueriedColsBytes int
+	MerklePathsBytes int
+	ProofBytes       int
+
+	PublicKeyBytes          int
+	RelinearizationKeyBytes int
+	GaloisKeysBytes         int
+	RingSwitchKeyBytes      int
+	KeysBytes               int
+
+	ServerMemoryBytes int
+
+	// CommitOps and ProveOps count operations as the CostAccountant does. Queried columns that were already
+	// switched down by an earlier query of the same column are not rescaled again, so ProveOps.Rescale is an upper bound.
+	CommitOps OpCounts
+	ProveOps  OpCounts
+
+	// ClientDecryptions is the number of ciphertexts the client decrypts to open the proof.
+	ClientDecryptions int
+}
+
+// PlanLigero predicts the cost of proving with cfg. It instantiates the BGV parameters and one key of each kind
+// to measure their sizes, but does not encrypt or evaluate anything.
+func PlanLigero(cfg PlanConfig) (*LigeroPlan, error) {
+	if cfg.Rows <= 0 || cfg.Cols <= 0 {
+		return nil, fmt.Errorf("%w: %dx%d matrix", core.ErrInvalidSize, cfg.Rows, cfg.Cols)
+	}
+	if cfg.RhoInv < 2 || cfg.Cols&(cfg.Cols-1) != 0 || cfg.RhoInv&(cfg.RhoInv-1) != 0 {
+		return nil, fmt.Errorf("%w: NTT over %d columns at rate 1/%d", core.ErrInvalidSize, cfg.Cols, cfg.RhoInv)
+	}
+	committer, err := NewLigeroCommitter(cfg.SecurityBits, cfg.Rows, cfg.Cols, cfg.RhoInv)
+	if err != nil {
+		return nil, err
+	}
+	committer.Packing = cfg.Packing
+	packing := committer.ColumnsPerCiphertext()
+	if packing > 1 && cfg.RingSwitchLogN != 0 {
+		return nil, fmt.Errorf("%w: ring switching keeps only slot 0 of the inner products", ErrPacking)
+	}
+
+	paramsLit, err := bgvParamsForNTT(cfg.Cols, cfg.LogN, cfg.PlaintextModulus)
+	if err != nil {
+		return nil, err
+	}
+	params, err := bgv.NewParametersFromLiteral(paramsLit)
+	if err != nil {
+		return nil, err
+	}
+	// The plaintext field must hold the roots of unity of the encoding NTT
+	if uint(bits.TrailingZeros64(cfg.PlaintextModulus-1)) < uint(bits.Len(uint(2*cfg.Cols))-1) {
+		return nil, fmt.Errorf("%w: plaintext modulus has no NTT of size %d", core.ErrInvalidSize, 2*cfg.Cols)
+	}
+
+	if err := committer.CheckPacking(params); err != nil {
+		return nil, err
+	}
+
+	levels := params.MaxLevel() + 1
+	encoded := cfg.Cols * cfg.RhoInv
+	segments := committer.Segments(params)
+	rescales := max(levels-2, 0)
+	// Ciphertexts of inner products, one per column or packed ciphertext
+	innerProducts := cfg.Cols / packing
+	p := &LigeroPlan{
+		LigeroMetadata:     committer.LigeroMetadata,
+		LogN:               params.LogN(),
+		Levels:             levels,
+		Slots:              params.MaxSlots(),
+		Segments:           segments,
+		MatrixCiphertexts:  innerProducts * segments,
+		EncodedCiphertexts: encoded / packing * segments,
+		CiphertextBytes:    rlwe.NewCiphertext(params, 1, params.MaxLevel()).BinarySize(),
+		LeafBytes:          rlwe.NewCiphertext(params, 1, min(1, params.MaxLevel())).BinarySize(),
+		ClientDecryptions:  2*innerProducts + committer.Queries*segments,
+	}
+
+	// Inner products are switched down to the leaf level, or to the ring switched parameters
+	innerProductBytes := p.LeafBytes
+	var keySwitches uint64
+	if cfg.RingSwitchLogN != 0 {
+		rsParams, err := bgv.NewParametersFromLiteral(RingSwitchParametersLiteral(params, cfg.RingSwitchLogN))
+		if err != nil {
+			return nil, err
+		}
+		innerProductBytes = rlwe.NewCiphertext(rsParams, 1, rsParams.MaxLevel()).BinarySize()
+		keySwitches = uint64(2 * cfg.Cols)
+
+		// Same key parameters as NewRingSwitchClient
+		levelQ, levelP, base := params.MaxLevel(), params.MaxLevelP(), 13
+		p.RingSwitchKeyBytes = rlwe.NewEvaluationKey(params, rlwe.EvaluationKeyParameters{
+			LevelQ:               &levelQ,
+			LevelP:               &levelP,
+			BaseTwoDecomposition: &base,
+		}).BinarySize()
+	}
+
+	merkleDepth := bits.Len(uint(encoded/packing - 1))
+	p.MatRBytes = innerProducts * innerProductBytes
+	p.MatZBytes = innerProducts * innerProductBytes
+	p.QueriedColsBytes = committer.Queries * segments * p.LeafBytes
+	p.MerklePathsBytes = committer.Queries * merkleDepth * 32
+	// Metadata, the three ciphertext vectors, the paths and the root, as written by EncryptedProof.WriteTo
+	p.ProofBytes = 12 + p.MatRBytes + p.MatZBytes + p.QueriedColsBytes + p.MerklePathsBytes + 32
+
+	p.PublicKeyBytes = rlwe.NewPublicKey(params).BinarySize()
+	p.RelinearizationKeyBytes = rlwe.NewRelinearizationKey(params).BinarySize()
+	p.GaloisKeysBytes = len(committer.GaloisElements(params)) * rlwe.NewGaloisKey(params).BinarySize()
+	p.KeysBytes = p.PublicKeyBytes + p.RelinearizationKeyBytes + p.GaloisKeysBytes + p.RingSwitchKeyBytes
+
+	// The witness and the keys live for the whole session, the tree keeps its leaves until the proof is built,
+	// and marshaling holds the proof ciphertexts next to their encoding
+	witness := p.MatrixCiphertexts * p.CiphertextBytes
+	committed := witness + p.EncodedCiphertexts*(p.CiphertextBytes+p.LeafBytes)
+	proving := committed + p.MatRBytes + p.MatZBytes
+	marshaling := witness + 2*p.ProofBytes
+	p.ServerMemoryBytes = p.KeysBytes + max(proving, marshaling)
+
+	// Each block of rows is encoded separately, and the inner sums of the segments of a column are added up
+	ntt := nttOps(encoded)
+	if packing > 1 {
+		ntt = nttPackedOps(encoded, packing, committer.Window(), p.Slots)
+	}
+	p.CommitOps = OpCounts{
+		Add:      ntt.Add * uint64(segments),
+		Sub:      ntt.Sub * uint64(segments),
+		MulPlain: ntt.MulPlain * uint64(segments),
+		Rotate:   ntt.Rotate,
+		Encrypt:  1, // the zero padding columns
+		Rescale:  uint64(p.EncodedCiphertexts * rescales),
+	}
+	p.ProveOps = OpCounts{
+		Add:       uint64(2 * innerProducts * (segments - 1)),
+		MulPlain:  uint64(2 * innerProducts * segments),
+		InnerSum:  uint64(2 * innerProducts * segments),
+		Rescale:   uint64((2*innerProducts + committer.Queries*segments) * rescales),
+		KeySwitch: keySwitches,
+	}
+	if packing > 1 {
+		// The inner products are masked down to the first slot of each window
+		p.ProveOps.MulPlain += uint64(2 * innerProducts)
+	}
+	if cfg.Rows > p.Slots/2 {
+		// Segments filling both rows of slots are summed across them with a row rotation
+		p.ProveOps.Rotate = p.ProveOps.InnerSum
+		p.ProveOps.Add += p.ProveOps.InnerSum
+	}
+
+	return p, nil
+}
+
+// nttOps counts the operations of the homomorphic NTT of the given size, following nttInner.
+func nttOps(size int) OpCounts {
+	switch size {
+	case 0, 1:
+		return OpCounts{}
+	case 2:
+		return OpCounts{Add: 1, Sub: 1}
+	case 4:
+		return OpCounts{Add: 4, Sub: 4, MulPlain: 1}
+	case 8:
+		return OpCounts{Add: 12, Sub: 12, MulPlain: 5}
+	}
+
+	// Six-step: n2 transforms of size n1, twiddles, then n1 transforms of size n2
+	n1, _ := core.SqrtFactor(size)
+	n2 := size / n1
+	inner1, inner2 := nttOps(n1), nttOps(n2)
+	return OpCounts{
+		Add:      uint64(n2)*inner1.Add + uint64(n1)*inner2.Add,
+		Sub:      uint64(n2)*inner1.Sub + uint64(n1)*inner2.Sub,
+		MulPlain: uint64(n2)*inner1.MulPlain + uint64(n1)*inner2.MulPlain + uint64((n1-1)*(n2-1)),
+	}
+}
+
+// nttPackedOps counts the operations of nttPacked, the NTT of the given size on values packed by packing per
+// ciphertext in windows of window slots.
+func nttPackedOps(size, packing, window, slots int) OpCounts {
+	n1, _ := core.SqrtFactor(size)
+	n2 := size / n1
+	inner1, inner2 := nttOps(n1), nttOps(n2)
+	p, q := uint64(n2/packing), uint64(n1/packing)
+
+	// Every tile multiplies each ciphertext with packing masks, moves the windows and adds them up
+	var rotations uint64
+	for src := range packing {
+		for dst := range packing {
+			shift, swap := windowRotation(src, dst, window, slots)
+			if shift != 0 {
+				rotations++
+			}
+			if swap {
+				rotations++
+			}
+		}
+	}
+	tiles := p * q
+	k := uint64(packing)
+	return OpCounts{
+		Add:      p*inner1.Add + q*inner2.Add + tiles*k*(k-1),
+		Sub:      p*inner1.Sub + q*inner2.Sub,
+		MulPlain: p*inner1.MulPlain + q*inner2.MulPlain + tiles*k*k,
+		Rotate:   tiles * rotations,
+	}
+}
+
+// ShapeObjective is the cost RecommendShape minimizes.
+type ShapeObjective int
+
+const (
+	MinimizeProofSize ShapeObjective = iota
+	MinimizeServerTime
+	MinimizeClientTime
+)
+
+func (o ShapeObjective) String() string {
+	switch o {
+	case MinimizeProofSize:
+		return "proof size"
+	case MinimizeServerTime:
+		return "server time"
+	case MinimizeClientTime:
+		return "client time"
+	default:
+		return fmt.Sprintf("ShapeObjective(%d)", int(o))
+	}
+}
+
+// Cost estimates the cost of the plan for objective, in units that are only meaningful to compare plans.
+// The proof size is exact. Server time assumes that an operation costs as much as the size of the ciphertext it
+// touches, and a key switch, which each rotation of an inner sum performs, as much per modulus. Client time is the
+// size of the ciphertexts the client decrypts.
+func (p *LigeroPlan) Cost(objective ShapeObjective) float64 {
+	switch objective {
+	case MinimizeServerTime:
+		sumSlots := min(p.Rows, p.Slots/2)
+		if p.ColumnsPerCiphertext() > 1 {
+			sumSlots = p.Window()
+		}
+		var linear, keySwitches uint64
+		for _, ops := range []OpCounts{p.CommitOps, p.ProveOps} {
+			linear += ops.Add + ops.Sub + ops.MulPlain + ops.MulCt + ops.Rescale + ops.Encrypt
+			keySwitches += ops.KeySwitch + ops.Rotate + ops.InnerSum*uint64(bits.Len(uint(sumSlots-1)))
+		}
+		return float64(p.CiphertextBytes) * (float64(linear) + float64(keySwitches)*float64(p.Levels))
+	case MinimizeClientTime:
+		return float64(p.ClientDecryptions * p.LeafBytes)
+	default:
+		return float64(p.ProofBytes)
+	}
+}
+
+// RecommendShape plans every power-of-two matrix shape holding size coefficients with the configuration of cfg,
+// ignoring its Rows and Cols, and returns the plan of least cost for objective. Shapes whose columns exceed the NTT
+// the plaintext field or the parameters allow are skipped; rows beyond the slot count split the columns into segments.
+func RecommendShape(size int, cfg PlanConfig, objective ShapeObjective) (*LigeroPlan, error) {
+	if size < 4 || size&(size-1) != 0 {
+		return nil, fmt.Errorf("%w: %d coefficients is not a power of two of at least 4", core.ErrInvalidSize, size)
+	}
+
+	var best *LigeroPlan
+	for cols := 2; cols < size; cols *= 2 {
+		cfg.Rows, cfg.Cols = size/cols, cols
+		plan, err := PlanLigero(cfg)
+		if err != nil {
+			continue
+		}
+		if best == nil || plan.Cost(objective) < best.Cost(objective) {
+			best = plan
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: no shape of %d coefficients fits LogN %d", core.ErrInvalidSize, size, cfg.LogN)
+	}
+	return best, nil
+}
+
+// NewLigeroCommitterForDegree returns a committer for polynomials of the given degree, with the matrix shape that
+// minimizes objective under the parameters of cfg (its Rows and Cols are ignored). The degree+1 coefficients are
+// padded with zeros up to the next power of two, at least 4, so that both dimensions are powers of two;
+// DensePoly.Matrix lays out the coefficients accordingly.
+func NewLigeroCommitterForDegree(degree int, objective ShapeObjective, cfg PlanConfig) (*LigeroCommitter, error) {
+	if degree < 0 {
+		return nil, fmt.Errorf("%w: degree %d", core.ErrInvalidSize, degree)
+	}
+	size := max(4, 1<<bits.Len(uint(degree)))
+
+	plan, err := RecommendShape(size, cfg, objective)
+	if err != nil {
+		return nil, err
+	}
+	return &LigeroCommitter{LigeroMetadata: plan.LigeroMetadata}, nil
+}
@@ -0,0 +1,185 @@
+package fhe_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+func TestPlanLigero(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		rows, logN, packing int
+	}{
+		{"one segment", 16, LogN, 1},
+		// 80 rows in 32 slots, summed across both rows of slots
+		{"segments", 80, 5, 1},
+		// 4 windows of 8 slots over both rows of 32 slots
+		{"packed", 6, 5, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) { testPlanLigero(t, tc.rows, tc.logN, tc.packing) })
+	}
+}
+
+func testPlanLigero(t *testing.T, rows, logN, packing int) {
+	const cols = 8
+	paramsLiteral, err := fhe.GenerateBGVParamsForNTT(cols, logN, Modulus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, client, ciphertexts := setupSmallLigero(t, rows, cols, packing, true, paramsLiteral)
+	params := *server.GetParameters()
+
+	plan, err := fhe.PlanLigero(fhe.PlanConfig{
+		Rows:             rows,
+		Cols:             cols,
+		RhoInv:           rhoInv,
+		SecurityBits:     128,
+		LogN:             logN,
+		PlaintextModulus: Modulus,
+		Packing:          packing,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ligero, err := fhe.NewLigeroCommitter(128, rows, cols, rhoInv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ligero.Packing = packing
+	commitBackend := server.Scoped()
+	comm, _, err := ligero.Commit(context.Background(), fhe.MemoryStore(ciphertexts), commitBackend, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proveBackend := server.Scoped()
+	proof, err := comm.Prove(context.Background(), core.NewElement(1), proveBackend, core.NewTranscript("test"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshaled, err := proof.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.LigeroMetadata != ligero.LigeroMetadata || plan.Segments != ligero.Segments(params) {
+		t.Fatalf("planned %+v in %d segments, committed with %+v", plan.LigeroMetadata, plan.Segments, ligero.LigeroMetadata)
+	}
+	if plan.CiphertextBytes != ciphertexts[0].BinarySize() {
+		t.Fatalf("planned %d bytes per ciphertext, got %d", plan.CiphertextBytes, ciphertexts[0].BinarySize())
+	}
+	if plan.ProofBytes != len(marshaled) {
+		t.Fatalf("planned a %d byte proof, got %d", plan.ProofBytes, len(marshaled))
+	}
+	if ops := commitBackend.Ops(); plan.CommitOps != ops {
+		t.Fatalf("planned commit operations %+v, got %+v", plan.CommitOps, ops)
+	}
+	ops := proveBackend.Ops()
+	if ops.Rescale > plan.ProveOps.Rescale {
+		t.Fatalf("planned at most %d rescales, got %d", plan.ProveOps.Rescale, ops.Rescale)
+	}
+	ops.Rescale = plan.ProveOps.Rescale
+	if plan.ProveOps != ops {
+		t.Fatalf("planned prove operations %+v, got %+v", plan.ProveOps, ops)
+	}
+
+	kgen := rlwe.NewKeyGenerator(params)
+	sk := client.SecretKey()
+	galoisKeys := kgen.GenGaloisKeysNew(ligero.GaloisElements(params), sk)
+	keysBytes := kgen.GenPublicKeyNew(sk).BinarySize() + kgen.GenRelinearizationKeyNew(sk).BinarySize()
+	for _, key := range galoisKeys {
+		keysBytes += key.BinarySize()
+	}
+	if plan.KeysBytes != keysBytes {
+		t.Fatalf("planned %d bytes of keys, got %d", plan.KeysBytes, keysBytes)
+	}
+}
+
+func TestRecommendShape(t *testing.T) {
+	cfg := fhe.PlanConfig{RhoInv: rhoInv, SecurityBits: 128, LogN: LogN, PlaintextModulus: Modulus}
+	const size = 1 << 12
+
+	best, err := fhe.RecommendShape(size, cfg, fhe.MinimizeProofSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.Rows*best.Cols != size {
+		t.Fatalf("recommended %dx%d for %d coefficients", best.Rows, best.Cols, size)
+	}
+	for c := 2; c < size; c *= 2 {
+		cfg.Rows, cfg.Cols = size/c, c
+		plan, err := fhe.PlanLigero(cfg)
+		if err != nil {
+			continue
+		}
+		if plan.ProofBytes < best.ProofBytes {
+			t.Fatalf("%dx%d has a smaller proof than the recommended %dx%d", plan.Rows, plan.Cols, best.Rows, best.Cols)
+		}
+	}
+
+	if _, err := fhe.RecommendShape(size+1, cfg, fhe.MinimizeProofSize); !errors.Is(err, core.ErrInvalidSize) {
+		t.Fatalf("expected ErrInvalidSize, got %v", err)
+	}
+}
+
+func TestNewLigeroCommitterForDegree(t *testing.T) {
+	cfg := fhe.PlanConfig{RhoInv: rhoInv, SecurityBits: 128, LogN: LogN, PlaintextModulus: Modulus}
+	const degree = 1000 // padded to 1024 coefficients
+
+	for _, objective := range []fhe.ShapeObjective{fhe.MinimizeProofSize, fhe.MinimizeServerTime, fhe.MinimizeClientTime} {
+		t.Run(objective.String(), func(t *testing.T) {
+			ligero, err := fhe.NewLigeroCommitterForDegree(degree, objective, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ligero.Rows*ligero.Cols != 1024 {
+				t.Fatalf("picked %dx%d for degree %d", ligero.Rows, ligero.Cols, degree)
+			}
+
+			chosen := cfg
+			chosen.Rows, chosen.Cols = ligero.Rows, ligero.Cols
+			plan, err := fhe.PlanLigero(chosen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for c := 2; c < 1024; c *= 2 {
+				other := cfg
+				other.Rows, other.Cols = 1024/c, c
+				if otherPlan, err := fhe.PlanLigero(other); err == nil && otherPlan.Cost(objective) < plan.Cost(objective) {
+					t.Fatalf("%dx%d costs less than the picked %dx%d", other.Rows, other.Cols, ligero.Rows, ligero.Cols)
+				}
+			}
+
+			// The padded matrix commits to the same polynomial
+			field, err := core.NewPrimeField(Modulus, 16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			coeffs := make([]*core.Element, degree+1)
+			for i := range coeffs {
+				coeffs[i] = core.NewElement(uint64(i + 1))
+			}
+			poly := core.NewDensePoly(coeffs)
+			matrix, err := poly.Matrix(ligero.Rows, ligero.Cols)
+			if err != nil {
+				t.Fatal(err)
+			}
+			z := core.NewElement(7)
+			if !core.NewDensePolyFromMatrix(matrix).Evaluate(&field, z).Equal(poly.Evaluate(&field, z)) {
+				t.Fatal("padded matrix evaluates differently")
+			}
+		})
+	}
+
+	if _, err := fhe.NewLigeroCommitterForDegree(-1, fhe.MinimizeProofSize, cfg); !errors.Is(err, core.ErrInvalidSize) {
+		t.Fatalf("expected ErrInvalidSize, got %v", err)
+	}
+	if ligero, err := fhe.NewLigeroCommitterForDegree(0, fhe.MinimizeProofSize, cfg); err != nil || ligero.Rows*ligero.Cols != 4 {
+		t.Fatalf("expected a 4 coefficient matrix for a constant, got %v, %v", ligero, err)
+	}
+}
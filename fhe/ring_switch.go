@@ -16,29 +16,11 @@ type RingSwitch struct {
 func NewRingSwitchClient(backend *ClientBFV, logN int) (*RingSwitch, error) {
 	paramsOld := backend.GetParameters()
 	sk := backend.SecretKey()
-	// Crucial to use the same moduli
-	// qs, ps := make([]uint64, len(paramsFHE.Q())), make([]uint64, len(paramsFHE.P()))
-	// for i, qi := range paramsFHE.Q() {
-	// 	qs[i] = qi
-	// }
-	// for i, pi := range paramsFHE.P() {
-	// 	ps[i] = pi
-	// }
-
-	// Only take the first modulus
-	qs := []uint64{paramsOld.Q()[0]}
-	ps := []uint64{}
-
-	paramsLit := bgv.ParametersLiteral{
-		LogN:             logN,
-		Q:                qs,
-		P:                ps,
-		PlaintextModulus: paramsOld.PlaintextModulus(),
-	}
+	paramsLit := RingSwitchParametersLiteral(*paramsOld, logN)
 
 	paramsNew, err := bgv.NewParametersFromLiteral(paramsLit)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	skNew := rlwe.NewKeyGenerator(paramsNew).GenSecretKeyNew()
@@ -56,6 +38,31 @@ func NewRingSwitchClient(backend *ClientBFV, logN int) (*RingSwitch, error) {
 	return &RingSwitch{paramsOld, &paramsNew, skNew, ringSwitchEvk, paramsLit}, nil
 }
 
+// RingSwitchParametersLiteral returns the parameters of ring degree 2^logN that ciphertexts of params are switched to.
+// They only depend on params and logN, so a verifier can derive them from the degree of a ring switched ciphertext.
+func RingSwitchParametersLiteral(params bgv.Parameters, logN int) bgv.ParametersLiteral {
+	// Crucial to use the same moduli
+	// qs, ps := make([]uint64, len(paramsFHE.Q())), make([]uint64, len(paramsFHE.P()))
+	// for i, qi := range paramsFHE.Q() {
+	// 	qs[i] = qi
+	// }
+	// for i, pi := range paramsFHE.P() {
+	// 	ps[i] = pi
+	// }
+
+	// Only take the first two moduli: the second one is consumed when ring switched inner products
+	// are batched for verifiable decryption
+	qs := append([]uint64{}, params.Q()[:min(2, len(params.Q()))]...)
+	ps := []uint64{}
+
+	return bgv.ParametersLiteral{
+		LogN:             logN,
+		Q:                qs,
+		P:                ps,
+		PlaintextModulus: params.PlaintextModulus(),
+	}
+}
+
 func (rs *RingSwitch) NewClient(backend *ClientBFV) *ClientBFV {
 	paramsNew := rs.paramsNew
 	skNew := rs.skNew
@@ -66,6 +73,7 @@ func (rs *RingSwitch) NewClient(backend *ClientBFV) *ClientBFV {
 	return &ClientBFV{
 		ptField:   backend.ptField,
 		paramsFHE: *paramsNew,
+		sk:        skNew,
 		Encoder:   encoder,
 		Encryptor: encryptor,
 		Decryptor: decryptor,
@@ -84,7 +92,7 @@ func (rs *RingSwitch) RingSwitch(ct *rlwe.Ciphertext, backend *ClientBFV) (*rlwe
 		// ct.IsBatched = false
 	}
 	if err := backend.ApplyEvaluationKey(ct, rs.RingSwitchEvk, ct2); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	return ct2, nil
@@ -106,7 +114,7 @@ func NewRingSwitchServer(ringSwitchEvk *rlwe.EvaluationKey, paramsLit bgv.Parame
 func (rs *RingSwitchServer) RingSwitchNew(ct *rlwe.Ciphertext, backend *ServerBFV) (*rlwe.Ciphertext, error) {
 	ct2 := rlwe.NewCiphertext(rs.paramsNew, 1, rs.paramsNew.MaxLevel())
 	if err := backend.ApplyEvaluationKey(ct, rs.ringSwitchEvk, ct2); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	return ct2, nil
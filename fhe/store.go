@@ -0,0 +1,163 @@
+package fhe
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// CiphertextStore holds a fixed number of ciphertexts, such as the columns of a matrix. The Ligero pipeline loads
+// them one at a time, so that a store on disk bounds the memory of proving large matrices.
+// Loading and storing distinct indices concurrently is safe.
+type CiphertextStore interface {
+	Len() int
+	// Load returns ciphertext i, which the caller must not modify.
+	Load(i int) (*rlwe.Ciphertext, error)
+	// Store sets ciphertext i. The store may keep ct, which the caller must not modify afterwards.
+	Store(i int, ct *rlwe.Ciphertext) error
+	// Close releases the resources of the store, which must not be used afterwards.
+	Close() error
+}
+
+// NewStoreFunc creates a store of n ciphertexts.
+type NewStoreFunc func(n int) (CiphertextStore, error)
+
+// MemoryStore is a CiphertextStore in memory.
+type MemoryStore []*rlwe.Ciphertext
+
+// NewMemoryStore is a NewStoreFunc.
+func NewMemoryStore(n int) (CiphertextStore, error) {
+	return make(MemoryStore, n), nil
+}
+
+func (s MemoryStore) Len() int {
+	return len(s)
+}
+
+func (s MemoryStore) Load(i int) (*rlwe.Ciphertext, error) {
+	if i < 0 || i >= len(s) {
+		return nil, fmt.Errorf("%w: ciphertext %d of %d", core.ErrDimensionMismatch, i, len(s))
+	}
+	if s[i] == nil {
+		return nil, fmt.Errorf("%w: ciphertext %d", ErrNotStored, i)
+	}
+	return s[i], nil
+}
+
+func (s MemoryStore) Store(i int, ct *rlwe.Ciphertext) error {
+	if i < 0 || i >= len(s) {
+		return fmt.Errorf("%w: ciphertext %d of %d", core.ErrDimensionMismatch, i, len(s))
+	}
+	s[i] = ct
+	return nil
+}
+
+func (s MemoryStore) Close() error {
+	clear(s)
+	return nil
+}
+
+// FileStore is a CiphertextStore in a temporary file, which it removes on Close. Every ciphertext takes the size of
+// a fresh one at the top level, so that it can be read and written in place.
+type FileStore struct {
+	file   *os.File
+	slot   int64
+	stored []atomic.Bool
+}
+
+// NewFileStore creates a store of n ciphertexts of params in a temporary file in dir, or the default directory for
+// temporary files if dir is empty.
+func NewFileStore(dir string, n int, params bgv.Parameters) (*FileStore, error) {
+	file, err := os.CreateTemp(dir, "lumenos-ciphertexts-*")
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{
+		file:   file,
+		slot:   int64(rlwe.NewCiphertext(params, 1, params.MaxLevel()).BinarySize()),
+		stored: make([]atomic.Bool, n),
+	}
+	// Reserve the file up front, sparsely where the file system allows it
+	if err := file.Truncate(int64(n) * s.slot); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// FileStores returns a NewStoreFunc creating file stores in dir, see NewFileStore.
+func FileStores(dir string, params bgv.Parameters) NewStoreFunc {
+	return func(n int) (CiphertextStore, error) {
+		return NewFileStore(dir, n, params)
+	}
+}
+
+func (s *FileStore) Len() int {
+	return len(s.stored)
+}
+
+func (s *FileStore) Load(i int) (*rlwe.Ciphertext, error) {
+	if i < 0 || i >= len(s.stored) {
+		return nil, fmt.Errorf("%w: ciphertext %d of %d", core.ErrDimensionMismatch, i, len(s.stored))
+	}
+	if !s.stored[i].Load() {
+		return nil, fmt.Errorf("%w: ciphertext %d", ErrNotStored, i)
+	}
+
+	buf := make([]byte, s.slot)
+	if _, err := s.file.ReadAt(buf, int64(i)*s.slot); err != nil {
+		return nil, err
+	}
+	ct := new(rlwe.Ciphertext)
+	if _, err := ct.ReadFrom(bytes.NewReader(buf)); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+func (s *FileStore) Store(i int, ct *rlwe.Ciphertext) error {
+	if i < 0 || i >= len(s.stored) {
+		return fmt.Errorf("%w: ciphertext %d of %d", core.ErrDimensionMismatch, i, len(s.stored))
+	}
+	if size := int64(ct.BinarySize()); size > s.slot {
+		return fmt.Errorf("%w: ciphertext of %d bytes in slots of %d", core.ErrDimensionMismatch, size, s.slot)
+	}
+
+	data, err := ct.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.WriteAt(data, int64(i)*s.slot); err != nil {
+		return err
+	}
+	s.stored[i].Store(true)
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	closeErr := s.file.Close()
+	if err := os.Remove(s.file.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// StoreAll stores cts in a new store made by newStore.
+func StoreAll(cts []*rlwe.Ciphertext, newStore NewStoreFunc) (CiphertextStore, error) {
+	store, err := newStore(len(cts))
+	if err != nil {
+		return nil, err
+	}
+	for i, ct := range cts {
+		if err := store.Store(i, ct); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	return store, nil
+}
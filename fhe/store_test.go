@@ -0,0 +1,81 @@
+package fhe_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+func TestFileStore(t *testing.T) {
+	paramsLiteral, err := fhe.GenerateBGVParamsForNTT(8, 5, Modulus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := bgv.NewParametersFromLiteral(paramsLiteral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kgen := rlwe.NewKeyGenerator(params)
+	sk := kgen.GenSecretKeyNew()
+	encryptor := rlwe.NewEncryptor(params, sk)
+	decryptor := rlwe.NewDecryptor(params, sk)
+	encoder := bgv.NewEncoder(params)
+
+	dir := t.TempDir()
+	store, err := fhe.NewFileStore(dir, 3, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ciphertexts below the top level take less than a slot
+	values := []uint64{1, 2, 3}
+	for i, level := range []int{params.MaxLevel(), 1} {
+		pt := bgv.NewPlaintext(params, level)
+		if err := encoder.Encode(values, pt); err != nil {
+			t.Fatal(err)
+		}
+		ct, err := encryptor.EncryptNew(pt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Store(i, ct); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := store.Load(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Level() != level {
+			t.Fatalf("stored a ciphertext at level %d, loaded level %d", level, loaded.Level())
+		}
+		got := make([]uint64, len(values))
+		if err := encoder.Decode(decryptor.DecryptNew(loaded), got); err != nil {
+			t.Fatal(err)
+		}
+		for j := range values {
+			if got[j] != values[j] {
+				t.Fatalf("ciphertext %d decrypts to %v, expected %v", i, got, values)
+			}
+		}
+	}
+
+	if _, err := store.Load(2); !errors.Is(err, fhe.ErrNotStored) {
+		t.Fatalf("expected ErrNotStored, got %v", err)
+	}
+	if _, err := store.Load(3); !errors.Is(err, core.ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch, got %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("expected the store file to be removed, found %v, %v", entries, err)
+	}
+}
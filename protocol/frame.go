@@ -0,0 +1,258 @@
+// Package protocol defines the binary wire format shared by the lumenos server and client.
+//
+// A stream starts with a 5-byte header (magic and version), followed by frames of the
+// form [uint8 kind][uint64 length][payload]. Lattigo objects are written straight into
+// their frame from BinarySize/WriteTo, so neither side needs to buffer a whole
+// multi-hundred-MB key set in memory.
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// ContentType is the HTTP content type of framed streams.
+	ContentType = "application/x-lumenos-frames"
+
+	// Version is the wire format version, bumped on incompatible changes.
+	Version = 1
+
+	// ChunkSize is the maximum payload of a chunked frame.
+	ChunkSize = 1 << 20
+)
+
+var magic = [4]byte{'L', 'M', 'N', 'S'}
+
+// Kind identifies the content of a frame.
+type Kind uint8
+
+const (
+	KindEnd Kind = iota
+	KindPublicKey
+	KindRelinearizationKey
+	KindGaloisKey
+	KindRingSwitchEvk
+	KindRingSwitchParams
+	KindCiphertext
+	KindValue
+	KindProofChunk
+	KindPoint
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindEnd:
+		return "end"
+	case KindPublicKey:
+		return "public key"
+	case KindRelinearizationKey:
+		return "relinearization key"
+	case KindGaloisKey:
+		return "galois key"
+	case KindRingSwitchEvk:
+		return "ring switch evaluation key"
+	case KindRingSwitchParams:
+		return "ring switch parameters"
+	case KindCiphertext:
+		return "ciphertext"
+	case KindValue:
+		return "value"
+	case KindProofChunk:
+		return "proof chunk"
+	case KindPoint:
+		return "point"
+	default:
+		return fmt.Sprintf("kind(%d)", uint8(k))
+	}
+}
+
+var (
+	ErrBadMagic       = errors.New("protocol: not a lumenos stream")
+	ErrVersion        = errors.New("protocol: unsupported version")
+	ErrUnexpectedKind = errors.New("protocol: unexpected frame")
+	ErrShortObject    = errors.New("protocol: object size does not match frame length")
+)
+
+// Object is a serializable lattigo object such as a key or ciphertext.
+type Object interface {
+	BinarySize() int
+	WriteTo(w io.Writer) (int64, error)
+}
+
+// Writer writes a framed stream.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter writes the stream header to w and returns a frame writer.
+func NewWriter(w io.Writer) (*Writer, error) {
+	fw := &Writer{bufio.NewWriterSize(w, ChunkSize)}
+	if _, err := fw.w.Write(magic[:]); err != nil {
+		return nil, err
+	}
+	if err := fw.w.WriteByte(Version); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+func (fw *Writer) writeHeader(kind Kind, length uint64) error {
+	var header [9]byte
+	header[0] = byte(kind)
+	binary.LittleEndian.PutUint64(header[1:], length)
+	_, err := fw.w.Write(header[:])
+	return err
+}
+
+// WriteBytes writes a frame holding payload.
+func (fw *Writer) WriteBytes(kind Kind, payload []byte) error {
+	if err := fw.writeHeader(kind, uint64(len(payload))); err != nil {
+		return err
+	}
+	_, err := fw.w.Write(payload)
+	return err
+}
+
+// WriteChunked splits payload into frames of at most ChunkSize bytes.
+func (fw *Writer) WriteChunked(kind Kind, payload []byte) error {
+	for len(payload) > 0 {
+		n := min(len(payload), ChunkSize)
+		if err := fw.WriteBytes(kind, payload[:n]); err != nil {
+			return err
+		}
+		payload = payload[n:]
+	}
+	return nil
+}
+
+// WriteUint64 writes a frame holding a little-endian uint64.
+func (fw *Writer) WriteUint64(kind Kind, value uint64) error {
+	var payload [8]byte
+	binary.LittleEndian.PutUint64(payload[:], value)
+	return fw.WriteBytes(kind, payload[:])
+}
+
+// WriteObject streams obj into a single frame.
+func (fw *Writer) WriteObject(kind Kind, obj Object) error {
+	size := obj.BinarySize()
+	if err := fw.writeHeader(kind, uint64(size)); err != nil {
+		return err
+	}
+	n, err := obj.WriteTo(fw.w)
+	if err != nil {
+		return err
+	}
+	if n != int64(size) {
+		return fmt.Errorf("%w: %s wrote %d of %d bytes", ErrShortObject, kind, n, size)
+	}
+	return nil
+}
+
+// Close writes the end frame and flushes the stream. It does not close the underlying writer.
+func (fw *Writer) Close() error {
+	if err := fw.writeHeader(KindEnd, 0); err != nil {
+		return err
+	}
+	return fw.w.Flush()
+}
+
+// Reader reads a framed stream.
+type Reader struct {
+	r       *bufio.Reader
+	payload *io.LimitedReader
+}
+
+// NewReader reads and checks the stream header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	fr := &Reader{r: bufio.NewReaderSize(r, ChunkSize)}
+
+	var header [5]byte
+	if _, err := io.ReadFull(fr.r, header[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], magic[:]) {
+		return nil, ErrBadMagic
+	}
+	if header[4] != Version {
+		return nil, fmt.Errorf("%w: %d", ErrVersion, header[4])
+	}
+	return fr, nil
+}
+
+// Next advances to the next frame, discarding any unread payload of the current one.
+func (fr *Reader) Next() (Kind, error) {
+	if fr.payload != nil && fr.payload.N > 0 {
+		if _, err := io.Copy(io.Discard, fr.payload); err != nil {
+			return 0, err
+		}
+	}
+
+	var header [9]byte
+	if _, err := io.ReadFull(fr.r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+
+	fr.payload = &io.LimitedReader{R: fr.r, N: int64(binary.LittleEndian.Uint64(header[1:]))}
+	return Kind(header[0]), nil
+}
+
+// Expect advances to the next frame and checks that it is of the given kind.
+func (fr *Reader) Expect(kind Kind) error {
+	got, err := fr.Next()
+	if err != nil {
+		return err
+	}
+	if got != kind {
+		return fmt.Errorf("%w: got %s, expected %s", ErrUnexpectedKind, got, kind)
+	}
+	return nil
+}
+
+// Len returns the number of unread payload bytes of the current frame.
+func (fr *Reader) Len() int64 {
+	if fr.payload == nil {
+		return 0
+	}
+	return fr.payload.N
+}
+
+// Read reads from the payload of the current frame.
+func (fr *Reader) Read(p []byte) (int, error) {
+	if fr.payload == nil {
+		return 0, io.EOF
+	}
+	return fr.payload.Read(p)
+}
+
+// ReadBytes reads the whole payload of the current frame.
+func (fr *Reader) ReadBytes() ([]byte, error) {
+	return io.ReadAll(fr)
+}
+
+// ReadObject reads the current frame into obj, which must consume the whole payload.
+func (fr *Reader) ReadObject(obj io.ReaderFrom) error {
+	if _, err := obj.ReadFrom(fr); err != nil {
+		return err
+	}
+	if fr.Len() != 0 {
+		return fmt.Errorf("%w: %d bytes left", ErrShortObject, fr.Len())
+	}
+	return nil
+}
+
+// ReadUint64 decodes the current frame as a little-endian uint64.
+func (fr *Reader) ReadUint64() (uint64, error) {
+	var value uint64
+	if err := binary.Read(fr, binary.LittleEndian, &value); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
@@ -0,0 +1,195 @@
+package protocol_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/nulltea/lumenos/protocol"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+func testParams(t *testing.T) bgv.Parameters {
+	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             10,
+		LogQ:             []int{40, 40},
+		LogP:             []int{45},
+		PlaintextModulus: 65537,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+func TestKeysRoundTrip(t *testing.T) {
+	params := testParams(t)
+
+	kgen := rlwe.NewKeyGenerator(params)
+	sk, pk := kgen.GenKeyPairNew()
+	keys := &protocol.Keys{
+		PublicKey:          pk,
+		RelinearizationKey: kgen.GenRelinearizationKeyNew(sk),
+		GaloisKeys:         kgen.GenGaloisKeysNew(params.GaloisElementsForInnerSum(1, 4), sk),
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := protocol.WriteKeys(buf, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := protocol.ReadKeys(buf, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.PublicKey.Equal(keys.PublicKey) {
+		t.Error("public key mismatch")
+	}
+	if !got.RelinearizationKey.Equal(&keys.RelinearizationKey.GadgetCiphertext) {
+		t.Error("relinearization key mismatch")
+	}
+	if len(got.GaloisKeys) != len(keys.GaloisKeys) {
+		t.Fatalf("got %d galois keys, expected %d", len(got.GaloisKeys), len(keys.GaloisKeys))
+	}
+	for i := range keys.GaloisKeys {
+		if !got.GaloisKeys[i].Equal(&keys.GaloisKeys[i].GadgetCiphertext) {
+			t.Errorf("galois key %d mismatch", i)
+		}
+	}
+	if got.RingSwitchParams != nil || got.RingSwitchEvk != nil {
+		t.Error("unexpected ring switch keys")
+	}
+}
+
+func TestWitnessRoundTrip(t *testing.T) {
+	params := testParams(t)
+
+	kgen := rlwe.NewKeyGenerator(params)
+	encryptor := rlwe.NewEncryptor(params, kgen.GenSecretKeyNew())
+
+	columns := make([]*rlwe.Ciphertext, 3)
+	for i := range columns {
+		columns[i] = rlwe.NewCiphertext(params, 1, params.MaxLevel())
+		if err := encryptor.EncryptZero(columns[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := protocol.WriteWitness(buf, columns); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := protocol.ReadWitness(buf, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(columns) {
+		t.Fatalf("got %d columns, expected %d", len(got), len(columns))
+	}
+	for i := range columns {
+		if !got[i].Equal(columns[i]) {
+			t.Errorf("column %d mismatch", i)
+		}
+	}
+}
+
+func TestProofRoundTrip(t *testing.T) {
+	value := uint64(42)
+	payload := make([]byte, 2*protocol.ChunkSize+3)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := protocol.WriteProof(buf, &protocol.Proof{Value: &value, EncryptedProof: payload}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := protocol.ReadProof(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Value == nil || *got.Value != value {
+		t.Errorf("got value %v, expected %d", got.Value, value)
+	}
+	if !bytes.Equal(got.EncryptedProof, payload) {
+		t.Error("encrypted proof mismatch")
+	}
+}
+
+func TestOpeningsRoundTrip(t *testing.T) {
+	value := uint64(42)
+	openings := []*protocol.Opening{
+		{Point: 3, Proof: protocol.Proof{Value: &value, EncryptedProof: make([]byte, protocol.ChunkSize+1)}},
+		{Point: 5, Proof: protocol.Proof{EncryptedProof: []byte{1, 2, 3}}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := protocol.WriteOpenings(buf, openings); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := protocol.ReadOpenings(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(openings) {
+		t.Fatalf("got %d openings, expected %d", len(got), len(openings))
+	}
+	for i, opening := range openings {
+		if got[i].Point != opening.Point {
+			t.Errorf("opening %d: got point %d, expected %d", i, got[i].Point, opening.Point)
+		}
+		if (got[i].Value == nil) != (opening.Value == nil) || (opening.Value != nil && *got[i].Value != *opening.Value) {
+			t.Errorf("opening %d: got value %v, expected %v", i, got[i].Value, opening.Value)
+		}
+		if !bytes.Equal(got[i].EncryptedProof, opening.EncryptedProof) {
+			t.Errorf("opening %d: encrypted proof mismatch", i)
+		}
+	}
+
+	// A proof without its point is rejected
+	buf.Reset()
+	if err := protocol.WriteProof(buf, &openings[1].Proof); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := protocol.ReadOpenings(buf); !errors.Is(err, protocol.ErrUnexpectedKind) {
+		t.Fatalf("got %v, expected %v", err, protocol.ErrUnexpectedKind)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	if _, err := protocol.ReadProof(bytes.NewBufferString("JSON{}")); !errors.Is(err, protocol.ErrBadMagic) {
+		t.Errorf("got %v, expected %v", err, protocol.ErrBadMagic)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	fw, err := protocol.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.WriteBytes(protocol.KindCiphertext, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := protocol.ReadProof(buf); !errors.Is(err, protocol.ErrUnexpectedKind) {
+		t.Errorf("got %v, expected %v", err, protocol.ErrUnexpectedKind)
+	}
+
+	// Truncated stream
+	buf.Reset()
+	if err := protocol.WriteProof(buf, &protocol.Proof{EncryptedProof: []byte{1, 2, 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := protocol.ReadProof(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("expected error for truncated stream")
+	}
+}
@@ -0,0 +1,33 @@
+package protocol
+
+// Job states reported by the jobs endpoints.
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// Phase states reported by the jobs endpoints.
+const (
+	PhasePending = "pending"
+	PhaseRunning = "running"
+	PhaseDone    = "done"
+)
+
+type PhaseStatus struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// JobStatus is the JSON body returned by POST /jobs, GET /jobs/{id} and DELETE /jobs/{id}.
+type JobStatus struct {
+	ID     string        `json:"id"`
+	State  string        `json:"state"`
+	Point  uint64        `json:"point"`
+	Phase  string        `json:"phase,omitempty"`
+	Phases []PhaseStatus `json:"phases"`
+	Error  string        `json:"error,omitempty"`
+}
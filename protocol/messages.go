@@ -0,0 +1,320 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// HTTP endpoints served by cmd/server.
+const (
+	PathParams  = "/params"
+	PathKeys    = "/keys"
+	PathWitness = "/witness"
+	PathProve   = "/prove"
+	PathJobs    = "/jobs"
+	PathCommit  = "/commit"
+	PathOpen    = "/open"
+)
+
+// TranscriptLabel is the Fiat-Shamir transcript label shared by the prover and the verifier.
+const TranscriptLabel = "demo"
+
+// Keys is the evaluation key material uploaded by the client.
+type Keys struct {
+	PublicKey          *rlwe.PublicKey
+	RelinearizationKey *rlwe.RelinearizationKey
+	GaloisKeys         []*rlwe.GaloisKey
+
+	// RingSwitchEvk and RingSwitchParams are set when the client requests
+	// inner products to be ring switched to smaller parameters.
+	RingSwitchEvk    *rlwe.EvaluationKey
+	RingSwitchParams *bgv.ParametersLiteral
+}
+
+// WriteKeys streams keys to w.
+func WriteKeys(w io.Writer, keys *Keys) error {
+	fw, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	if err := fw.WriteObject(KindPublicKey, keys.PublicKey); err != nil {
+		return err
+	}
+	if err := fw.WriteObject(KindRelinearizationKey, keys.RelinearizationKey); err != nil {
+		return err
+	}
+	for _, key := range keys.GaloisKeys {
+		if err := fw.WriteObject(KindGaloisKey, key); err != nil {
+			return err
+		}
+	}
+
+	if keys.RingSwitchParams != nil {
+		paramsLit, err := json.Marshal(keys.RingSwitchParams)
+		if err != nil {
+			return err
+		}
+		if err := fw.WriteBytes(KindRingSwitchParams, paramsLit); err != nil {
+			return err
+		}
+		if err := fw.WriteObject(KindRingSwitchEvk, keys.RingSwitchEvk); err != nil {
+			return err
+		}
+	}
+
+	return fw.Close()
+}
+
+// ReadKeys reads keys for params from r. Each key is decoded as it arrives.
+func ReadKeys(r io.Reader, params bgv.Parameters) (*Keys, error) {
+	fr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &Keys{}
+	for {
+		kind, err := fr.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case KindEnd:
+			if keys.PublicKey == nil || keys.RelinearizationKey == nil {
+				return nil, errors.New("protocol: public and relinearization keys are required")
+			}
+			if (keys.RingSwitchParams == nil) != (keys.RingSwitchEvk == nil) {
+				return nil, errors.New("protocol: ring switch requires both parameters and evaluation key")
+			}
+			return keys, nil
+		case KindPublicKey:
+			keys.PublicKey = rlwe.NewPublicKey(params)
+			err = fr.ReadObject(keys.PublicKey)
+		case KindRelinearizationKey:
+			keys.RelinearizationKey = rlwe.NewRelinearizationKey(params)
+			err = fr.ReadObject(keys.RelinearizationKey)
+		case KindGaloisKey:
+			key := rlwe.NewGaloisKey(params)
+			err = fr.ReadObject(key)
+			keys.GaloisKeys = append(keys.GaloisKeys, key)
+		case KindRingSwitchParams:
+			var paramsLit []byte
+			if paramsLit, err = fr.ReadBytes(); err == nil {
+				keys.RingSwitchParams = &bgv.ParametersLiteral{}
+				err = json.Unmarshal(paramsLit, keys.RingSwitchParams)
+			}
+		case KindRingSwitchEvk:
+			keys.RingSwitchEvk = rlwe.NewEvaluationKey(params)
+			err = fr.ReadObject(keys.RingSwitchEvk)
+		default:
+			err = fmt.Errorf("%w: %s in key upload", ErrUnexpectedKind, kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", kind, err)
+		}
+	}
+}
+
+// WriteWitness streams the encrypted witness columns to w.
+func WriteWitness(w io.Writer, columns []*rlwe.Ciphertext) error {
+	fw, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	for _, ct := range columns {
+		if err := fw.WriteObject(KindCiphertext, ct); err != nil {
+			return err
+		}
+	}
+
+	return fw.Close()
+}
+
+// ReadWitness reads encrypted witness columns for params from r.
+func ReadWitness(r io.Reader, params bgv.Parameters) ([]*rlwe.Ciphertext, error) {
+	fr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []*rlwe.Ciphertext
+	for {
+		kind, err := fr.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case KindEnd:
+			return columns, nil
+		case KindCiphertext:
+			ct := rlwe.NewCiphertext(params, 1, params.MaxLevel())
+			if err := fr.ReadObject(ct); err != nil {
+				return nil, fmt.Errorf("invalid witness column %d: %w", len(columns), err)
+			}
+			columns = append(columns, ct)
+		default:
+			return nil, fmt.Errorf("%w: %s in witness upload", ErrUnexpectedKind, kind)
+		}
+	}
+}
+
+// Proof is the response to a proving request.
+type Proof struct {
+	// Value is the evaluation claimed by the server. It is only known when
+	// the server generated the witness itself.
+	Value *uint64
+
+	// EncryptedProof is the marshaled fhe.EncryptedProof.
+	EncryptedProof []byte
+}
+
+// WriteProof streams the proof to w, splitting the encrypted proof into chunks.
+func WriteProof(w io.Writer, proof *Proof) error {
+	fw, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	if err := writeProofFrames(fw, proof); err != nil {
+		return err
+	}
+
+	return fw.Close()
+}
+
+func writeProofFrames(fw *Writer, proof *Proof) error {
+	if proof.Value != nil {
+		if err := fw.WriteUint64(KindValue, *proof.Value); err != nil {
+			return err
+		}
+	}
+	return fw.WriteChunked(KindProofChunk, proof.EncryptedProof)
+}
+
+// ReadProof reads a proof from r, reassembling the encrypted proof from its chunks.
+func ReadProof(r io.Reader) (*Proof, error) {
+	fr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &Proof{}
+	encryptedProof := bytes.NewBuffer(nil)
+	for {
+		kind, err := fr.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case KindEnd:
+			proof.EncryptedProof = encryptedProof.Bytes()
+			return proof, nil
+		case KindValue:
+			value, err := fr.ReadUint64()
+			if err != nil {
+				return nil, err
+			}
+			proof.Value = &value
+		case KindProofChunk:
+			if _, err := encryptedProof.ReadFrom(fr); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s in proof download", ErrUnexpectedKind, kind)
+		}
+	}
+}
+
+// Commitment is the JSON body returned by POST /commit.
+type Commitment struct {
+	// Root is the Merkle root of the encoded matrix, which every proof opening the commitment carries.
+	Root []byte `json:"root"`
+}
+
+// Opening is a proof of the committed polynomial at Point, in the response to POST /open.
+type Opening struct {
+	Point uint64
+	Proof
+}
+
+// WriteOpenings streams the openings to w in order, each starting with its point.
+func WriteOpenings(w io.Writer, openings []*Opening) error {
+	fw, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	for _, opening := range openings {
+		if err := fw.WriteUint64(KindPoint, opening.Point); err != nil {
+			return err
+		}
+		if err := writeProofFrames(fw, &opening.Proof); err != nil {
+			return err
+		}
+	}
+
+	return fw.Close()
+}
+
+// ReadOpenings reads openings from r, reassembling each encrypted proof from its chunks.
+func ReadOpenings(r io.Reader) ([]*Opening, error) {
+	fr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var openings []*Opening
+	var encryptedProof *bytes.Buffer
+	// finish completes the opening read so far
+	finish := func() {
+		if len(openings) > 0 {
+			openings[len(openings)-1].EncryptedProof = encryptedProof.Bytes()
+		}
+	}
+	for {
+		kind, err := fr.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if kind != KindEnd && kind != KindPoint && len(openings) == 0 {
+			return nil, fmt.Errorf("%w: %s before the first point", ErrUnexpectedKind, kind)
+		}
+		switch kind {
+		case KindEnd:
+			finish()
+			return openings, nil
+		case KindPoint:
+			finish()
+			point, err := fr.ReadUint64()
+			if err != nil {
+				return nil, err
+			}
+			openings = append(openings, &Opening{Point: point})
+			encryptedProof = bytes.NewBuffer(nil)
+		case KindValue:
+			value, err := fr.ReadUint64()
+			if err != nil {
+				return nil, err
+			}
+			openings[len(openings)-1].Value = &value
+		case KindProofChunk:
+			if _, err := encryptedProof.ReadFrom(fr); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s in openings download", ErrUnexpectedKind, kind)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package protocol
+
+import (
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// LigeroParams describes the committed matrix and the Ligero code.
+type LigeroParams struct {
+	Rows         int     `json:"rows"`
+	Cols         int     `json:"cols"`
+	RhoInv       int     `json:"rho_inv"`
+	Queries      int     `json:"queries"`
+	SecurityBits float64 `json:"security_bits"`
+	// Packing is the number of columns per witness ciphertext, see fhe.LigeroMetadata.Window.
+	Packing int `json:"packing,omitempty"`
+}
+
+// Params is the JSON body returned by GET /params. Clients derive their
+// FHE parameters and evaluation keys from it.
+type Params struct {
+	BGV    bgv.ParametersLiteral `json:"bgv"`
+	Ligero LigeroParams          `json:"ligero"`
+
+	// GaloisElements are the elements the uploaded Galois keys must cover.
+	GaloisElements []uint64 `json:"galois_elements"`
+}
@@ -26,7 +26,7 @@ echo ""
 echo "Building.."
 # Suppress CGO C compiler warnings
 export CGO_CFLAGS="-w"
-make build IS_GBFV=$IS_GBFV 2>/dev/null || make build IS_GBFV=$IS_GBFV
+make build 2>/dev/null || make build
 
 # Create results directory
 mkdir -p $RESULTS_DIR/client
@@ -81,7 +81,7 @@ for config in "${CONFIGURATIONS[@]}"; do
     } > "$OUTPUT_FILE"
     
     # Build client command
-    CLIENT_CMD="go run -ldflags='-w -s' cmd/client/main.go -rows $ROWS -cols $COLS -logN $LOGN -server $REMOTE_SERVER_URL"
+    CLIENT_CMD="go run -tags lazer -ldflags='-w -s' cmd/client/main.go -rows $ROWS -cols $COLS -logN $LOGN -server $REMOTE_SERVER_URL"
     
     if [ "$VDEC" = "true" ]; then
         CLIENT_CMD="$CLIENT_CMD -vdec"
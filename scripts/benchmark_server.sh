@@ -78,7 +78,7 @@ for config in "${CONFIGURATIONS[@]}"; do
     } > "$OUTPUT_FILE"
     
     # Build server command
-    SERVER_CMD="go run -ldflags='-w -s' cmd/server/main.go -rows $ROWS -cols $COLS -logN $LOGN -benchMode=true -port=8080"
+    SERVER_CMD="go run -ldflags='-w -s' ./cmd/server -rows $ROWS -cols $COLS -logN $LOGN -benchMode=true -port=8080"
     
     echo "Running server command: $SERVER_CMD"
     
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// keyDigest identifies the public key a checkpointed commitment was made under, since only the client holding its
+// secret key can decrypt the proofs opening it.
+func keyDigest(pk *rlwe.PublicKey) ([]byte, error) {
+	data, err := pk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	return digest[:], nil
+}
+
+// checkpoint writes comm to Config.Checkpoint, after the digest of the public key it was made under. The previous
+// checkpoint is only replaced once the new one is written in full.
+func (s *Server) checkpoint(comm *commitment, digest []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(s.cfg.Checkpoint), filepath.Base(s.cfg.Checkpoint)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(digest)
+	if err == nil {
+		err = comm.prover.Checkpoint(f)
+	}
+	if err = errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.cfg.Checkpoint)
+}
+
+// resume reopens the commitment in Config.Checkpoint for backend, whose public key has the given digest. It returns
+// nil if there is no checkpoint, or if it was made under other keys.
+func (s *Server) resume(ctx context.Context, backend *fhe.ServerBFV, digest []byte) (*commitment, error) {
+	f, err := os.Open(s.cfg.Checkpoint)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	checkpointed := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(f, checkpointed); err != nil {
+		return nil, fmt.Errorf("%w: %w", fhe.ErrCorruptCheckpoint, err)
+	}
+	if !bytes.Equal(checkpointed, digest) {
+		return nil, nil
+	}
+
+	prover, err := fhe.ResumeLigeroProver(ctx, f, backend, s.newStore)
+	if err != nil {
+		return nil, err
+	}
+	if prover.Committer.LigeroMetadata != s.ligero.LigeroMetadata {
+		err := fmt.Errorf("checkpoint commits to %+v, the server is configured for %+v", prover.Committer.LigeroMetadata, s.ligero.LigeroMetadata)
+		return nil, errors.Join(err, prover.Close())
+	}
+
+	comm := &commitment{prover: prover, server: backend}
+	comm.refs.Store(1)
+	return comm, nil
+}
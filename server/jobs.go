@@ -0,0 +1,375 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/protocol"
+)
+
+// jobPhases are the proving phases reported to clients, in pipeline order.
+var jobPhases = []string{"encode", "commit", "inner product", "query", "marshal"}
+
+// spanPhases maps span names of the proving pipeline to the phase they belong to.
+var spanPhases = map[string]string{
+	"Encode":                  "encode",
+	"Merkle tree built":       "commit",
+	"InnerProduct(Matrix, r)": "inner product",
+	"InnerProduct(Matrix, b)": "inner product",
+	"Query columns":           "query",
+	"Marshal proof":           "marshal",
+}
+
+// proveFunc runs the proving pipeline under the given root span.
+type proveFunc func(ctx context.Context, span *core.Span) (*protocol.Proof, error)
+
+// Job is an asynchronous proving job. It observes the span tree of its
+// pipeline to report per-phase progress.
+type Job struct {
+	mu      sync.Mutex
+	id      string
+	point   uint64
+	state   string
+	phases  []protocol.PhaseStatus
+	active  map[string]int
+	started map[string]time.Time
+	proof   *protocol.Proof
+	err     error
+	// finished is when the job stopped, zero while it is queued or running
+	finished time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	prove  proveFunc
+	done   chan struct{}
+}
+
+func newJob(point uint64, prove proveFunc) (*Job, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	phases := make([]protocol.PhaseStatus, len(jobPhases))
+	for i, name := range jobPhases {
+		phases[i] = protocol.PhaseStatus{Name: name, State: protocol.PhasePending}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Job{
+		id:      hex.EncodeToString(id),
+		point:   point,
+		state:   protocol.JobQueued,
+		phases:  phases,
+		active:  make(map[string]int),
+		started: make(map[string]time.Time),
+		ctx:     ctx,
+		cancel:  cancel,
+		prove:   prove,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Done returns a channel that is closed once the job has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Status returns a snapshot of the job's state and phase progress.
+func (j *Job) Status() protocol.JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := protocol.JobStatus{
+		ID:     j.id,
+		State:  j.state,
+		Point:  j.point,
+		Phases: make([]protocol.PhaseStatus, len(j.phases)),
+	}
+	copy(status.Phases, j.phases)
+	for _, phase := range j.phases {
+		if phase.State == protocol.PhaseRunning {
+			status.Phase = phase.Name
+		}
+	}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	return status
+}
+
+// Result returns the proof of a finished job.
+func (j *Job) Result() (*protocol.Proof, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.proof, j.state == protocol.JobDone
+}
+
+func (j *Job) phase(name string) *protocol.PhaseStatus {
+	for i := range j.phases {
+		if j.phases[i].Name == name {
+			return &j.phases[i]
+		}
+	}
+	return nil
+}
+
+func (j *Job) SpanStarted(span *core.Span) {
+	name, ok := spanPhases[span.Name()]
+	if !ok {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.active[name] == 0 {
+		j.started[name] = time.Now()
+	}
+	j.active[name]++
+	j.phase(name).State = protocol.PhaseRunning
+}
+
+func (j *Job) SpanEnded(span *core.Span, _ time.Duration) {
+	name, ok := spanPhases[span.Name()]
+	if !ok {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// Spans may be ended more than once on error paths.
+	if j.active[name] == 0 {
+		return
+	}
+	j.active[name]--
+	if j.active[name] == 0 {
+		phase := j.phase(name)
+		phase.State = protocol.PhaseDone
+		phase.Duration = time.Since(j.started[name]).String()
+	}
+}
+
+func (j *Job) setState(state string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state = state
+}
+
+func (j *Job) finish(proof *protocol.Proof, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.state = protocol.JobCanceled
+	case err != nil:
+		j.state = protocol.JobFailed
+		j.err = err
+	default:
+		j.state = protocol.JobDone
+		j.proof = proof
+	}
+	j.prove = nil
+	j.finished = time.Now()
+	j.cancel()
+	close(j.done)
+}
+
+// finishedAt returns when the job stopped, and false if it has not yet.
+func (j *Job) finishedAt() (time.Time, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.finished, !j.finished.IsZero()
+}
+
+func (j *Job) run() {
+	if err := j.ctx.Err(); err != nil {
+		j.finish(nil, err)
+		return
+	}
+
+	j.setState(protocol.JobRunning)
+	span := core.StartObservedSpan("Prove job", j)
+	proof, err := j.prove(j.ctx, span)
+	span.End()
+	j.finish(proof, err)
+}
+
+const (
+	// maxQueuedJobs bounds the number of jobs waiting for the prover.
+	maxQueuedJobs = 64
+	// maxFinishedJobs bounds the number of finished jobs, and their proofs, kept for clients to fetch.
+	maxFinishedJobs = 64
+	// jobTTL is how long a finished job is kept before it is evicted.
+	jobTTL = 30 * time.Minute
+)
+
+// JobManager runs proving jobs one at a time in submission order, since
+// the FHE backend is shared by all jobs of the session. Finished jobs are
+// evicted once they are older than ttl, or past the maxFinished most recent.
+type JobManager struct {
+	mu          sync.Mutex
+	jobs        map[string]*Job
+	queue       chan *Job
+	ttl         time.Duration
+	maxFinished int
+	// closed is set by Shutdown, after which no job is accepted
+	closed bool
+	// stop is closed by Shutdown to stop the worker, which closes stopped once it has returned
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func NewJobManager() *JobManager {
+	m := &JobManager{
+		jobs:        make(map[string]*Job),
+		queue:       make(chan *Job, maxQueuedJobs),
+		ttl:         jobTTL,
+		maxFinished: maxFinishedJobs,
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go m.work()
+	return m
+}
+
+// work runs the queued jobs and evicts the finished ones until the manager is shut down.
+func (m *JobManager) work() {
+	defer close(m.stopped)
+	sweep := time.NewTicker(m.ttl / 2)
+	defer sweep.Stop()
+	for {
+		select {
+		case job := <-m.queue:
+			job.run()
+		case <-sweep.C:
+		case <-m.stop:
+			// The jobs left in the queue were cancelled by Shutdown, running them only finishes them.
+			for {
+				select {
+				case job := <-m.queue:
+					job.run()
+				default:
+					return
+				}
+			}
+		}
+		m.evict(time.Now())
+	}
+}
+
+// Shutdown stops accepting jobs, cancels the queued and running ones, and
+// waits for the worker to stop or for ctx to be done.
+func (m *JobManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		for _, job := range m.jobs {
+			job.cancel()
+		}
+		close(m.stop)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-m.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// evict removes the finished jobs that expired by now, then the oldest
+// finished jobs past the cap.
+func (m *JobManager) evict(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type finishedJob struct {
+		id string
+		at time.Time
+	}
+	var finished []finishedJob
+	for id, job := range m.jobs {
+		at, ok := job.finishedAt()
+		switch {
+		case !ok:
+		case now.Sub(at) > m.ttl:
+			delete(m.jobs, id)
+		default:
+			finished = append(finished, finishedJob{id, at})
+		}
+	}
+
+	if len(finished) <= m.maxFinished {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].at.Before(finished[j].at) })
+	for _, job := range finished[:len(finished)-m.maxFinished] {
+		delete(m.jobs, job.id)
+	}
+}
+
+// Submit enqueues a proving job for point and returns immediately.
+func (m *JobManager) Submit(point uint64, prove proveFunc) (*Job, error) {
+	job, err := newJob(point, prove)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		job.cancel()
+		return nil, errors.New("job manager is shut down")
+	}
+	select {
+	case m.queue <- job:
+	default:
+		job.cancel()
+		return nil, errors.New("job queue is full")
+	}
+	m.jobs[job.id] = job
+
+	return job, nil
+}
+
+func (m *JobManager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// Cancel stops a queued or running job. Jobs that have already finished
+// are removed, releasing their proof.
+func (m *JobManager) Cancel(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+
+	select {
+	case <-job.done:
+		delete(m.jobs, id)
+	default:
+		job.cancel()
+	}
+	return job, true
+}
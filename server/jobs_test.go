@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/protocol"
+)
+
+func TestJobPhases(t *testing.T) {
+	jobs := NewJobManager()
+
+	job, err := jobs.Submit(1, func(ctx context.Context, parent *core.Span) (*protocol.Proof, error) {
+		for _, name := range []string{"Encode", "Merkle tree built", "InnerProduct(Matrix, r)", "Query columns", "Marshal proof"} {
+			span := core.StartSpan(name, parent)
+			span.End()
+		}
+		value := uint64(42)
+		return &protocol.Proof{Value: &value, EncryptedProof: []byte{1, 2, 3}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-job.Done()
+
+	status := job.Status()
+	if status.State != protocol.JobDone {
+		t.Fatalf("job state = %s, expected %s", status.State, protocol.JobDone)
+	}
+	for _, phase := range status.Phases {
+		if phase.State != protocol.PhaseDone {
+			t.Errorf("phase %s state = %s, expected %s", phase.Name, phase.State, protocol.PhaseDone)
+		}
+	}
+
+	proof, ok := job.Result()
+	if !ok || *proof.Value != 42 || len(proof.EncryptedProof) != 3 {
+		t.Fatalf("unexpected result: proof=%+v, ok=%v", proof, ok)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	jobs := NewJobManager()
+
+	running := make(chan struct{})
+	job, err := jobs.Submit(1, func(ctx context.Context, parent *core.Span) (*protocol.Proof, error) {
+		span := core.StartSpan("Encode", parent)
+		defer span.End()
+		close(running)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queued behind the running job, must be cancelled without ever starting.
+	queued, err := jobs.Submit(2, func(ctx context.Context, parent *core.Span) (*protocol.Proof, error) {
+		t.Error("queued job should not run after cancellation")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-running
+	if phase := job.Status().Phase; phase != "encode" {
+		t.Fatalf("current phase = %q, expected %q", phase, "encode")
+	}
+
+	jobs.Cancel(queued.ID())
+	jobs.Cancel(job.ID())
+
+	for _, j := range []*Job{job, queued} {
+		select {
+		case <-j.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("job %s was not cancelled", j.ID())
+		}
+		if state := j.Status().State; state != protocol.JobCanceled {
+			t.Errorf("job %s state = %s, expected %s", j.ID(), state, protocol.JobCanceled)
+		}
+	}
+
+	// Cancelling a finished job removes it.
+	jobs.Cancel(job.ID())
+	if _, ok := jobs.Get(job.ID()); ok {
+		t.Fatal("finished job was not removed")
+	}
+}
+
+func TestJobShutdown(t *testing.T) {
+	jobs := NewJobManager()
+
+	running := make(chan struct{})
+	job, err := jobs.Submit(1, func(ctx context.Context, parent *core.Span) (*protocol.Proof, error) {
+		close(running)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, err := jobs.Submit(2, func(ctx context.Context, parent *core.Span) (*protocol.Proof, error) {
+		t.Error("queued job should not run after shutdown")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-running
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := jobs.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range []*Job{job, queued} {
+		select {
+		case <-j.Done():
+		default:
+			t.Fatalf("job %s did not finish by shutdown", j.ID())
+		}
+		if state := j.Status().State; state != protocol.JobCanceled {
+			t.Errorf("job %s state = %s, expected %s", j.ID(), state, protocol.JobCanceled)
+		}
+	}
+
+	if _, err := jobs.Submit(3, nil); err == nil {
+		t.Fatal("job was accepted after shutdown")
+	}
+	// Shutting down again returns at once.
+	if err := jobs.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobEviction(t *testing.T) {
+	jobs := NewJobManager()
+	jobs.maxFinished = 2
+
+	var submitted []*Job
+	for point := range uint64(3) {
+		job, err := jobs.Submit(point, func(ctx context.Context, parent *core.Span) (*protocol.Proof, error) {
+			return &protocol.Proof{EncryptedProof: []byte{1}}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-job.Done()
+		submitted = append(submitted, job)
+	}
+
+	// Past the cap, the oldest finished job is evicted.
+	jobs.evict(time.Now())
+	if _, ok := jobs.Get(submitted[0].ID()); ok {
+		t.Error("oldest finished job was not evicted past the cap")
+	}
+	for _, job := range submitted[1:] {
+		if _, ok := jobs.Get(job.ID()); !ok {
+			t.Errorf("job %s was evicted within the cap", job.ID())
+		}
+	}
+
+	// Once expired, every finished job is evicted.
+	jobs.evict(time.Now().Add(jobs.ttl + time.Second))
+	for _, job := range submitted {
+		if _, ok := jobs.Get(job.ID()); ok {
+			t.Errorf("job %s was not evicted after its TTL", job.ID())
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/protocol"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// prove runs the proving pipeline, reporting its phases under parentSpan: it commits as
+// commit does and opens the commitment at z.
+// Cancelling ctx aborts the pipeline.
+func (s *Server) prove(ctx context.Context, backend *fhe.ServerBFV, witness []*rlwe.Ciphertext, z *core.Element, parentSpan *core.Span) (*protocol.Proof, error) {
+	parentSpan.SetAttribute("rows", s.cfg.Rows)
+	parentSpan.SetAttribute("cols", s.cfg.Cols)
+	parentSpan.SetAttribute("logN", s.params.LogN())
+	// Count the operations of this proof apart from earlier jobs
+	backend = backend.Scoped()
+
+	comm, err := s.commit(ctx, backend, witness, parentSpan)
+	if err != nil {
+		return nil, err
+	}
+	defer comm.Close()
+
+	proof, err := comm.open(ctx, z, parentSpan)
+	if err != nil {
+		return nil, err
+	}
+
+	backend.Ops().Attributes(parentSpan)
+
+	return proof, nil
+}
+
+// commitment is a committed matrix that can be opened at any number of points.
+type commitment struct {
+	prover *fhe.LigeroProver
+	server *fhe.ServerBFV
+	// matrix is the random matrix the server committed to when no witness was uploaded, nil otherwise
+	matrix [][]*core.Element
+	// spilled is set when the matrix was copied to a store of its own, released on Close
+	spilled bool
+	// refs counts the holders of a commitment shared by POST /commit and /open; it is closed when the last one
+	// releases it
+	refs atomic.Int32
+}
+
+// commit commits to the uploaded witness when given, otherwise to a random matrix it encrypts with the configured
+// packing, under backend's keys. The matrix and its encoding are kept in stores in Config.SpillDir,
+// or in memory if unset. Cancelling ctx aborts the commitment.
+func (s *Server) commit(ctx context.Context, backend *fhe.ServerBFV, witness []*rlwe.Ciphertext, parentSpan *core.Span) (*commitment, error) {
+	ligero, err := fhe.NewLigeroCommitter(SecurityBits, s.cfg.Rows, s.cfg.Cols, RhoInv)
+	if err != nil {
+		return nil, err
+	}
+	ligero.Packing = s.cfg.Packing
+	ligero.NewStore = s.newStore
+
+	var matrix [][]*core.Element
+	ciphertexts := witness
+	if witness == nil {
+		matrix, _, err = core.RandomMatrixRowMajor(s.cfg.Rows, s.cfg.Cols, s.params.PlaintextModulus(), func(u []uint64) *rlwe.Plaintext {
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		span := core.StartSpan("Encrypt matrix", parentSpan)
+		ciphertexts, err = fhe.EncryptMatrix(ctx, matrix, ligero.Packing, s.params, backend)
+		span.End()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var store fhe.CiphertextStore = fhe.MemoryStore(ciphertexts)
+	if s.newStore != nil {
+		if store, err = fhe.StoreAll(ciphertexts, s.newStore); err != nil {
+			return nil, err
+		}
+	}
+
+	span := core.StartSpan("Commit FHE evaluation", parentSpan, "Commit FHE evaluation...")
+	span.SetAttribute("queries", ligero.Queries)
+	commitBackend := backend.Scoped()
+	prover, _, err := ligero.Commit(ctx, store, commitBackend, span)
+	if err != nil {
+		if s.newStore != nil {
+			store.Close()
+		}
+		return nil, err
+	}
+	commitBackend.Ops().Attributes(span)
+	span.EndWithNewline()
+
+	// Clean up ciphertexts as they're no longer needed
+	ciphertexts = nil
+	runtime.GC() // Request garbage collection
+
+	comm := &commitment{prover: prover, server: backend, matrix: matrix, spilled: s.newStore != nil}
+	comm.refs.Store(1)
+	return comm, nil
+}
+
+func (c *commitment) retain() {
+	c.refs.Add(1)
+}
+
+// release drops a reference taken by retain, or the one its creator holds, closing the commitment once none are
+// left.
+func (c *commitment) release() error {
+	if c.refs.Add(-1) > 0 {
+		return nil
+	}
+	return c.Close()
+}
+
+// Close releases the encoded matrix, and the matrix if it was copied to a store.
+func (c *commitment) Close() error {
+	err := c.prover.Close()
+	if c.spilled {
+		err = errors.Join(err, c.prover.Matrix.Close())
+	}
+	return err
+}
+
+// open proves the evaluation of the committed polynomial at z, reporting its phases under parentSpan.
+// Openings may run concurrently. Cancelling ctx aborts the proof.
+func (c *commitment) open(ctx context.Context, z *core.Element, parentSpan *core.Span) (*protocol.Proof, error) {
+	transcript := core.NewTranscript(protocol.TranscriptLabel)
+	span := core.StartSpan("Prove FHE evaluation", parentSpan, "Prove FHE evaluation...")
+	proveBackend := c.server.Scoped()
+	encryptedProof, err := c.prover.Prove(ctx, z, proveBackend, transcript, span)
+	if err != nil {
+		return nil, err
+	}
+	proveBackend.Ops().Attributes(span)
+	span.EndWithNewline()
+
+	span = core.StartSpan("Marshal proof", parentSpan)
+	marshaled, err := encryptedProof.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttribute("bytes", len(marshaled))
+	span.EndWithNewline()
+
+	encryptedProof = nil
+	runtime.GC()
+
+	proof := &protocol.Proof{EncryptedProof: marshaled}
+	if c.matrix != nil {
+		span = core.StartSpan("Evaluate polynomial", parentSpan)
+		poly := core.NewDensePolyFromMatrix(c.matrix)
+		value := poly.Evaluate(c.server.Field(), z).Uint64()
+		proof.Value = &value
+		span.EndWithNewline()
+
+		// Clean up poly as it's no longer needed
+		poly = nil
+		runtime.GC()
+	}
+
+	return proof, nil
+}
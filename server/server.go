@@ -0,0 +1,480 @@
+// Package server implements the server side of the delegated proving flow:
+// it serves the protocol endpoints, receives the client's keys and encrypted
+// witness, and commits to and proves evaluations of the witness polynomial.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/protocol"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+const (
+	Modulus      = 144115188075593729
+	RhoInv       = 2
+	SecurityBits = 128
+)
+
+// Config describes the matrix the server proves.
+type Config struct {
+	Rows int
+	Cols int
+	LogN int
+	// Packing is the number of columns packed into each ciphertext, see fhe.LigeroMetadata.Window.
+	Packing int
+	// Params, if set, replaces the FHE parameters derived from Cols, LogN and Modulus, e.g. with a smaller plaintext
+	// modulus under which the client can prove its decryptions.
+	Params *bgv.ParametersLiteral
+	// SpillDir, if set, keeps the ciphertexts of the matrix and its encoding in temporary files in this directory
+	// instead of memory.
+	SpillDir string
+	// Checkpoint, if set, is the file POST /commit writes its commitment of an uploaded witness to, replacing the
+	// previous one. After a restart, POST /keys reopens it without committing again if the keys are the ones it was
+	// made under.
+	Checkpoint string
+
+	// OnProofSent, if set, is called after a proof has been written to a client.
+	OnProofSent func()
+}
+
+// Server proves evaluations of the polynomial encoded by the witness one
+// client uploads, or of a random one if none is uploaded.
+type Server struct {
+	cfg     Config
+	params  bgv.Parameters
+	ptField core.PrimeField
+	ligero  *fhe.LigeroCommitter
+	// newStore makes the stores the matrix and its encoding are kept in, in memory if nil
+	newStore fhe.NewStoreFunc
+	// serverParams are the parameters clients derive their keys from
+	serverParams protocol.Params
+	jobs         *JobManager
+
+	// mu guards backend and witness, which POST /keys and POST /witness replace while proofs are requested
+	mu      sync.RWMutex
+	backend *fhe.ServerBFV
+	// keyDigest identifies the public key of backend, see keyDigest
+	keyDigest []byte
+	// witness are the encrypted witness columns uploaded by the client; a random matrix is proven when unset
+	witness []*rlwe.Ciphertext
+
+	// committed is the commitment made by POST /commit and opened by POST /open; openings retain it so that
+	// a new commitment only closes the previous one once they are done
+	committed *commitment
+	commitMu  sync.Mutex
+}
+
+// New derives the FHE parameters for cfg, unless given, and checks that the matrix fits them.
+func New(cfg Config) (*Server, error) {
+	var paramsLiteral bgv.ParametersLiteral
+	if cfg.Params != nil {
+		paramsLiteral = *cfg.Params
+	} else {
+		var err error
+		if paramsLiteral, err = fhe.GenerateBGVParamsForNTT(cfg.Cols, cfg.LogN, Modulus); err != nil {
+			return nil, err
+		}
+	}
+
+	params, err := bgv.NewParametersFromLiteral(paramsLiteral)
+	if err != nil {
+		return nil, err
+	}
+
+	ptField, err := core.NewPrimeField(params.PlaintextModulus(), cfg.Cols*2)
+	if err != nil {
+		return nil, err
+	}
+
+	ligero, err := fhe.NewLigeroCommitter(SecurityBits, cfg.Rows, cfg.Cols, RhoInv)
+	if err != nil {
+		return nil, err
+	}
+	ligero.Packing = cfg.Packing
+	if err := ligero.CheckPacking(params); err != nil {
+		return nil, err
+	}
+
+	var newStore fhe.NewStoreFunc
+	if cfg.SpillDir != "" {
+		newStore = fhe.FileStores(cfg.SpillDir, params)
+	}
+
+	return &Server{
+		cfg:      cfg,
+		params:   params,
+		ptField:  ptField,
+		ligero:   ligero,
+		newStore: newStore,
+		serverParams: protocol.Params{
+			BGV: params.ParametersLiteral(),
+			Ligero: protocol.LigeroParams{
+				Rows:         ligero.Rows,
+				Cols:         ligero.Cols,
+				RhoInv:       ligero.RhoInv,
+				Queries:      ligero.Queries,
+				SecurityBits: SecurityBits,
+				Packing:      ligero.Packing,
+			},
+			GaloisElements: ligero.GaloisElements(params),
+		},
+		jobs: NewJobManager(),
+	}, nil
+}
+
+// Shutdown cancels the proving jobs and releases the commitment, waiting for the running job until ctx is
+// done. It is called once the HTTP server serving Handler has shut down.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.jobs.Shutdown(ctx)
+
+	s.commitMu.Lock()
+	comm := s.committed
+	s.committed = nil
+	s.commitMu.Unlock()
+	if comm != nil {
+		err = errors.Join(err, comm.release())
+	}
+	return err
+}
+
+func (s *Server) Params() bgv.Parameters {
+	return s.params
+}
+
+// session returns the backend made from the uploaded keys, nil if none were uploaded, and the uploaded witness.
+func (s *Server) session() (*fhe.ServerBFV, []*rlwe.Ciphertext) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.backend, s.witness
+}
+
+// Handler returns the handler serving the protocol endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+protocol.PathParams, s.handleParams)
+	mux.HandleFunc(protocol.PathKeys, s.handleKeys)
+	mux.HandleFunc(protocol.PathWitness, s.handleWitness)
+	mux.HandleFunc(protocol.PathProve, s.handleProve)
+	mux.HandleFunc("POST "+protocol.PathJobs, s.handleSubmitJob)
+	mux.HandleFunc("GET "+protocol.PathJobs+"/{id}", s.handleJobStatus)
+	mux.HandleFunc("GET "+protocol.PathJobs+"/{id}/proof", s.handleJobProof)
+	mux.HandleFunc("DELETE "+protocol.PathJobs+"/{id}", s.handleCancelJob)
+	mux.HandleFunc("POST "+protocol.PathCommit, s.handleCommit)
+	mux.HandleFunc("POST "+protocol.PathOpen, s.handleOpen)
+	return mux
+}
+
+func (s *Server) handleParams(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.serverParams)
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	keys, err := protocol.ReadKeys(r.Body, s.params)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid keys: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	evk := rlwe.NewMemEvaluationKeySet(keys.RelinearizationKey, keys.GaloisKeys...)
+	for _, galEl := range s.serverParams.GaloisElements {
+		if _, err := evk.GetGaloisKey(galEl); err != nil {
+			http.Error(w, fmt.Sprintf("Missing Galois key for element %d", galEl), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if keys.RingSwitchParams != nil && s.ligero.ColumnsPerCiphertext() > 1 {
+		http.Error(w, "Ring switching is not supported with packed columns", http.StatusBadRequest)
+		return
+	}
+
+	backend := fhe.NewBackendBFV(&s.ptField, s.params, keys.PublicKey, evk)
+	digest, err := keyDigest(keys.PublicKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if keys.RingSwitchParams != nil {
+		fmt.Printf("Using ring switch to LogN: %d\n", keys.RingSwitchParams.LogN)
+
+		rs, err := fhe.NewRingSwitchServer(keys.RingSwitchEvk, *keys.RingSwitchParams)
+		if err != nil {
+			http.Error(w, "Failed to create ring switch server", http.StatusInternalServerError)
+			return
+		}
+
+		backend.SetRingSwitchServer(rs)
+	}
+
+	s.mu.Lock()
+	s.backend = backend
+	s.keyDigest = digest
+	s.mu.Unlock()
+
+	if s.cfg.Checkpoint != "" {
+		s.commitMu.Lock()
+		if s.committed == nil {
+			s.committed, err = s.resume(r.Context(), backend, digest)
+		}
+		s.commitMu.Unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to resume the checkpointed commitment: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleWitness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	columns, err := protocol.ReadWitness(r.Body, s.params)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid witness: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if expected := s.cfg.Cols / s.ligero.ColumnsPerCiphertext() * s.ligero.Segments(s.params); len(columns) != expected {
+		http.Error(w, fmt.Sprintf("Witness has %d column segments, expected %d", len(columns), expected), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.witness = columns
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleProve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	backend, witness := s.session()
+	if backend == nil {
+		http.Error(w, "Server not initialized; call POST /keys first", http.StatusBadRequest)
+		return
+	}
+
+	point, ok := parsePoint(w, r)
+	if !ok {
+		return
+	}
+
+	proof, err := s.prove(r.Context(), backend, witness, core.NewElement(point), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := writeProof(w, proof); err != nil {
+		fmt.Printf("Failed to write proof: %v\n", err)
+	}
+	if s.cfg.OnProofSent != nil {
+		s.cfg.OnProofSent()
+	}
+}
+
+func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	backend, witness := s.session()
+	if backend == nil {
+		http.Error(w, "Server not initialized; call POST /keys first", http.StatusBadRequest)
+		return
+	}
+
+	point, ok := parsePoint(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := s.jobs.Submit(point, func(ctx context.Context, span *core.Span) (*protocol.Proof, error) {
+		return s.prove(ctx, backend, witness, core.NewElement(point), span)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job.Status())
+}
+
+func (s *Server) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job.Status())
+}
+
+func (s *Server) handleJobProof(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	proof, ok := job.Result()
+	if !ok {
+		http.Error(w, fmt.Sprintf("Job is %s", job.Status().State), http.StatusConflict)
+		return
+	}
+
+	if err := writeProof(w, proof); err != nil {
+		fmt.Printf("Failed to write proof: %v\n", err)
+		return
+	}
+	if s.cfg.OnProofSent != nil {
+		s.cfg.OnProofSent()
+	}
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.Cancel(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job.Status())
+}
+
+func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	backend, witness, digest := s.backend, s.witness, s.keyDigest
+	s.mu.RUnlock()
+	if backend == nil {
+		http.Error(w, "Server not initialized; call POST /keys first", http.StatusBadRequest)
+		return
+	}
+
+	comm, err := s.commit(r.Context(), backend, witness, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if s.cfg.Checkpoint != "" && comm.matrix == nil {
+		if err := s.checkpoint(comm, digest); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to checkpoint the commitment: %v", errors.Join(err, comm.release())), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.commitMu.Lock()
+	previous := s.committed
+	s.committed = comm
+	s.commitMu.Unlock()
+	if previous != nil {
+		if err := previous.release(); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to release the previous commitment: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, protocol.Commitment{Root: comm.prover.Tree.MerkleRoot()})
+}
+
+func (s *Server) handleOpen(w http.ResponseWriter, r *http.Request) {
+	pointStrs := r.URL.Query()["point"]
+	if len(pointStrs) == 0 {
+		http.Error(w, "Missing required query parameter: point", http.StatusBadRequest)
+		return
+	}
+
+	points := make([]uint64, len(pointStrs))
+	for i, pointStr := range pointStrs {
+		point, err := strconv.ParseUint(pointStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid point value", http.StatusBadRequest)
+			return
+		}
+		points[i] = point
+	}
+
+	s.commitMu.Lock()
+	comm := s.committed
+	if comm != nil {
+		comm.retain()
+	}
+	s.commitMu.Unlock()
+	if comm == nil {
+		http.Error(w, "No commitment; call POST /commit first", http.StatusBadRequest)
+		return
+	}
+
+	openings, err := fhe.ParallelMap(r.Context(), len(points), func() func(int) (*protocol.Opening, error) {
+		return func(i int) (*protocol.Opening, error) {
+			proof, err := comm.open(r.Context(), core.NewElement(points[i]), nil)
+			if err != nil {
+				return nil, err
+			}
+			return &protocol.Opening{Point: points[i], Proof: *proof}, nil
+		}
+	})
+	err = errors.Join(err, comm.release())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", protocol.ContentType)
+	if err := protocol.WriteOpenings(w, openings); err != nil {
+		fmt.Printf("Failed to write openings: %v\n", err)
+	}
+}
+
+// parsePoint parses the point query parameter, responding with an error if it is missing or invalid.
+func parsePoint(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	pointStr := r.URL.Query().Get("point")
+	if pointStr == "" {
+		http.Error(w, "Missing required query parameter: point", http.StatusBadRequest)
+		return 0, false
+	}
+
+	point, err := strconv.ParseUint(pointStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid point value", http.StatusBadRequest)
+		return 0, false
+	}
+	return point, true
+}
+
+func writeProof(w http.ResponseWriter, proof *protocol.Proof) error {
+	w.Header().Set("Content-Type", protocol.ContentType)
+	if err := protocol.WriteProof(w, proof); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Failed to write response: %v\n", err)
+	}
+}
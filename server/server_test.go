@@ -0,0 +1,200 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/protocol"
+	"github.com/nulltea/lumenos/server"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+const (
+	rows = 16
+	cols = 8
+	logN = 12
+)
+
+func serve(handler http.Handler, method, target string, body []byte) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, bytes.NewReader(body)))
+	return recorder
+}
+
+// newServer returns a new server for cfg, shut down once the test is done.
+func newServer(t *testing.T, cfg server.Config) *server.Server {
+	srv, err := server.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+	return srv
+}
+
+// uploads returns a handler of a new server for cfg, and the keys and witness a client uploads to it.
+func uploads(t *testing.T, cfg server.Config) (handler http.Handler, keys, witness []byte) {
+	srv := newServer(t, cfg)
+	handler = srv.Handler()
+	params := srv.Params()
+
+	var serverParams protocol.Params
+	if err := json.NewDecoder(serve(handler, http.MethodGet, protocol.PathParams, nil).Body).Decode(&serverParams); err != nil {
+		t.Fatal(err)
+	}
+
+	ptField, err := core.NewPrimeField(params.PlaintextModulus(), cols*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kgen := rlwe.NewKeyGenerator(params)
+	sk := kgen.GenSecretKeyNew()
+
+	var keysBuf bytes.Buffer
+	err = protocol.WriteKeys(&keysBuf, &protocol.Keys{
+		PublicKey:          kgen.GenPublicKeyNew(sk),
+		RelinearizationKey: kgen.GenRelinearizationKeyNew(sk),
+		GaloisKeys:         kgen.GenGaloisKeysNew(serverParams.GaloisElements, sk),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matrix, _, err := core.RandomMatrixRowMajor(rows, cols, server.Modulus, func(u []uint64) *struct{} { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := fhe.EncryptMatrix(context.Background(), matrix, 1, params, fhe.NewClientBFV(&ptField, params, sk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var witnessBuf bytes.Buffer
+	if err := protocol.WriteWitness(&witnessBuf, columns); err != nil {
+		t.Fatal(err)
+	}
+
+	return handler, keysBuf.Bytes(), witnessBuf.Bytes()
+}
+
+// TestConcurrentUploads replaces the keys and witness while proofs are requested, for go test -race.
+func TestConcurrentUploads(t *testing.T) {
+	handler, keys, witness := uploads(t, server.Config{Rows: rows, Cols: cols, LogN: logN})
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if resp := serve(handler, http.MethodPost, protocol.PathKeys, keys); resp.Code != http.StatusOK {
+				t.Errorf("upload keys: status %d: %s", resp.Code, resp.Body)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if resp := serve(handler, http.MethodPost, protocol.PathWitness, witness); resp.Code != http.StatusOK {
+				t.Errorf("upload witness: status %d: %s", resp.Code, resp.Body)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			// Reads the keys and witness, then fails on the point before proving.
+			serve(handler, http.MethodGet, protocol.PathProve+"?point=invalid", nil)
+		}()
+	}
+	wg.Wait()
+
+	resp := serve(handler, http.MethodGet, protocol.PathProve+"?point=invalid", nil)
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "Invalid point") {
+		t.Fatalf("got status %d: %s, expected an invalid point once keys are uploaded", resp.Code, resp.Body)
+	}
+}
+
+// TestOpenWhileCommitting replaces the commitment while it is opened at several points.
+func TestOpenWhileCommitting(t *testing.T) {
+	handler, keys, witness := uploads(t, server.Config{Rows: rows, Cols: cols, LogN: logN})
+	for _, upload := range []struct {
+		path string
+		body []byte
+	}{{protocol.PathKeys, keys}, {protocol.PathWitness, witness}, {protocol.PathCommit, nil}} {
+		if resp := serve(handler, http.MethodPost, upload.path, upload.body); resp.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", upload.path, resp.Code, resp.Body)
+		}
+	}
+
+	points := []uint64{3, 5, 7}
+	var opened *httptest.ResponseRecorder
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		opened = serve(handler, http.MethodPost, protocol.PathOpen+"?point=3&point=5&point=7", nil)
+	}()
+	go func() {
+		defer wg.Done()
+		if resp := serve(handler, http.MethodPost, protocol.PathCommit, nil); resp.Code != http.StatusOK {
+			t.Errorf("commit: status %d: %s", resp.Code, resp.Body)
+		}
+	}()
+	wg.Wait()
+
+	if opened.Code != http.StatusOK {
+		t.Fatalf("open: status %d: %s", opened.Code, opened.Body)
+	}
+	openings, err := protocol.ReadOpenings(opened.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(openings) != len(points) {
+		t.Fatalf("got %d openings, expected %d", len(openings), len(points))
+	}
+	for i, opening := range openings {
+		if opening.Point != points[i] {
+			t.Errorf("opening %d is at point %d, expected %d", i, opening.Point, points[i])
+		}
+	}
+}
+
+// TestCheckpointResume opens a commitment after a restart, once the client uploads the keys it was made under.
+func TestCheckpointResume(t *testing.T) {
+	cfg := server.Config{Rows: rows, Cols: cols, LogN: logN, Checkpoint: filepath.Join(t.TempDir(), "commitment")}
+	handler, keys, witness := uploads(t, cfg)
+	for _, upload := range []struct {
+		path string
+		body []byte
+	}{{protocol.PathKeys, keys}, {protocol.PathWitness, witness}, {protocol.PathCommit, nil}} {
+		if resp := serve(handler, http.MethodPost, upload.path, upload.body); resp.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", upload.path, resp.Code, resp.Body)
+		}
+	}
+	opened := serve(handler, http.MethodPost, protocol.PathOpen+"?point=3", nil)
+	if opened.Code != http.StatusOK {
+		t.Fatalf("open: status %d: %s", opened.Code, opened.Body)
+	}
+
+	restarted := newServer(t, cfg).Handler()
+	if resp := serve(restarted, http.MethodPost, protocol.PathOpen+"?point=3", nil); resp.Code != http.StatusBadRequest {
+		t.Fatalf("open before the keys are uploaded: status %d, expected %d", resp.Code, http.StatusBadRequest)
+	}
+	if resp := serve(restarted, http.MethodPost, protocol.PathKeys, keys); resp.Code != http.StatusOK {
+		t.Fatalf("upload keys: status %d: %s", resp.Code, resp.Body)
+	}
+	resumed := serve(restarted, http.MethodPost, protocol.PathOpen+"?point=3", nil)
+	if resumed.Code != http.StatusOK {
+		t.Fatalf("open after restart: status %d: %s", resumed.Code, resumed.Body)
+	}
+	if !bytes.Equal(opened.Body.Bytes(), resumed.Body.Bytes()) {
+		t.Fatal("resumed commitment opens differently")
+	}
+}
@@ -0,0 +1,176 @@
+// Package batching reduces a set of decrypted columns and their ciphertexts to a single statement
+// for verifiable decryption. It has no cgo dependencies, so it builds without the LaZer toolchain.
+package batching
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// ColumnInstance is a pair of a batched ciphertext and associated decrypted column vector.
+type ColumnInstance struct {
+	Ct     *rlwe.Ciphertext
+	Values []*core.Element
+}
+
+// Batch absorbs the instance into transcript and reduces it to batches independent statements: each batches the
+// columns and ciphertexts with its own challenges, and its ciphertext is switched to the lowest level.
+// Every extra batch divides the soundness error of the random linear combination by the field size.
+func Batch(instance []*ColumnInstance, batches int, backend *bgv.Evaluator, field *core.PrimeField, transcript *core.Transcript, parentSpan *core.Span) ([]*rlwe.Ciphertext, [][]uint64, error) {
+	if batches < 1 {
+		return nil, nil, fmt.Errorf("%w: %d batches", core.ErrInvalidSize, batches)
+	}
+	cols := len(instance)
+	matrixColMajor := make([][]*core.Element, cols)
+	cts := make([]*rlwe.Ciphertext, cols)
+	for j := range matrixColMajor {
+		matrixColMajor[j] = instance[j].Values
+		cts[j] = instance[j].Ct
+	}
+
+	// Bind the ciphertexts and claimed columns before sampling the batching challenges
+	for _, column := range instance {
+		transcript.AppendCiphertext("pod_ct", column.Ct)
+		transcript.AppendBytes("pod_values", encodeElements(column.Values))
+	}
+
+	batchCts := make([]*rlwe.Ciphertext, batches)
+	ms := make([][]uint64, batches)
+	for k := range batches {
+		span := core.StartSpan("Batching decrypted columns", parentSpan)
+		batchedCol, alphas, err := BatchColumns(matrixColMajor, field, transcript)
+		if err != nil {
+			return nil, nil, err
+		}
+		span.End()
+
+		ms[k] = make([]uint64, len(batchedCol))
+		for i := range batchedCol {
+			ms[k][i] = batchedCol[i].Uint64()
+		}
+
+		span = core.StartSpan("Batching ciphertexts", parentSpan)
+		batchCt, err := BatchCiphertexts(cts, alphas, backend)
+		if err != nil {
+			return nil, nil, err
+		}
+		span.End()
+
+		// TODO: ring and modulus switch
+		for batchCt.LevelQ() > 0 {
+			if err := backend.Rescale(batchCt, batchCt); err != nil {
+				return nil, nil, err
+			}
+		}
+		batchCts[k] = batchCt
+	}
+
+	return batchCts, ms, nil
+}
+
+// BatchCiphertexts computes the random linear combination of the column ciphertexts with the challenges sampled by
+// BatchColumns, so that it decrypts to the batched column. Each challenge column is zero-padded to the full slot count,
+// which masks the slots beyond the column length. Ciphertexts are aligned to the lowest level among them, and the
+// challenge plaintexts are encoded at the scale that brings every product to the scale of the first ciphertext.
+// The inputs are left unmodified.
+func BatchCiphertexts(cts []*rlwe.Ciphertext, alphasColMajor [][]uint64, backend *bgv.Evaluator) (*rlwe.Ciphertext, error) {
+	cols := len(cts)
+	if cols == 0 {
+		return nil, fmt.Errorf("%w: no ciphertexts to batch", core.ErrInvalidSize)
+	}
+	if len(alphasColMajor) != cols {
+		return nil, fmt.Errorf("%w: %d ciphertexts but %d challenge columns", core.ErrDimensionMismatch, cols, len(alphasColMajor))
+	}
+	params := *backend.GetParameters()
+	slots := params.MaxSlots()
+	rows := len(alphasColMajor[0])
+	if rows == 0 || rows > slots {
+		return nil, fmt.Errorf("%w: %d rows do not fit in %d slots", core.ErrInvalidSize, rows, slots)
+	}
+
+	level := cts[0].Level()
+	for i := range cols {
+		if len(alphasColMajor[i]) != rows {
+			return nil, fmt.Errorf("%w: challenge column %d has %d rows, expected %d", core.ErrDimensionMismatch, i, len(alphasColMajor[i]), rows)
+		}
+		level = min(level, cts[i].Level())
+	}
+
+	scale := cts[0].Scale
+	masked := make([]uint64, slots)
+	var batchCt *rlwe.Ciphertext
+	for i := range cols {
+		ct := cts[i]
+		if ct.Level() > level {
+			ct = ct.CopyNew()
+			backend.DropLevel(ct, ct.Level()-level)
+		}
+
+		// Slots past rows hold whatever the column ciphertext carried there, zero challenges discard them
+		copy(masked, alphasColMajor[i])
+		alphaPt := bgv.NewPlaintext(params, level)
+		alphaPt.MetaData = ct.MetaData.CopyNew()
+		alphaPt.Scale = scale.Div(ct.Scale)
+		if err := backend.Encode(masked, alphaPt); err != nil {
+			return nil, err
+		}
+
+		t, err := backend.MulNew(ct, alphaPt)
+		if err != nil {
+			return nil, err
+		}
+		if batchCt == nil {
+			batchCt = t
+			continue
+		}
+		if err := backend.Add(batchCt, t, batchCt); err != nil {
+			return nil, err
+		}
+	}
+
+	return batchCt, nil
+}
+
+func BatchColumns(matrixColMajor [][]*core.Element, field *core.PrimeField, transcript *core.Transcript) ([]*core.Element, [][]uint64, error) {
+	if len(matrixColMajor) == 0 {
+		return nil, nil, fmt.Errorf("%w: no columns to batch", core.ErrInvalidSize)
+	}
+	rows := len(matrixColMajor[0])
+	cols := len(matrixColMajor)
+	for j := range matrixColMajor {
+		if len(matrixColMajor[j]) != rows {
+			return nil, nil, fmt.Errorf("%w: column %d has %d rows, expected %d", core.ErrDimensionMismatch, j, len(matrixColMajor[j]), rows)
+		}
+	}
+	alphasColMajor := make([][]uint64, cols)
+	for i := range alphasColMajor {
+		r := make([]uint64, rows)
+		transcript.SampleUints("pod_alpha", r)
+		alphasColMajor[i] = r
+	}
+
+	batchCol := make([]*core.Element, rows)
+	for i := range batchCol {
+		batchCol[i] = core.Zero()
+	}
+	for j := range matrixColMajor {
+		for i := range matrixColMajor[j] {
+			batchCol[i] = field.Add(batchCol[i], field.Mul(matrixColMajor[j][i], core.NewElement(alphasColMajor[j][i])))
+		}
+	}
+
+	return batchCol, alphasColMajor, nil
+}
+
+// encodeElements packs elements into a single transcript message.
+func encodeElements(elements []*core.Element) []byte {
+	bytes := make([]byte, 0, core.ElementBytes*len(elements))
+	for _, e := range elements {
+		bytes = binary.LittleEndian.AppendUint64(bytes, e.Uint64())
+	}
+	return bytes
+}
@@ -0,0 +1,236 @@
+package batching_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/vdec/batching"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+const (
+	Modulus = 0x3ee0001
+)
+
+func TestBatchCiphertexts(t *testing.T) {
+	programStart := time.Now()
+	cases := []struct {
+		rows int
+		cols int
+	}{
+		{1, 1},
+		{128, 64},
+		{256, 128},
+		{1024, 1024},
+	}
+
+	for _, c := range cases {
+		rows := c.rows
+		cols := c.cols
+		params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+			LogN:             11,
+			LogQ:             []int{60, 60},
+			LogP:             []int{55, 55},
+			PlaintextModulus: 0x3ee0001,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		kgen := rlwe.NewKeyGenerator(params)
+		sk, _ := kgen.GenKeyPairNew()
+
+		ptField, err := core.NewPrimeField(params.PlaintextModulus(), 8*2)
+		if err != nil {
+			panic(err)
+		}
+
+		client := fhe.NewClientBFV(&ptField, params, sk)
+		evaluator := bgv.NewEvaluator(params, nil)
+
+		matrixColMajor, ciphertexts, err := core.RandomMatrixColMajor(rows, cols, Modulus, func(u []uint64) *rlwe.Ciphertext {
+			plaintext := bgv.NewPlaintext(params, params.MaxLevel())
+			if err := client.Encode(u, plaintext); err != nil {
+				panic(err)
+			}
+			ciphertext, err := client.EncryptNew(plaintext)
+			if err != nil {
+				panic(err)
+			}
+			return ciphertext
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		transcript := core.NewTranscript("batch_ciphertexts")
+
+		batchColCheck, alphas, err := batching.BatchColumns(matrixColMajor, &ptField, transcript)
+		if err != nil {
+			panic(err)
+		}
+
+		start := time.Now()
+		result, err := batching.BatchCiphertexts(ciphertexts, alphas, evaluator)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("FHE evaluation took: %v\n", time.Since(start))
+
+		batchedCol := make([]*core.Element, rows)
+		plaintext := client.DecryptNew(result)
+		column := make([]uint64, rows)
+		if err := client.Decode(plaintext, column); err != nil {
+			panic(err)
+		}
+		for i := range column {
+			batchedCol[i] = core.NewElement(column[i])
+		}
+
+		for i := range batchedCol {
+			if !batchColCheck[i].Equal(batchedCol[i]) {
+				t.Fatalf("Matrices differ at [%d]: expected %v, got %v", i, batchColCheck[i], batchedCol[i])
+			}
+		}
+
+		fmt.Println("Batched columns are equal")
+		fmt.Printf("Total execution time: %v\n", time.Since(programStart))
+	}
+}
+
+func TestBatchColumnsShape(t *testing.T) {
+	ptField, err := core.NewPrimeField(0x3ee0001, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := batching.BatchColumns(nil, &ptField, core.NewTranscript("test")); !errors.Is(err, core.ErrInvalidSize) {
+		t.Fatalf("expected ErrInvalidSize, got %v", err)
+	}
+
+	ragged := [][]*core.Element{
+		{core.NewElement(1), core.NewElement(2)},
+		{core.NewElement(3)},
+	}
+	if _, _, err := batching.BatchColumns(ragged, &ptField, core.NewTranscript("test")); !errors.Is(err, core.ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func TestBatchCiphertextsRandomShapes(t *testing.T) {
+	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             11,
+		LogQ:             []int{60, 60, 60},
+		LogP:             []int{55},
+		PlaintextModulus: Modulus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kgen := rlwe.NewKeyGenerator(params)
+	sk := kgen.GenSecretKeyNew()
+	ptField, err := core.NewPrimeField(params.PlaintextModulus(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fhe.NewClientBFV(&ptField, params, sk)
+	evaluator := bgv.NewEvaluator(params, nil)
+	slots := params.MaxSlots()
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for trial := range 8 {
+		rows := 1 + rng.IntN(slots)
+		if trial == 0 {
+			rows = slots
+		}
+		cols := 1 + rng.IntN(8)
+		t.Run(fmt.Sprintf("%dx%d", rows, cols), func(t *testing.T) {
+			matrixColMajor := make([][]*core.Element, cols)
+			cts := make([]*rlwe.Ciphertext, cols)
+			for j := range cols {
+				// Fill every slot so that the slots past rows carry garbage the batching must mask out
+				values := make([]uint64, slots)
+				for i := range values {
+					values[i] = rng.Uint64N(Modulus)
+				}
+				pt := bgv.NewPlaintext(params, params.MaxLevel())
+				if err := client.Encode(values, pt); err != nil {
+					t.Fatal(err)
+				}
+				if cts[j], err = client.EncryptNew(pt); err != nil {
+					t.Fatal(err)
+				}
+				// Misalign levels and scales across columns, leaving a level of noise budget for the product
+				for range rng.IntN(params.MaxLevel()) {
+					if err := evaluator.Rescale(cts[j], cts[j]); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				matrixColMajor[j] = make([]*core.Element, rows)
+				for i := range rows {
+					matrixColMajor[j][i] = core.NewElement(values[i])
+				}
+			}
+
+			expected, alphas, err := batching.BatchColumns(matrixColMajor, &ptField, core.NewTranscript("batch_ciphertexts"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			levels := make([]int, cols)
+			for j := range cts {
+				levels[j] = cts[j].Level()
+			}
+
+			result, err := batching.BatchCiphertexts(cts, alphas, evaluator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := range cts {
+				if cts[j].Level() != levels[j] {
+					t.Fatalf("ciphertext %d was modified: level %d, expected %d", j, cts[j].Level(), levels[j])
+				}
+			}
+
+			decoded := make([]uint64, slots)
+			if err := client.Decode(client.DecryptNew(result), decoded); err != nil {
+				t.Fatal(err)
+			}
+			for i := range slots {
+				want := uint64(0)
+				if i < rows {
+					want = expected[i].Uint64()
+				}
+				if decoded[i] != want {
+					t.Fatalf("slot %d: expected %d, got %d", i, want, decoded[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBatchCiphertextsShape(t *testing.T) {
+	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             11,
+		LogQ:             []int{60},
+		PlaintextModulus: Modulus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := rlwe.NewCiphertext(params, 1, params.MaxLevel())
+	evaluator := bgv.NewEvaluator(params, nil)
+
+	if _, err := batching.BatchCiphertexts([]*rlwe.Ciphertext{ct}, [][]uint64{make([]uint64, params.MaxSlots()+1)}, evaluator); !errors.Is(err, core.ErrInvalidSize) {
+		t.Fatalf("expected ErrInvalidSize, got %v", err)
+	}
+	if _, err := batching.BatchCiphertexts([]*rlwe.Ciphertext{ct, ct}, [][]uint64{make([]uint64, 4), make([]uint64, 3)}, evaluator); !errors.Is(err, core.ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch, got %v", err)
+	}
+}
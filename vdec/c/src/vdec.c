@@ -7,15 +7,56 @@
 
 #define N 1        /* number of quadratic equations */
 #define M 1        /* number of quadratic eval equations */
-#define CT_COUNT 1 /* number of ciphertexts */
-#define DEGREE 2048
 
 /* Number of elements in an n x n (upper) diagonal matrix. */
 #define NELEMS_DIAG(n) (((n) * (n) - (n)) / 2 + (n))
 
-int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
-                   polyvec_t sk, int8_t sk_sign[], polyvec_t ct0, polyvec_t ct1,
-                   polyvec_t m_delta, unsigned int fhe_degree);
+#define MAX(x, y) ((x) >= (y) ? (x) : (y))
+
+int vdec_lnp_tbox_prove(uint8_t **proof, size_t *prooflen, uint8_t seed[32],
+                        const lnp_quad_eval_params_t params, polyvec_t sk,
+                        int8_t sk_sign[], polyvec_t ct0, polyvec_t ct1,
+                        polyvec_t m_delta, unsigned int fhe_degree,
+                        unsigned int ct_count);
+int vdec_lnp_tbox_verify(const uint8_t *proof, size_t prooflen,
+                         uint8_t seed[32], const lnp_quad_eval_params_t params,
+                         polyvec_t ct0, polyvec_t ct1, polyvec_t m_delta,
+                         unsigned int fhe_degree, unsigned int ct_count);
+
+static void _vdec_coeffs(intvec_ptr r, polyvec_t v);
+static int _vdec_check_statement(polyvec_t ct0, polyvec_t ct1,
+                                 polyvec_t m_delta, unsigned int n,
+                                 unsigned int ct_count);
+static void _vdec_build_Ds(polymat_t Ds, intvec_ptr w_sk, polyvec_t ct1,
+                           intvec_ptr u_s, unsigned int n,
+                           unsigned int ct_count);
+static void _vdec_quadeqs(spolymat_ptr R2prime_sz[], spolyvec_ptr r1prime_sz[],
+                          poly_ptr r0prime_sz[], polymat_t Ds,
+                          intvec_ptr sum_tmp, polyvec_t zv,
+                          const uint8_t hashp[32], const uint8_t hash0[32],
+                          const lnp_quad_eval_params_t params,
+                          unsigned int nprime);
+static void _vdec_finalize_quadeqs(spolymat_ptr R2prime_sz[],
+                                   spolyvec_ptr r1prime_sz[],
+                                   poly_ptr r0prime_sz[], polyvec_t h,
+                                   const lnp_quad_eval_params_t params);
+static void _vdec_statement_hash(uint8_t hashp[32], polyvec_t tA1,
+                                 polyvec_t ct0, polyvec_t ct1,
+                                 polyvec_t m_delta, unsigned int ct_count,
+                                 const lnp_quad_eval_params_t params);
+static void _vdec_challenges(uint8_t hashp[32], uint8_t hash0[32],
+                             polyvec_t tA1, polyvec_t tB, polyvec_t ct0,
+                             polyvec_t ct1, polyvec_t m_delta,
+                             unsigned int ct_count,
+                             const lnp_quad_eval_params_t params);
+static int _vdec_proof_encode(uint8_t **out, size_t *outlen, polyvec_t tA1,
+                              polyvec_t tB, polyvec_t h, poly_t c, polyvec_t z1,
+                              polyvec_t z21, polyvec_t hint, polyvec_t zv,
+                              const lnp_quad_eval_params_t params);
+static int _vdec_proof_decode(polyvec_t tA1, polyvec_t tB, polyvec_t h,
+                              poly_t c, polyvec_t z1, polyvec_t z21,
+                              polyvec_t hint, polyvec_t zv, const uint8_t *in,
+                              size_t inlen, const lnp_quad_eval_params_t params);
 
 static inline void _expand_R_i2(int8_t *Ri, unsigned int ncols, unsigned int i,
                                 const uint8_t cseed[32]);
@@ -82,8 +123,6 @@ __evaleq(poly_ptr res, spolymat_ptr Rprime2, spolyvec_ptr rprime1,
   polyvec_free(tmp);
 }
 
-int main(void) {}
-
 /* R2 != R2_ */
 static void
 _scatter_smat(spolymat_ptr R2, spolymat_ptr R2_, unsigned int m1,
@@ -136,10 +175,23 @@ _scatter_vec(spolyvec_ptr r1, spolyvec_ptr r1_, unsigned int m1,
   r1->sorted = 1;
 }
 
-int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
-                   polyvec_t sk, int8_t sk_sign[], polyvec_t ct0, polyvec_t ct1,
-                   polyvec_t m_delta, unsigned int fhe_degree)
+/*
+ * Prove that m_delta is the decryption of the ct_count ciphertexts
+ * (ct0, ct1) under the committed sk. ct0, ct1 and m_delta hold the
+ * fhe_degree / d polys of each ciphertext one after another.
+ * On success, returns 1 and sets *proof to a malloc'd serialized proof of
+ * *prooflen bytes, to be checked with vdec_lnp_tbox_verify.
+ */
+int vdec_lnp_tbox_prove(uint8_t **proof, size_t *prooflen, uint8_t seed[32],
+                        const lnp_quad_eval_params_t params, polyvec_t sk,
+                        int8_t sk_sign[], polyvec_t ct0, polyvec_t ct1,
+                        polyvec_t m_delta, unsigned int fhe_degree,
+                        unsigned int ct_count)
 {
+  if (!_vdec_check_statement(ct0, ct1, m_delta,
+                             fhe_degree / polyring_get_deg(params->quad_eval->ring),
+                             ct_count))
+    return 0;
 
   /************************************************************************/
   /*                                                                      */
@@ -148,23 +200,17 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
   /************************************************************************/
   abdlop_params_srcptr abdlop = params->quad_eval;
   uint8_t hashp[32] = {0};
-  uint8_t hashv[32] = {0};
   polyring_srcptr Rq = abdlop->ring;
   const unsigned int lambda = params->lambda;
-  INT_T(lo, Rq->q->nlimbs);
-  INT_T(hi, Rq->q->nlimbs);
-  int b;
   uint32_t dom;
-  unsigned int i, j, k;
+  unsigned int i, j;
 
   polyvec_t subv;
-  int_ptr coeff;
   polymat_t A1, A2prime, Bprime;
   polyvec_t s1, s2, m, tA1, tA2, tB, z1, z21, hint, h, s, tmp;
   poly_t c;
   poly_ptr poly;
-
-  int b1 = 1, b2 = 1;
+  int ok;
 
   dom = 0;
 
@@ -197,7 +243,7 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
   const unsigned int m1 = abdlop->m1;
   const unsigned int l = abdlop->l;
   const unsigned int nbounds = 1; // TODO: number of u vectors we want to proof are small - will change to 1
-  const unsigned int nprime = fhe_degree / d * CT_COUNT;
+  const unsigned int nprime = fhe_degree / d * ct_count;
 
   DEBUG_PRINTF(DEBUG_LEVEL >= 2, "ajtai size: %d, bdlop size: %d, lext:%d, lambda:%d\n", m1, l, abdlop->lext, lambda);
   DEBUG_PRINTF(DEBUG_LEVEL >= 2, "quad-many l: %d, quad-many lext:%d\n\n", params->quad_many->l, params->quad_many->lext);
@@ -218,114 +264,37 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
   // #region build u vectors
 
   // build u vector - u_v (and temporary u_s = sk in coefficient form)
-  INTVEC_T(u_v_vec, d * ct0->nelems, Rq->q->nlimbs);
+  // u_v, sum_tmp and w_sk grow with ct_count, so they are not kept on the stack
+  intvec_t u_v_vec;
+  intvec_alloc(u_v_vec, d * ct0->nelems, Rq->q->nlimbs);
   INTVEC_T(u_s_vec, d * sk->nelems, Rq->q->nlimbs);
-  intvec_ptr u_v = &u_v_vec;
+  intvec_ptr u_v = u_v_vec;
   intvec_ptr u_s = &u_s_vec;
 
-  poly_ptr poly_tmp;
   intvec_ptr coeffs;
 
   // u_s
-  for (i = 0; i < sk->nelems; i++)
-  {
-    poly_tmp = polyvec_get_elem(sk, i);
-    coeffs = poly_get_coeffvec(poly_tmp);
-    for (j = 0; j < d; j++)
-    {
-      intvec_set_elem(u_s_vec, i * d + j, intvec_get_elem(coeffs, j));
-    }
-  }
+  _vdec_coeffs(u_s, sk);
 
-  // u_v
-  // printf("start u_v build\n");
+  // u_v = Ds*u_s + coeffs(ct0 - delta_m)
   polyvec_t c0_m;
   polyvec_alloc(c0_m, Rq, ct0->nelems);
-  DEBUG_PRINTF(DEBUG_LEVEL >= 2, "\nct0->nelems: %d", ct0->nelems);
   polyvec_sub(c0_m, ct0, m_delta, 0);
-  DEBUG_PRINTF(DEBUG_LEVEL >= 2, "\nc0_m->nelems: %d", c0_m->nelems);
 
-  // generate intvec with coeffs of ct0 - delta_m
-  INTVEC_T(sum_tmp_vec, d * c0_m->nelems, Rq->q->nlimbs);
-  DEBUG_PRINTF(DEBUG_LEVEL >= 2, "\nsum_tmp_vec->nelems: %d\n", sum_tmp_vec->nelems);
-  intvec_ptr sum_tmp = &sum_tmp_vec;
-  for (i = 0; i < c0_m->nelems; i++)
-  {
-    poly_tmp = polyvec_get_elem(c0_m, i);
-    coeffs = poly_get_coeffvec(poly_tmp);
-    for (j = 0; j < d; j++)
-    {
-      intvec_set_elem(sum_tmp, i * d + j, intvec_get_elem(coeffs, j));
-    }
-  }
+  intvec_t sum_tmp_vec;
+  intvec_alloc(sum_tmp_vec, d * c0_m->nelems, Rq->q->nlimbs);
+  intvec_ptr sum_tmp = sum_tmp_vec;
+  _vdec_coeffs(sum_tmp, c0_m);
 
-  // For each ct in ct1:
-  // generate intvec with coeffs of ct1, do rotations and
-  // dot product with u_s
-  // Calculate sizes (based on the paper):
-  polyvec_ptr ct1_ptr = &ct1;
-  poly_ptr first_ct1_ptr = polyvec_get_elem(ct1, 0);
-  size_t n = fhe_degree / d;
-  size_t r = CT_COUNT;
+  const unsigned int n = fhe_degree / d;
   DEBUG_PRINTF(DEBUG_LEVEL >= 2, "\nn: %d", n);
-  DEBUG_PRINTF(DEBUG_LEVEL >= 2, "\nr (CT_COUNT): %d\n", CT_COUNT);
+  DEBUG_PRINTF(DEBUG_LEVEL >= 2, "\nr (ct_count): %d\n", ct_count);
 
-  // intvec_ptr rot_s;
   polymat_t Ds;
-  // polymat_alloc (Ds, Rq, nprime*d, m1);
-  polymat_alloc(Ds, Rq, CT_COUNT * n * d, m1);
-  INTVEC_T(w_sk, CT_COUNT * d * n, Rq->q->nlimbs);
-  INTVEC_T(rot_s_vec, d * n, Rq->q->nlimbs);
-  intvec_ptr rot_s = &rot_s_vec;
-  for (k = 0; k < CT_COUNT; k++)
-  {
-
-    // getting k-th ct1 coeffs
-    INTVEC_T(ct1_coeffs_vec, d * n, Rq->q->nlimbs);
-    intvec_ptr ct1_coeffs = &ct1_coeffs_vec;
-    for (i = 0; i < n; i++)
-    {
-      poly_tmp = polyvec_get_elem(ct1, k * n + i);
-      coeffs = poly_get_coeffvec(poly_tmp);
-      for (j = 0; j < d; j++)
-      {
-        intvec_set_elem(ct1_coeffs, i * d + j, intvec_get_elem(coeffs, j));
-      }
-    }
-
-    INTVEC_T(ct1_coeffs_vec2, d * n, Rq->q->nlimbs);
-    intvec_ptr ct1_coeffs2 = &ct1_coeffs_vec2;
-
-    intvec_t rot_coeffvec;
-    poly_ptr Ds_elem;
-
-    // rotating coeffs of k-th ct1 and multiplying with u_s
-    intvec_reverse(ct1_coeffs, ct1_coeffs);
-    INT_T(new, 2 * Rq->q->nlimbs);
-    for (i = 0; i < (d * n); i++)
-    {
-      intvec_lrot(ct1_coeffs2, ct1_coeffs, i + 1);
-      intvec_neg_self(ct1_coeffs2);
-
-      for (j = 0; j < (ct1_coeffs2->nelems) / d; j++)
-      {
-        intvec_get_subvec(rot_coeffvec, ct1_coeffs2, 0 + j * d, d, 1); // XXX correct
-        Ds_elem = polymat_get_elem(Ds, k * (n * d) + i, j);
-        poly_set_coeffvec(Ds_elem, rot_coeffvec);
-      }
-
-      intvec_dot(new, ct1_coeffs2, u_s);
-
-      int_mod(new, new, Rq->q);
-      int_redc(new, new, Rq->q);
-      intvec_set_elem(rot_s, i, new);
-    }
-
-    for (i = 0; i < (n * d); i++)
-    {
-      intvec_set_elem(w_sk, k * (d * n) + i, intvec_get_elem(rot_s, i));
-    }
-  }
+  polymat_alloc(Ds, Rq, ct_count * n * d, m1);
+  intvec_t w_sk;
+  intvec_alloc(w_sk, ct_count * d * n, Rq->q->nlimbs);
+  _vdec_build_Ds(Ds, w_sk, ct1, u_s, n, ct_count);
 
   intvec_add(u_v, w_sk, sum_tmp);
 
@@ -337,8 +306,8 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
   /*                                                                      */
   /************************************************************************/
 
-  // prepare randomness sent to lnp_tbox_prove from lnp-tbox-test
-  memset(hashp, 0xff, 32);
+  // bind the challenges to the commitment and the statement
+  _vdec_statement_hash(hashp, tA1, ct0, ct1, m_delta, ct_count, params);
   // seed is also sent, but it is already declared before
 
   // things from lnp_tbox_prove
@@ -507,7 +476,7 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
     /* rejection sampling */
 
     intvec_mul_sgn_self(yv_coeffs, beta_v); /* revert mul by beta3 */
-    rej = rej_bimodal(rstate_rej, zv_coeffs, yv_coeffs, params1_scM4, params1_stdev4sq);
+    rej = rej_bimodal(rstate_rej, zv_coeffs, yv_coeffs, params->scM4, params->stdev4sq);
     if (rej)
     {
       DEBUG_PRINTF(DEBUG_PRINT_REJ, "%s", "reject u_v");
@@ -619,14 +588,438 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
   shake128_clear(hstate);
 
   // instantiating QUAD + QUAD_EVAL eqs
+  const unsigned int n_ = 2 * (m1 + l);
+  spolymat_ptr R2prime_sz[lambda / 2 + 1];
+  spolyvec_ptr r1prime_sz[lambda / 2 + 1];
+  poly_ptr r0prime_sz[lambda / 2 + 1];
+
+  _vdec_quadeqs(R2prime_sz, r1prime_sz, r0prime_sz, Ds, sum_tmp, zv, hashp,
+                hash0, params, nprime);
+
+  POLY_T(tmp1, Rq);
+  /* compute/output hi and set up quadeqs for lower level protocol */
+  for (i = 0; i < lambda / 2; i++)
+  {
+    polyvec_get_subvec(subv, s, 0, n_, 1);
+
+    __evaleq(tmp1, R2prime_sz[i], r1prime_sz[i], r0prime_sz[i], subv);
+    poly = polyvec_get_elem(h_our, i); /* gi */
+    poly_add(poly, poly, tmp1, 0);     /* hi = gi + schwarz zippel */
+  }
+  _vdec_finalize_quadeqs(R2prime_sz, r1prime_sz, r0prime_sz, h_our, params);
+
+  lnp_quad_many_prove(hashp, tB, c, z1, z21, hint, s1, m, s2, tA2, A1, A2prime,
+                      Bprime, R2prime_sz, r1prime_sz, lambda / 2 + 1,
+                      seed_cont2, params->quad_many);
+  DEBUG_PRINTF(DEBUG_LEVEL >= 2, "finished proof generation\n\n");
+
+  /* output proof (tA1,tB,h,c,z1,z21,hint,zv) */
+  ok = _vdec_proof_encode(proof, prooflen, tA1, tB, h_our, c, z1, z21, hint,
+                          zv, params);
+
+  /************************************************************************/
+  /*                                                                      */
+  /*                        END OF OUR CUSTOM PROOF                       */
+  /*                                                                      */
+  /************************************************************************/
+
+  poly_free(c);
+  polyvec_free(s1);
+  polyvec_free(s2);
+  polyvec_free(m);
+  polyvec_free(tA1);
+  polyvec_free(tA2);
+  polyvec_free(tB);
+  polyvec_free(z1);
+  polyvec_free(z21);
+  polyvec_free(hint);
+  polyvec_free(h);
+  polyvec_free(h_our);
+  polyvec_free(zv);
+  polyvec_free(c0_m);
+  polyvec_free(s);
+  polyvec_free(tmp);
+  polymat_free(Ds);
+  polymat_free(A1);
+  polymat_free(A2prime);
+  polymat_free(Bprime);
+  intvec_free(u_v_vec);
+  intvec_free(sum_tmp_vec);
+  intvec_free(w_sk);
+  return ok;
+}
+
+/*
+ * Verify a proof produced by vdec_lnp_tbox_prove for the same seed and
+ * public statement (ct0, ct1, m_delta) of ct_count ciphertexts. Returns 1 iff
+ * the proof is valid.
+ */
+int vdec_lnp_tbox_verify(const uint8_t *proof, size_t prooflen,
+                         uint8_t seed[32], const lnp_quad_eval_params_t params,
+                         polyvec_t ct0, polyvec_t ct1, polyvec_t m_delta,
+                         unsigned int fhe_degree, unsigned int ct_count)
+{
+  abdlop_params_srcptr abdlop = params->quad_eval;
+  polyring_srcptr Rq = abdlop->ring;
+  const unsigned int lambda = params->lambda;
+  const unsigned int d = polyring_get_deg(Rq);
+  const unsigned int m1 = abdlop->m1;
+  const unsigned int n = fhe_degree / d;
+  const unsigned int nprime = n * ct_count;
+  uint8_t hashp[32];
+  uint8_t hash0[32];
+  unsigned int i;
+  int_ptr coeff;
+  polymat_t A1, A2prime, Bprime, Ds;
+  polyvec_t tA1, tB, z1, z21, hint, h, zv, c0_m;
+  poly_t c;
+  int zv_valid = 0, h_valid = 1, quad_many_valid = 0;
+
+  if (!_vdec_check_statement(ct0, ct1, m_delta, n, ct_count))
+    return 0;
+
+  poly_alloc(c, Rq);
+  polyvec_alloc(tA1, Rq, abdlop->kmsis);
+  polyvec_alloc(tB, Rq, abdlop->l + abdlop->lext);
+  polyvec_alloc(z1, Rq, abdlop->m1);
+  polyvec_alloc(z21, Rq, abdlop->m2 - abdlop->kmsis);
+  polyvec_alloc(hint, Rq, abdlop->kmsis);
+  polyvec_alloc(h, Rq, lambda / 2);
+  polyvec_alloc(zv, Rq, 256 / d);
+  polyvec_alloc(c0_m, Rq, ct0->nelems);
+
+  polymat_alloc(A1, Rq, abdlop->kmsis, abdlop->m1);
+  polymat_alloc(A2prime, Rq, abdlop->kmsis, abdlop->m2 - abdlop->kmsis);
+  polymat_alloc(Bprime, Rq, abdlop->l + abdlop->lext,
+                abdlop->m2 - abdlop->kmsis);
+  polymat_alloc(Ds, Rq, ct_count * n * d, m1);
+
+  if (_vdec_proof_decode(tA1, tB, h, c, z1, z21, hint, zv, proof, prooflen,
+                         params))
+  {
+    abdlop_keygen(A1, A2prime, Bprime, seed, abdlop);
+
+    /* public statement: Ds from ct1, coeffs(ct0 - delta_m) */
+    _vdec_build_Ds(Ds, NULL, ct1, NULL, n, ct_count);
+    polyvec_sub(c0_m, ct0, m_delta, 0);
+    intvec_t sum_tmp;
+    intvec_alloc(sum_tmp, d * c0_m->nelems, Rq->q->nlimbs);
+    _vdec_coeffs(sum_tmp, c0_m);
+
+    /* zv bound */
+    INT_T(linf, int_get_nlimbs(Rq->q));
+    polyvec_linf(linf, zv);
+    zv_valid = int_le(linf, params->Bz4);
+    DEBUG_PRINTF(DEBUG_LEVEL >= 1, "--> zv bound verification result: %d\n", zv_valid);
+
+    /* h coeffs 0 and d/2 are zero */
+    for (i = 0; i < lambda / 2; i++)
+    {
+      coeff = poly_get_coeff(polyvec_get_elem(h, i), 0);
+      if (int_eqzero(coeff) != 1)
+        h_valid = 0;
+      coeff = poly_get_coeff(polyvec_get_elem(h, i), d / 2);
+      if (int_eqzero(coeff) != 1)
+        h_valid = 0;
+    }
+    DEBUG_PRINTF(DEBUG_LEVEL >= 1, "--> h coeff verification result: %d\n", h_valid);
+
+    if (zv_valid && h_valid)
+    {
+      /* recompute fiat-shamir challenges from the commitments */
+      _vdec_challenges(hashp, hash0, tA1, tB, ct0, ct1, m_delta, ct_count,
+                       params);
+
+      spolymat_ptr R2prime_sz[lambda / 2 + 1];
+      spolyvec_ptr r1prime_sz[lambda / 2 + 1];
+      poly_ptr r0prime_sz[lambda / 2 + 1];
+
+      _vdec_quadeqs(R2prime_sz, r1prime_sz, r0prime_sz, Ds, sum_tmp, zv,
+                    hashp, hash0, params, nprime);
+      _vdec_finalize_quadeqs(R2prime_sz, r1prime_sz, r0prime_sz, h, params);
+
+      quad_many_valid = lnp_quad_many_verify(
+          hashp, c, z1, z21, hint, tA1, tB, A1, A2prime, Bprime, R2prime_sz,
+          r1prime_sz, r0prime_sz, lambda / 2 + 1, params->quad_many);
+      DEBUG_PRINTF(DEBUG_LEVEL >= 1, "--> quad_many verification result: %d\n", quad_many_valid);
+    }
+    intvec_free(sum_tmp);
+  }
+  else
+  {
+    DEBUG_PRINTF(DEBUG_LEVEL >= 1, "%s", "--> malformed vdec proof\n");
+  }
+
+  poly_free(c);
+  polyvec_free(tA1);
+  polyvec_free(tB);
+  polyvec_free(z1);
+  polyvec_free(z21);
+  polyvec_free(hint);
+  polyvec_free(h);
+  polyvec_free(zv);
+  polyvec_free(c0_m);
+  polymat_free(A1);
+  polymat_free(A2prime);
+  polymat_free(Bprime);
+  polymat_free(Ds);
+  return zv_valid && h_valid && quad_many_valid;
+}
+
+/* r = coefficients of the polys in v, concatenated */
+static void
+_vdec_coeffs(intvec_ptr r, polyvec_t v)
+{
+  const unsigned int d = polyring_get_deg(v->ring);
+  intvec_ptr coeffs;
+  unsigned int i, j;
+
+  for (i = 0; i < v->nelems; i++)
+  {
+    coeffs = poly_get_coeffvec(polyvec_get_elem(v, i));
+    for (j = 0; j < d; j++)
+    {
+      intvec_set_elem(r, i * d + j, intvec_get_elem(coeffs, j));
+    }
+  }
+}
+
+/*
+ * Check that ct0, ct1 and m_delta each hold n polys for each of the ct_count
+ * ciphertexts.
+ */
+static int
+_vdec_check_statement(polyvec_t ct0, polyvec_t ct1, polyvec_t m_delta,
+                      unsigned int n, unsigned int ct_count)
+{
+  const unsigned int nelems = n * ct_count;
+
+  if (ct_count == 0 || ct0->nelems != nelems || ct1->nelems != nelems ||
+      m_delta->nelems != nelems)
+  {
+    DEBUG_PRINTF(DEBUG_LEVEL >= 1, "--> statement does not hold %u ciphertexts\n", ct_count);
+    return 0;
+  }
+  return 1;
+}
+
+/*
+ * Build the rotation matrix Ds of the ct_count ciphertexts in ct1, such that
+ * the rows k*n*d to (k+1)*n*d of Ds*sk are the coefficients of the k-th
+ * ct1*sk. If w_sk is not NULL, also compute w_sk = Ds*u_s mod q.
+ */
+static void
+_vdec_build_Ds(polymat_t Ds, intvec_ptr w_sk, polyvec_t ct1, intvec_ptr u_s,
+               unsigned int n, unsigned int ct_count)
+{
+  polyring_srcptr Rq = ct1->ring;
+  const unsigned int d = polyring_get_deg(Rq);
+  poly_ptr poly_tmp;
+  intvec_ptr coeffs;
+  unsigned int i, j, k;
+
+  INTVEC_T(rot_s_vec, d * n, Rq->q->nlimbs);
+  intvec_ptr rot_s = &rot_s_vec;
+  for (k = 0; k < ct_count; k++)
+  {
+
+    // getting k-th ct1 coeffs
+    INTVEC_T(ct1_coeffs_vec, d * n, Rq->q->nlimbs);
+    intvec_ptr ct1_coeffs = &ct1_coeffs_vec;
+    for (i = 0; i < n; i++)
+    {
+      poly_tmp = polyvec_get_elem(ct1, k * n + i);
+      coeffs = poly_get_coeffvec(poly_tmp);
+      for (j = 0; j < d; j++)
+      {
+        intvec_set_elem(ct1_coeffs, i * d + j, intvec_get_elem(coeffs, j));
+      }
+    }
+
+    INTVEC_T(ct1_coeffs_vec2, d * n, Rq->q->nlimbs);
+    intvec_ptr ct1_coeffs2 = &ct1_coeffs_vec2;
+
+    intvec_t rot_coeffvec;
+    poly_ptr Ds_elem;
+
+    // rotating coeffs of k-th ct1 and multiplying with u_s
+    intvec_reverse(ct1_coeffs, ct1_coeffs);
+    INT_T(new, 2 * Rq->q->nlimbs);
+    for (i = 0; i < (d * n); i++)
+    {
+      intvec_lrot(ct1_coeffs2, ct1_coeffs, i + 1);
+      intvec_neg_self(ct1_coeffs2);
+
+      for (j = 0; j < (ct1_coeffs2->nelems) / d; j++)
+      {
+        intvec_get_subvec(rot_coeffvec, ct1_coeffs2, 0 + j * d, d, 1); // XXX correct
+        Ds_elem = polymat_get_elem(Ds, k * (n * d) + i, j);
+        poly_set_coeffvec(Ds_elem, rot_coeffvec);
+      }
+
+      if (w_sk == NULL)
+        continue;
+
+      intvec_dot(new, ct1_coeffs2, u_s);
+
+      int_mod(new, new, Rq->q);
+      int_redc(new, new, Rq->q);
+      intvec_set_elem(rot_s, i, new);
+    }
+
+    if (w_sk == NULL)
+      continue;
+
+    for (i = 0; i < (n * d); i++)
+    {
+      intvec_set_elem(w_sk, k * (d * n) + i, intvec_get_elem(rot_s, i));
+    }
+  }
+}
+
+/*
+ * Initialize the fiat-shamir hash with the commitment tA1 and the public
+ * statement (ct0, ct1, m_delta) of ct_count ciphertexts. The entries of tB are absorbed as the prover
+ * computes them: ty and tbeta into the challenge seed for z_v, then tg, and
+ * t in lnp_quad_many.
+ */
+static void
+_vdec_statement_hash(uint8_t hashp[32], polyvec_t tA1, polyvec_t ct0,
+                     polyvec_t ct1, polyvec_t m_delta, unsigned int ct_count,
+                     const lnp_quad_eval_params_t params)
+{
+  polyring_srcptr Rq = params->quad_eval->ring;
+  const unsigned int d = polyring_get_deg(Rq);
+  const unsigned int log2q = polyring_get_log2q(Rq);
+  polyvec_ptr vs[] = {tA1, ct0, ct1, m_delta};
+  shake128_state_t hstate;
+  coder_state_t cstate;
+  polyvec_t v, subv;
+  uint8_t count[4];
+  unsigned int i, j;
+  /* the statement grows with ct_count, so it is encoded one poly at a time */
+  uint8_t out[CEIL(log2q * d, 8) + 1];
+
+  memset(hashp, 0xff, 32);
+  count[0] = ct_count & 0xff;
+  count[1] = (ct_count >> 8) & 0xff;
+  count[2] = (ct_count >> 16) & 0xff;
+  count[3] = (ct_count >> 24) & 0xff;
+
+  shake128_init(hstate);
+  shake128_absorb(hstate, hashp, 32);
+  shake128_absorb(hstate, count, sizeof(count));
+  for (i = 0; i < sizeof(vs) / sizeof(vs[0]); i++)
+  {
+    /* encode a reduced copy, the statement is used as is afterwards */
+    polyvec_alloc(v, Rq, vs[i]->nelems);
+    polyvec_set(v, vs[i]);
+    polyvec_fromcrt(v);
+    polyvec_mod(v, v);
+    polyvec_redp(v, v);
+
+    for (j = 0; j < v->nelems; j++)
+    {
+      polyvec_get_subvec(subv, v, j, 1, 1);
+      coder_enc_begin(cstate, out);
+      coder_enc_urandom3(cstate, subv, Rq->q, log2q);
+      coder_enc_end(cstate);
+      shake128_absorb(hstate, out, coder_get_offset(cstate) >> 3);
+    }
+
+    polyvec_free(v);
+  }
+  shake128_squeeze(hstate, hashp, 32);
+  shake128_clear(hstate);
+}
+
+/*
+ * Recompute the fiat-shamir hashes of the prover from tA1, the statement and
+ * the commitment tB: hash0 is the challenge seed for z_v and hashp the hash
+ * after absorbing tg.
+ */
+static void
+_vdec_challenges(uint8_t hashp[32], uint8_t hash0[32], polyvec_t tA1,
+                 polyvec_t tB, polyvec_t ct0, polyvec_t ct1, polyvec_t m_delta,
+                 unsigned int ct_count, const lnp_quad_eval_params_t params)
+{
+  abdlop_params_srcptr abdlop = params->quad_eval;
+  polyring_srcptr Rq = abdlop->ring;
+  const unsigned int d = polyring_get_deg(Rq);
+  const unsigned int log2q = polyring_get_log2q(Rq);
+  const unsigned int lambda = params->lambda;
+  const unsigned int outmax =
+      MAX(CEIL(256 * 2 * log2q + d * log2q, 8), CEIL(log2q * d * lambda / 2, 8)) + 1;
+  shake128_state_t hstate;
+  coder_state_t cstate;
+  polyvec_t tyv, tbeta, tg;
+  uint8_t out[outmax];
+  unsigned int outlen;
+
+  _vdec_statement_hash(hashp, tA1, ct0, ct1, m_delta, ct_count, params);
+
+  /* tB = tB_,ty,tbeta */
+  polyvec_get_subvec(tyv, tB, 0, 256 / d, 1);
+  polyvec_get_subvec(tbeta, tB, 256 / d, 1, 1);
+
+  coder_enc_begin(cstate, out);
+  coder_enc_urandom3(cstate, tyv, Rq->q, log2q);
+  coder_enc_urandom3(cstate, tbeta, Rq->q, log2q);
+  coder_enc_end(cstate);
+  outlen = coder_get_offset(cstate) >> 3;
+
+  shake128_init(hstate);
+  shake128_absorb(hstate, hashp, 32);
+  shake128_absorb(hstate, out, outlen);
+  shake128_squeeze(hstate, hashp, 32);
+  shake128_clear(hstate);
+  memcpy(hash0, hashp, 32);
+
+  /* tB = (tB_,tg,t) */
+  polyvec_get_subvec(tg, tB, abdlop->l, lambda / 2, 1);
+
+  coder_enc_begin(cstate, out);
+  coder_enc_urandom3(cstate, tg, Rq->q, log2q);
+  coder_enc_end(cstate);
+  outlen = coder_get_offset(cstate) >> 3;
+
+  shake128_init(hstate);
+  shake128_absorb(hstate, hashp, 32);
+  shake128_absorb(hstate, out, outlen);
+  shake128_squeeze(hstate, hashp, 32);
+  shake128_clear(hstate);
+}
+
+/*
+ * Allocate and accumulate the lambda/2 schwartz-zippel equations and the
+ * beta equation. Shared by prover and verifier.
+ */
+static void
+_vdec_quadeqs(spolymat_ptr R2prime_sz[], spolyvec_ptr r1prime_sz[],
+              poly_ptr r0prime_sz[], polymat_t Ds, intvec_ptr sum_tmp,
+              polyvec_t zv, const uint8_t hashp[32], const uint8_t hash0[32],
+              const lnp_quad_eval_params_t params, unsigned int nprime)
+{
+  abdlop_params_srcptr abdlop = params->quad_eval;
+  polyring_srcptr Rq = abdlop->ring;
+  const unsigned int d = polyring_get_deg(Rq);
+  const unsigned int lambda = params->lambda;
+  const unsigned int m1 = abdlop->m1;
+  const unsigned int l = abdlop->l;
+  const unsigned int short_l = 0;
+  const unsigned int loff = 256 / d;
+  unsigned int i;
+  poly_ptr poly;
+  int_ptr coeff;
+
   spolymat_t R2t;
   spolyvec_t r1t;
   poly_t r0t;
   const unsigned int n_ = 2 * (m1 + l);
   const unsigned int np2 = 2 * (m1 + params->quad_many->l);
-  spolymat_ptr R2prime_sz[lambda / 2 + 1], R2primei; // double check: the +1 should be for beta
-  spolyvec_ptr r1prime_sz[lambda / 2 + 1], r1primei;
-  poly_ptr r0prime_sz[lambda / 2 + 1], r0primei;
+  spolymat_ptr R2primei; // double check: the +1 should be for beta
+  spolyvec_ptr r1primei;
+  poly_ptr r0primei;
   spolymat_ptr R2prime_sz2[lambda / 2];
   spolyvec_ptr r1prime_sz2[lambda / 2];
   poly_ptr r0prime_sz2[lambda / 2];
@@ -709,7 +1102,7 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
   poly = spolymat_insert_elem(R2prime_sz[i], ibeta, ibeta);
   poly_set_zero(poly);
   coeff = poly_get_coeff(poly, 0);
-  int_set(coeff, params1_inv4); // double check inv4 which was added to quad_eval_params
+  int_set(coeff, params->inv4); // double check inv4 which was added to quad_eval_params
   poly = spolymat_insert_elem(R2prime_sz[i], ibeta, ibeta + 1);
   poly_set_zero(poly);
   coeff = poly_get_coeff(poly, 0);
@@ -717,7 +1110,7 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
   poly = spolymat_insert_elem(R2prime_sz[i], ibeta + 1, ibeta + 1);
   poly_set_zero(poly);
   coeff = poly_get_coeff(poly, 0);
-  int_set(coeff, params1_inv4);
+  int_set(coeff, params->inv4);
   R2prime_sz[i]->sorted = 1;
 
   r1prime_sz[i] = NULL;
@@ -756,21 +1149,26 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
                            R2prime_sz2[i], r1prime_sz2[i], r0prime_sz2[i],
                            params);
   }
+}
+
+/* turn the accumulated equations into quadeqs for lnp_quad_many, given h */
+static void
+_vdec_finalize_quadeqs(spolymat_ptr R2prime_sz[], spolyvec_ptr r1prime_sz[],
+                       poly_ptr r0prime_sz[], polyvec_t h,
+                       const lnp_quad_eval_params_t params)
+{
+  abdlop_params_srcptr abdlop = params->quad_eval;
+  const unsigned int lambda = params->lambda;
+  const unsigned int np2 = 2 * (abdlop->m1 + params->quad_many->l);
+  unsigned int i;
+  poly_ptr poly;
 
-  POLY_T(tmp1, Rq);
-  /* compute/output hi and set up quadeqs for lower level protocol */
   for (i = 0; i < lambda / 2; i++)
   {
-    polyvec_get_subvec(subv, s, 0, n_, 1);
-
-    __evaleq(tmp1, R2prime_sz[i], r1prime_sz[i], r0prime_sz[i], subv);
-    poly = polyvec_get_elem(h_our, i); /* gi */
-    poly_add(poly, poly, tmp1, 0);     /* hi = gi + schwarz zippel */
-
-    /* build quadeqs */
     DEBUG_PRINTF(DEBUG_LEVEL >= 2, "set up quadeq %u", i);
 
     /* r0 */
+    poly = polyvec_get_elem(h, i);
     poly_sub(r0prime_sz[i], r0prime_sz[i], poly, 0); /* r0i -= -hi */
 
     /* r1 */
@@ -785,81 +1183,181 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
     R2prime_sz[i]->ncols = np2;
     R2prime_sz[i]->nelems_max = NELEMS_DIAG(np2);
   }
-  // # endregion
+}
 
-  memcpy(hashv, hashp, 32);
-  lnp_quad_many_prove(hashp, tB, c, z1, z21, hint, s1, m, s2, tA2, A1, A2prime,
-                      Bprime, R2prime_sz, r1prime_sz, lambda / 2 + 1,
-                      seed_cont2, params->quad_many);
-  DEBUG_PRINTF(DEBUG_LEVEL >= 2, "finished proof generation\n\n");
+/*
+ * Proof encoding: u32 LE length of the uniform part, the uniform part
+ * (tA1,tB,h) encoded mod q, then the small part (c,z1,z21,hint,zv) as
+ * int64 LE coefficients.
+ */
+static size_t
+_vdec_proof_len_small(const lnp_quad_eval_params_t params)
+{
+  abdlop_params_srcptr abdlop = params->quad_eval;
+  const unsigned int d = polyring_get_deg(abdlop->ring);
 
-  /************************************************************************/
-  /*                                                                      */
-  /*                            OUR VERIFICATION                          */
-  /*                                                                      */
-  /************************************************************************/
+  return 8 * d * (1 + abdlop->m1 + abdlop->m2 + 256 / d);
+}
 
-  INT_T(linf, int_get_nlimbs(Rq->q));
-  polyvec_fromcrt(zv);
-  polyvec_linf(linf, zv);
-  int zv_valid = (int_le(linf, params1_Bz4));
+static size_t
+_vdec_proof_len_uniform(const lnp_quad_eval_params_t params)
+{
+  abdlop_params_srcptr abdlop = params->quad_eval;
+  polyring_srcptr Rq = abdlop->ring;
+  const unsigned int d = polyring_get_deg(Rq);
+  const unsigned int log2q = polyring_get_log2q(Rq);
+  const unsigned int nelems =
+      abdlop->kmsis + abdlop->l + abdlop->lext + params->lambda / 2;
 
-  DEBUG_PRINTF(DEBUG_LEVEL >= 1, "--> zv bound verification result: %d\n", zv_valid);
+  return CEIL(log2q * d * nelems, 8) + 1;
+}
 
-  // int b1 = 1, b2 = 1;
-  int h_our_valid1 = 1;
-  int h_our_valid2 = 1;
-  for (i = 0; i < lambda / 2; i++)
+static size_t
+_vdec_enc_small(uint8_t *out, polyvec_t v)
+{
+  const unsigned int d = polyring_get_deg(v->ring);
+  poly_ptr poly;
+  intvec_ptr coeffs;
+  uint64_t coeff;
+  unsigned int i, j, k;
+  size_t off = 0;
+
+  for (i = 0; i < v->nelems; i++)
   {
-    poly = polyvec_get_elem(h_our, i);
-    coeff = poly_get_coeff(poly, 0);
-    if (int_eqzero(coeff) != 1)
-    {
-      h_our_valid1 = 0;
-      DEBUG_PRINTF(DEBUG_LEVEL >= 2, "coeff 0 is ");
-      int_dump(coeff);
-    }
-    coeff = poly_get_coeff(poly, d / 2);
-    if (int_eqzero(coeff) != 1)
+    poly = polyvec_get_elem(v, i);
+    poly_fromcrt(poly);
+    poly_mod(poly, poly);
+    poly_redc(poly, poly);
+    coeffs = poly_get_coeffvec(poly);
+    for (j = 0; j < d; j++)
     {
-      h_our_valid2 = 0;
-      DEBUG_PRINTF(DEBUG_LEVEL >= 2, "coeff d/2 is ");
-      int_dump(coeff);
+      coeff = (uint64_t)intvec_get_elem_i64(coeffs, j);
+      for (k = 0; k < 8; k++)
+        out[off++] = (uint8_t)(coeff >> (8 * k));
     }
   }
-  DEBUG_PRINTF(DEBUG_LEVEL >= 1, "--> h_our coeff verification result: %d, %d\n", h_our_valid1, h_our_valid2);
-
-  /* expect successful verification */
+  return off;
+}
 
-  int quad_many_valid = lnp_quad_many_verify(hashv, c, z1, z21, hint, tA1, tB, A1, A2prime,
-                           Bprime, R2prime_sz, r1prime_sz, r0prime_sz,
-                           lambda / 2 + 1, params->quad_many);
+static size_t
+_vdec_dec_small(polyvec_t v, const uint8_t *in)
+{
+  const unsigned int d = polyring_get_deg(v->ring);
+  intvec_ptr coeffs;
+  uint64_t coeff;
+  unsigned int i, j, k;
+  size_t off = 0;
 
-  DEBUG_PRINTF(DEBUG_LEVEL >= 1, "--> quad_many verification result: %d\n", quad_many_valid);
+  for (i = 0; i < v->nelems; i++)
+  {
+    coeffs = poly_get_coeffvec(polyvec_get_elem(v, i));
+    for (j = 0; j < d; j++)
+    {
+      coeff = 0;
+      for (k = 0; k < 8; k++)
+        coeff |= (uint64_t)in[off++] << (8 * k);
+      intvec_set_elem_i64(coeffs, j, (int64_t)coeff);
+    }
+  }
+  return off;
+}
 
-  /************************************************************************/
-  /*                                                                      */
-  /*                        END OF OUR CUSTOM PROOF                       */
-  /*                                                                      */
-  /************************************************************************/
+static int
+_vdec_proof_encode(uint8_t **out, size_t *outlen, polyvec_t tA1, polyvec_t tB,
+                   polyvec_t h, poly_t c, polyvec_t z1, polyvec_t z21,
+                   polyvec_t hint, polyvec_t zv,
+                   const lnp_quad_eval_params_t params)
+{
+  polyring_srcptr Rq = params->quad_eval->ring;
+  const unsigned int log2q = polyring_get_log2q(Rq);
+  coder_state_t cstate;
+  polyvec_t cv;
+  uint8_t *buf;
+  size_t ulen, off;
+
+  buf = malloc(4 + _vdec_proof_len_uniform(params) + _vdec_proof_len_small(params));
+  if (buf == NULL)
+    return 0;
+
+  polyvec_fromcrt(tA1);
+  polyvec_mod(tA1, tA1);
+  polyvec_redp(tA1, tA1);
+  polyvec_fromcrt(tB);
+  polyvec_mod(tB, tB);
+  polyvec_redp(tB, tB);
+  polyvec_fromcrt(h);
+  polyvec_mod(h, h);
+  polyvec_redp(h, h);
+
+  coder_enc_begin(cstate, buf + 4);
+  coder_enc_urandom3(cstate, tA1, Rq->q, log2q);
+  coder_enc_urandom3(cstate, tB, Rq->q, log2q);
+  coder_enc_urandom3(cstate, h, Rq->q, log2q);
+  coder_enc_end(cstate);
+  ulen = coder_get_offset(cstate) >> 3;
+
+  buf[0] = (uint8_t)ulen;
+  buf[1] = (uint8_t)(ulen >> 8);
+  buf[2] = (uint8_t)(ulen >> 16);
+  buf[3] = (uint8_t)(ulen >> 24);
+  off = 4 + ulen;
+
+  /* c as a polyvec of length 1 */
+  polyvec_alloc(cv, Rq, 1);
+  poly_set(polyvec_get_elem(cv, 0), c);
+  off += _vdec_enc_small(buf + off, cv);
+  polyvec_free(cv);
+
+  off += _vdec_enc_small(buf + off, z1);
+  off += _vdec_enc_small(buf + off, z21);
+  off += _vdec_enc_small(buf + off, hint);
+  off += _vdec_enc_small(buf + off, zv);
+
+  *out = buf;
+  *outlen = off;
+  return 1;
+}
 
-  poly_free(c);
-  polyvec_free(s1);
-  polyvec_free(s2);
-  polyvec_free(m);
-  polyvec_free(tA1);
-  polyvec_free(tA2);
-  polyvec_free(tB);
-  polyvec_free(z1);
-  polyvec_free(z21);
-  polyvec_free(hint);
-  polyvec_free(h);
-  polyvec_free(s);
-  polyvec_free(tmp);
-  polymat_free(A1);
-  polymat_free(A2prime);
-  polymat_free(Bprime);
-  return zv_valid && h_our_valid1 && h_our_valid2 && quad_many_valid;
+static int
+_vdec_proof_decode(polyvec_t tA1, polyvec_t tB, polyvec_t h, poly_t c,
+                   polyvec_t z1, polyvec_t z21, polyvec_t hint, polyvec_t zv,
+                   const uint8_t *in, size_t inlen,
+                   const lnp_quad_eval_params_t params)
+{
+  polyring_srcptr Rq = params->quad_eval->ring;
+  const unsigned int log2q = polyring_get_log2q(Rq);
+  coder_state_t cstate;
+  polyvec_t cv;
+  size_t ulen, off;
+  int rc;
+
+  if (inlen < 4)
+    return 0;
+  ulen = (size_t)in[0] | (size_t)in[1] << 8 | (size_t)in[2] << 16 |
+         (size_t)in[3] << 24;
+  if (ulen > _vdec_proof_len_uniform(params) ||
+      inlen != 4 + ulen + _vdec_proof_len_small(params))
+    return 0;
+
+  coder_dec_begin(cstate, in + 4);
+  rc = coder_dec_urandom3(cstate, tA1, Rq->q, log2q);
+  rc |= coder_dec_urandom3(cstate, tB, Rq->q, log2q);
+  rc |= coder_dec_urandom3(cstate, h, Rq->q, log2q);
+  coder_dec_end(cstate);
+  if (rc != 0 || coder_get_offset(cstate) >> 3 > ulen)
+    return 0;
+  off = 4 + ulen;
+
+  polyvec_alloc(cv, Rq, 1);
+  off += _vdec_dec_small(cv, in + off);
+  poly_set(c, polyvec_get_elem(cv, 0));
+  polyvec_free(cv);
+
+  off += _vdec_dec_small(z1, in + off);
+  off += _vdec_dec_small(z21, in + off);
+  off += _vdec_dec_small(hint, in + off);
+  off += _vdec_dec_small(zv, in + off);
+  return off == inlen;
 }
 
 // Function to print an array of uint8_t values with a description
@@ -989,8 +1487,6 @@ _diag(unsigned int *row, unsigned int *col, unsigned int r, unsigned int c)
   }
 }
 
-#define MAX(x, y) ((x) >= (y) ? (x) : (y))
-
 /*
  * r = U^T*auto(a) = U*auto(a)
  * for each dim 2 subvec:
@@ -1495,8 +1991,10 @@ __schwartz_zippel_accumulate_z(spolymat_ptr R2i[], spolyvec_ptr r1i[],
   // INTVEC_T (u_, nprime * d, Rq->q->nlimbs);
   INTVEC_T(z4_, 256, Rq->q->nlimbs);
   INTMAT_T(V, lambda, 256, Rq->q->nlimbs);
-  INTMAT_T(vR_, lambda, nprime * d, Rq->q->nlimbs);
-  INTMAT_T(vR, lambda, nprime * d, 2 * Rq->q->nlimbs);
+  // vR_ and vR grow with the number of ciphertexts, so they are not kept on the stack
+  intmat_t vR_, vR;
+  intmat_alloc(vR_, lambda, nprime * d, Rq->q->nlimbs);
+  intmat_alloc(vR, lambda, nprime * d, 2 * Rq->q->nlimbs);
   INTVEC_T(vRu, lambda, 2 * Rq->q->nlimbs);
   intmat_urandom(V, q, log2q, seed, dom);
 
@@ -1756,4 +2254,6 @@ __schwartz_zippel_accumulate_z(spolymat_ptr R2i[], spolyvec_ptr r1i[],
     polymat_free(vRDm);
   // polymat_free (vRpol);
   polymat_free(mat);
+  intmat_free(vR_);
+  intmat_free(vR);
 }
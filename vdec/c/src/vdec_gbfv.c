@@ -6,6 +6,13 @@
 #include <mpfr.h>
 #include <sys/time.h>
 
+/* Linked into libvdecapi next to vdec.c: rename the helpers both files define. */
+#define print_uint8_array gbfv_print_uint8_array
+#define print_int64_array gbfv_print_int64_array
+#define print_polyvec_element gbfv_print_polyvec_element
+#define intvec_lrot_pos gbfv_intvec_lrot_pos
+#define intvec_reverse gbfv_intvec_reverse
+
 #define N 1        /* number of quadratic equations */
 #define M 1        /* number of quadratic eval equations */
 #define CT_COUNT 1 /* number of ciphertexts */
@@ -16,7 +23,8 @@
 /* Number of elements in an n x n (upper) diagonal matrix. */
 #define NELEMS_DIAG(n) (((n) * (n) - (n)) / 2 + (n))
 
-int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
+/* Proves and checks the decryption in one go; the GBFV proof is not serialized. */
+int vdec_gbfv_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
                         polyvec_t sk, int8_t sk_sign[], polyvec_t ct0, polyvec_t ct1,
                         polyvec_t m_delta, unsigned int fhe_degree);
 
@@ -137,9 +145,7 @@ _scatter_vec(spolyvec_ptr r1, spolyvec_ptr r1_, unsigned int m1,
   r1->sorted = 1;
 }
 
-int main(int argc, char *argv[]){}
-
-int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
+int vdec_gbfv_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
                         polyvec_t sk, int8_t sk_sign[], polyvec_t ct0, polyvec_t ct1,
                         polyvec_t m_delta, unsigned int fhe_degree)
 {
@@ -946,7 +952,7 @@ int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
   polymat_free(A2prime);
   polymat_free(Bprime);
 
-  return 1;
+  return b;
 }
 
 // Function to print an array of uint8_t values with a description
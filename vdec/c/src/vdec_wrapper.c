@@ -2,15 +2,68 @@
 #include "../lazer/src/memory.h"
 #include <stdio.h>
 
-int vdec_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
-                   polyvec_t sk, int8_t sk_sign[], polyvec_t ct0, polyvec_t ct1,
-                   polyvec_t m_delta, unsigned int fhe_degree);
+int vdec_lnp_tbox_prove(uint8_t **proof, size_t *prooflen, uint8_t seed[32],
+                        const lnp_quad_eval_params_t params, polyvec_t sk,
+                        int8_t sk_sign[], polyvec_t ct0, polyvec_t ct1,
+                        polyvec_t m_delta, unsigned int fhe_degree,
+                        unsigned int ct_count);
+int vdec_lnp_tbox_verify(const uint8_t *proof, size_t prooflen,
+                         uint8_t seed[32], const lnp_quad_eval_params_t params,
+                         polyvec_t ct0, polyvec_t ct1, polyvec_t m_delta,
+                         unsigned int fhe_degree, unsigned int ct_count);
+int vdec_gbfv_lnp_tbox(uint8_t seed[32], const lnp_quad_eval_params_t params,
+                       polyvec_t sk, int8_t sk_sign[], polyvec_t ct0,
+                       polyvec_t ct1, polyvec_t m_delta,
+                       unsigned int fhe_degree);
 
-// verify_vdec_lnp_tbox is declared in vdec_wrapper.h now
+// Parameter sets ordered by the largest FHE ring degree they support, from
+// params1 (m1 * d = 3072) to params_logn14. `make params` regenerates them.
+#include "vdec_params_logn12.h"
+#include "vdec_params_logn13.h"
+#include "vdec_params_logn14.h"
 
-polyring_srcptr GetRqFromVdecParams1(void)
+static lnp_quad_eval_params_srcptr vdec_params[] = {
+    params1,
+    params_logn12,
+    params_logn13,
+    params_logn14,
+};
+
+// fits reports whether the witness of params fits a secret key of fhe_degree
+// coefficients.
+static int fits(lnp_quad_eval_params_srcptr params, unsigned int fhe_degree)
 {
-    return params1->quad_eval->ring;
+    abdlop_params_srcptr abdlop = params->quad_eval;
+    unsigned int d = polyring_get_deg(abdlop->ring);
+
+    return fhe_degree % d == 0 && fhe_degree / d <= abdlop->m1;
+}
+
+// GetVdecParams returns the smallest parameter set whose witness fits a secret key
+// of fhe_degree coefficients, or NULL if there is none.
+lnp_quad_eval_params_srcptr GetVdecParams(unsigned int fhe_degree)
+{
+    for (size_t i = 0; i < sizeof(vdec_params) / sizeof(vdec_params[0]); i++)
+    {
+        if (fits(vdec_params[i], fhe_degree))
+            return vdec_params[i];
+    }
+    return NULL;
+}
+
+// GetVdecGbfvParams returns params1 if it fits a secret key of fhe_degree
+// coefficients, or NULL: vdec_gbfv.c hardcodes the rejection sampling and norm
+// bounds of params1, so GBFV proofs cannot use the other parameter sets.
+lnp_quad_eval_params_srcptr GetVdecGbfvParams(unsigned int fhe_degree)
+{
+    return fits(params1, fhe_degree) ? params1 : NULL;
+}
+
+polyring_srcptr GetVdecParamsRing(lnp_quad_eval_params_srcptr params)
+{
+    if (!params)
+        return NULL;
+    return params->quad_eval->ring;
 }
 
 polyvec_struct *CreatePolyvec(polyring_srcptr Rq, unsigned int nelems)
@@ -69,7 +122,16 @@ polyring_srcptr GetPolyvecRing(polyvec_struct *pv_s_ptr)
     return ((polyvec_ptr)pv_s_ptr)->ring;
 }
 
+// bounded reports whether the noise of ct_count ciphertexts of fhe_degree fits
+// the VDEC_NOISE_DIM coefficients the parameter sets bound.
+static int bounded(unsigned int fhe_degree, unsigned int ct_count)
+{
+    return ct_count > 0 &&
+           (unsigned long long)ct_count * fhe_degree <= VDEC_NOISE_DIM;
+}
+
 int ProveVdecLnpTbox(
+    lnp_quad_eval_params_srcptr params,
     uint8_t seed[32],
     polyvec_struct *sk_s_ptr,
     int8_t sk_sign[],
@@ -77,11 +139,56 @@ int ProveVdecLnpTbox(
     polyvec_struct *ct0_s_ptr,
     polyvec_struct *ct1_s_ptr,
     polyvec_struct *m_delta_s_ptr,
-    unsigned int fhe_degree)
+    unsigned int fhe_degree,
+    unsigned int ct_count,
+    uint8_t **proof,
+    size_t *proof_len)
 {
     (void)sk_sign_len;
 
-    return vdec_lnp_tbox(seed, params1, sk_s_ptr, sk_sign,
+    if (!bounded(fhe_degree, ct_count))
+        return 0;
+    return vdec_lnp_tbox_prove(proof, proof_len, seed, params,
+                  sk_s_ptr, sk_sign,
+                  ct0_s_ptr, ct1_s_ptr,
+                  m_delta_s_ptr, fhe_degree, ct_count);
+}
+
+int VerifyVdecLnpTbox(
+    lnp_quad_eval_params_srcptr params,
+    uint8_t seed[32],
+    polyvec_struct *ct0_s_ptr,
+    polyvec_struct *ct1_s_ptr,
+    polyvec_struct *m_delta_s_ptr,
+    unsigned int fhe_degree,
+    unsigned int ct_count,
+    const uint8_t *proof,
+    size_t proof_len)
+{
+    if (!bounded(fhe_degree, ct_count))
+        return 0;
+    return vdec_lnp_tbox_verify(proof, proof_len, seed, params,
+                  ct0_s_ptr, ct1_s_ptr,
+                  m_delta_s_ptr, fhe_degree, ct_count);
+}
+
+int ProveVdecGbfvLnpTbox(
+    lnp_quad_eval_params_srcptr params,
+    uint8_t seed[32],
+    polyvec_struct *sk_s_ptr,
+    int8_t sk_sign[],
+    polyvec_struct *ct0_s_ptr,
+    polyvec_struct *ct1_s_ptr,
+    polyvec_struct *m_delta_s_ptr,
+    unsigned int fhe_degree)
+{
+    return vdec_gbfv_lnp_tbox(seed, params,
+                  sk_s_ptr, sk_sign,
                   ct0_s_ptr, ct1_s_ptr,
                   m_delta_s_ptr, fhe_degree);
 }
+
+void FreeVdecProof(uint8_t *proof)
+{
+    free(proof);
+}
@@ -6,12 +6,19 @@
 #include <stdint.h>
 #include <stdlib.h>
 
+// VDEC_NOISE_DIM is the number of decryption noise coefficients the parameter
+// sets bound (noise_dim in vdec_params_generator.sage), so a proof covers at
+// most VDEC_NOISE_DIM / fhe_degree ciphertexts.
+#define VDEC_NOISE_DIM (12288 * 64)
+
 #ifdef __cplusplus
 extern "C"
 {
 #endif
 
-    polyring_srcptr GetRqFromVdecParams1(void);
+    lnp_quad_eval_params_srcptr GetVdecParams(unsigned int fhe_degree);
+    lnp_quad_eval_params_srcptr GetVdecGbfvParams(unsigned int fhe_degree);
+    polyring_srcptr GetVdecParamsRing(lnp_quad_eval_params_srcptr params);
     
     polyvec_struct *CreatePolyvec(polyring_srcptr Rq, unsigned int nelems);
     void FreePolyvec(polyvec_struct *pv_s_ptr);
@@ -20,6 +27,7 @@ extern "C"
     polyring_srcptr GetPolyvecRing(polyvec_struct *pv_s_ptr);
 
     int ProveVdecLnpTbox(
+        lnp_quad_eval_params_srcptr params,
         uint8_t seed[32],
         polyvec_struct *sk,
         int8_t sk_sign[],
@@ -27,9 +35,39 @@ extern "C"
         polyvec_struct *ct0,
         polyvec_struct *ct1,
         polyvec_struct *m_delta,
+        unsigned int fhe_degree,
+        unsigned int ct_count,
+        uint8_t **proof,
+        size_t *proof_len
+    );
+
+    int VerifyVdecLnpTbox(
+        lnp_quad_eval_params_srcptr params,
+        uint8_t seed[32],
+        polyvec_struct *ct0,
+        polyvec_struct *ct1,
+        polyvec_struct *m_delta,
+        unsigned int fhe_degree,
+        unsigned int ct_count,
+        const uint8_t *proof,
+        size_t proof_len
+    );
+
+    // ProveVdecGbfvLnpTbox runs the GBFV prover (vdec_gbfv.c), which checks its proof in place
+    // instead of serializing it. Returns the verification result.
+    int ProveVdecGbfvLnpTbox(
+        lnp_quad_eval_params_srcptr params,
+        uint8_t seed[32],
+        polyvec_struct *sk,
+        int8_t sk_sign[],
+        polyvec_struct *ct0,
+        polyvec_struct *ct1,
+        polyvec_struct *m_delta,
         unsigned int fhe_degree
     );
 
+    void FreeVdecProof(uint8_t *proof);
+
 #ifdef __cplusplus
 }
 #endif
@@ -0,0 +1,32 @@
+package vdec
+
+import "errors"
+
+var (
+	// ErrVdecProofInvalid is returned when a decryption proof does not verify against its statement.
+	ErrVdecProofInvalid = errors.New("decryption proof is invalid")
+	// ErrUnsupportedDegree is returned when no LaZer parameter set fits the FHE ring degree.
+	ErrUnsupportedDegree = errors.New("unsupported ring degree")
+	// ErrModulusTooLarge is returned when the ciphertext modulus does not fit the LaZer proof modulus.
+	ErrModulusTooLarge = errors.New("ciphertext modulus is too large")
+	// ErrNoiseBudget is returned when the decryption noise does not fit the bound of the pure-Go proof.
+	ErrNoiseBudget = errors.New("decryption noise exceeds the proof bound")
+	// ErrTestBackend is returned when the pure-Go backend, which is meant for tests, is asked to prove decryption under
+	// parameters it cannot handle, such as the server's.
+	ErrTestBackend = errors.New("the pure-Go decryption proof is for tests only, build with the lazer tag")
+	// ErrTooManyCiphertexts is returned when a LaZer proof is asked to cover more ciphertexts than its parameter sets
+	// bound the decryption noise of.
+	ErrTooManyCiphertexts = errors.New("too many ciphertexts for one decryption proof")
+	// ErrDecryptionMismatch is returned by the prover when the ciphertext does not decrypt to the claimed values.
+	ErrDecryptionMismatch = errors.New("ciphertext does not decrypt to the claimed values")
+	// ErrGBFVUnsupported is returned for GBFV proofs the linked backend cannot produce or verify.
+	ErrGBFVUnsupported = errors.New("GBFV decryption proofs are not supported by the linked vdec backend")
+	// ErrUnknownScheme is returned for a Scheme that is not defined.
+	ErrUnknownScheme = errors.New("unknown FHE scheme")
+	// ErrSchemeMismatch is returned when a proof was produced for a different scheme than the verifier expects.
+	ErrSchemeMismatch = errors.New("decryption proof is for a different scheme")
+	// ErrBackendMismatch is returned when a proof was produced by a different backend than the linked one.
+	ErrBackendMismatch = errors.New("decryption proof is from a different vdec backend")
+	// ErrParamsMismatch is returned when a proof was produced for different FHE parameters.
+	ErrParamsMismatch = errors.New("decryption proof is for different parameters")
+)
@@ -0,0 +1,408 @@
+//go:build lazer
+
+package vdec
+
+// LaZer backend of the verifiable decryption proof, enabled with the `lazer` build tag.
+// libvdecapi.so and its dependencies (liblazer.so/a, etc.)
+// must built and discoverable via LD_LIBRARY_PATH.
+// Run `make libvdecapi` or `make all` in the ./c/ directory.
+
+/*
+#cgo CFLAGS: -I./c/src -I./c -I./c/lazer/src -I./c/lazer/third_party/Falcon-impl-20211101 -I./c/lazer/third_party/hexl-development/hexl/include
+#cgo LDFLAGS: -L./c -lvdecapi
+#cgo LDFLAGS: -L./c/lazer -llazer
+#cgo LDFLAGS: -L./c/lazer/third_party/hexl-development/build/hexl/lib -lhexl
+#cgo LDFLAGS: -lstdc++ -lmpfr -lgmp -lm -fopenmp
+
+#include <stdint.h>
+#include <stdlib.h>
+#include <stdio.h>
+#include "c/src/vdec_wrapper.h"
+
+// Include the wrapper header which now declares all necessary types and functions
+// Matching definitions in vdec_wrapper.h
+
+// Declare other necessary C library functions not in the wrapper header
+extern void lazer_init(void);
+extern void lazer_fini(void);
+extern unsigned int polyring_get_deg(polyring_srcptr r);
+extern unsigned int polyring_get_log2q(polyring_srcptr r);
+
+*/
+import "C"
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"unsafe"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+const linkedBackend = backendLaZer
+
+// CallVdecProver calls the C implementation of the vdec prover and returns a single serialized proof that cts decrypt
+// to ms. The ciphertexts are proven together, so the proof does not grow with their number, up to the
+// maxCiphertexts a proof covers.
+func CallVdecProver(seed []byte, params bgv.Parameters, sk *rlwe.SecretKey, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice, parentSpan *core.Span) ([]byte, error) {
+	if err := checkCount(cts, ms); err != nil {
+		return nil, err
+	}
+	if err := checkCiphertexts(params, len(cts)); err != nil {
+		return nil, err
+	}
+	return callVdecProver(seed, params, sk, cts, ms, parentSpan)
+}
+
+// CallVdecVerifier calls the C implementation of the vdec verifier on a proof produced by CallVdecProver.
+func CallVdecVerifier(proof []byte, seed []byte, params bgv.Parameters, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice) error {
+	if err := checkCount(cts, ms); err != nil {
+		return err
+	}
+	if err := checkCiphertexts(params, len(cts)); err != nil {
+		return err
+	}
+	return callVdecVerifier(proof, seed, params, cts, ms)
+}
+
+// callGBFVProver runs the GBFV prover of vdec_gbfv.c for every ciphertext in cts, one at a time as vdec_gbfv.c
+// covers a single ciphertext. The prover checks its proof in place and does not serialize it, so the returned proof
+// is empty.
+func callGBFVProver(seed []byte, params bgv.Parameters, sk *rlwe.SecretKey, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice, parentSpan *core.Span) ([]byte, error) {
+	if err := checkCount(cts, ms); err != nil {
+		return nil, err
+	}
+
+	C.lazer_init()
+	defer C.lazer_fini()
+
+	if err := checkGBFVDegree(params); err != nil {
+		return nil, err
+	}
+	for k := range cts {
+		span := core.StartSpan("Witness generation", parentSpan)
+		stmt, err := newStatement(params, cts[k:k+1], ms[k:k+1])
+		if err != nil {
+			return nil, err
+		}
+		skVec, skSign, err := stmt.secretKey(params, sk)
+		if err != nil {
+			stmt.free()
+			return nil, err
+		}
+		span.End()
+
+		span = core.StartSpan("Proof generation", parentSpan)
+		seedChar := cSeed(ctSeed(seed, k))
+		result := C.ProveVdecGbfvLnpTbox(
+			stmt.params,
+			&seedChar[0],
+			skVec,
+			&skSign[0],
+			stmt.ct0,
+			stmt.ct1,
+			stmt.mDelta,
+			C.uint(stmt.degree),
+		)
+		span.End()
+		C.FreePolyvec(skVec)
+		stmt.free()
+		if result == 0 {
+			return nil, fmt.Errorf("%w: GBFV proof of ciphertext %d does not verify", ErrVdecProofInvalid, k)
+		}
+	}
+	return nil, nil
+}
+
+// maxCiphertexts is the number of ciphertexts of params whose decryption noise fits the VDEC_NOISE_DIM coefficients
+// the LaZer parameter sets bound, so that a single proof covers them.
+func maxCiphertexts(params bgv.Parameters) int {
+	return int(C.VDEC_NOISE_DIM) / params.N()
+}
+
+// checkCiphertexts rejects more ciphertexts than a single proof covers.
+func checkCiphertexts(params bgv.Parameters, count int) error {
+	if limit := maxCiphertexts(params); count > limit {
+		return fmt.Errorf("%w: %d ciphertexts, a proof for LogN %d covers at most %d", ErrTooManyCiphertexts, count, params.LogN(), limit)
+	}
+	return nil
+}
+
+func checkCount(cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice) error {
+	if len(cts) == 0 {
+		return fmt.Errorf("%w: no ciphertexts", core.ErrInvalidSize)
+	}
+	if len(cts) != len(ms) {
+		return fmt.Errorf("%w: %d ciphertexts but %d plaintexts", core.ErrDimensionMismatch, len(cts), len(ms))
+	}
+	return nil
+}
+
+// ctSeed derives a distinct seed for the GBFV proof of the k-th ciphertext.
+func ctSeed(seed []byte, k int) []byte {
+	transcript := core.NewTranscript("vdec_lazer")
+	transcript.AppendBytes("seed", seed)
+	transcript.AppendBytes("index", binary.LittleEndian.AppendUint64(nil, uint64(k)))
+	return transcript.ExtractBytes([]byte("ct_seed"), seedSize)
+}
+
+func callVdecProver(seed []byte, params bgv.Parameters, sk *rlwe.SecretKey, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice, parentSpan *core.Span) ([]byte, error) {
+	C.lazer_init()
+	defer C.lazer_fini()
+
+	span := core.StartSpan("Witness generation", parentSpan)
+
+	stmt, err := newStatement(params, cts, ms)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.free()
+	degree := stmt.degree
+
+	skVec, skSign, err := stmt.secretKey(params, sk)
+	if err != nil {
+		return nil, err
+	}
+	defer C.FreePolyvec(skVec)
+	span.End()
+
+	// Prove
+	span = core.StartSpan("Proof generation", parentSpan)
+	defer span.End()
+
+	seedChar := cSeed(seed)
+	var proof *C.uint8_t
+	var proofLen C.size_t
+	result := C.ProveVdecLnpTbox(
+		stmt.params,
+		&seedChar[0],
+		skVec,
+		&skSign[0],
+		C.uint(degree),
+		stmt.ct0,
+		stmt.ct1,
+		stmt.mDelta,
+		C.uint(degree),
+		C.uint(stmt.count),
+		&proof,
+		&proofLen,
+	)
+	if result == 0 {
+		return nil, fmt.Errorf("failed to generate proof")
+	}
+	defer C.FreeVdecProof(proof)
+
+	return C.GoBytes(unsafe.Pointer(proof), C.int(proofLen)), nil
+}
+
+func callVdecVerifier(proof []byte, seed []byte, params bgv.Parameters, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice) error {
+	if len(proof) == 0 {
+		return fmt.Errorf("%w: empty proof", ErrVdecProofInvalid)
+	}
+
+	C.lazer_init()
+	defer C.lazer_fini()
+
+	stmt, err := newStatement(params, cts, ms)
+	if err != nil {
+		return err
+	}
+	defer stmt.free()
+
+	proofC := C.CBytes(proof)
+	defer C.free(proofC)
+
+	seedChar := cSeed(seed)
+	result := C.VerifyVdecLnpTbox(
+		stmt.params,
+		&seedChar[0],
+		stmt.ct0,
+		stmt.ct1,
+		stmt.mDelta,
+		C.uint(stmt.degree),
+		C.uint(stmt.count),
+		(*C.uint8_t)(proofC),
+		C.size_t(len(proof)),
+	)
+	if result == 0 {
+		return ErrVdecProofInvalid
+	}
+
+	return nil
+}
+
+// statement is the public part of the vdec relation: the batched ciphertexts and their scaled plaintexts,
+// split into polynomials of the proof ring degree and concatenated.
+type statement struct {
+	params      C.lnp_quad_eval_params_srcptr
+	rq          C.polyring_srcptr
+	degree      int
+	proofDegree int
+	count       int
+	ct0         *C.polyvec_struct
+	ct1         *C.polyvec_struct
+	mDelta      *C.polyvec_struct
+}
+
+// checkParameters rejects parameters for which no LaZer parameter set can prove the batched ciphertexts,
+// which are at level 0, in a single proof.
+func checkParameters(params bgv.Parameters, scheme Scheme, batches int) error {
+	C.lazer_init()
+	defer C.lazer_fini()
+
+	if scheme == SchemeGBFV {
+		if err := checkGBFVDegree(params); err != nil {
+			return err
+		}
+	}
+	if _, _, _, err := lazerParameters(params, 0); err != nil {
+		return err
+	}
+	if scheme == SchemeGBFV {
+		// vdec_gbfv.c proves the ciphertexts one at a time
+		return nil
+	}
+	return checkCiphertexts(params, batches)
+}
+
+// checkGBFVDegree rejects ring degrees beyond params1, the only parameter set vdec_gbfv.c supports.
+func checkGBFVDegree(params bgv.Parameters) error {
+	if C.GetVdecGbfvParams(C.uint(params.N())) == nil {
+		return fmt.Errorf("%w: the GBFV prover only supports the params1 parameter set, not LogN %d", ErrUnsupportedDegree, params.LogN())
+	}
+	return nil
+}
+
+// lazerParameters selects the LaZer parameter set for the ring degree of params, and checks that its modulus
+// fits ciphertexts at level.
+func lazerParameters(params bgv.Parameters, level int) (C.lnp_quad_eval_params_srcptr, C.polyring_srcptr, int, error) {
+	degree := params.N()
+	lazerParams := C.GetVdecParams(C.uint(degree))
+	if lazerParams == nil {
+		// The bundled parameter sets run from params1 (LogN up to 11) to vdec_params_logn14.h
+		return nil, nil, 0, fmt.Errorf("%w: no LaZer parameter set for LogN %d, the bundled sets cover LogN up to 14",
+			ErrUnsupportedDegree, params.LogN())
+	}
+	rq := C.GetVdecParamsRing(lazerParams)
+	if rq == nil {
+		return nil, nil, 0, fmt.Errorf("failed to get Rq from LaZer parameters")
+	}
+	proofDegree := int(C.polyring_get_deg(rq))
+	if proofDegree == 0 {
+		return nil, nil, 0, fmt.Errorf("failed to get proof degree (Rq->d)")
+	}
+
+	// The proof modulus must leave room for the rotation sums of the ciphertext coefficients
+	// (see vdec_params.sage): log2(q) > log2(Q) + 2 + log2((d+3)/2)
+	ctBits := params.RingQ().AtLevel(level).ModulusAtLevel[level].BitLen()
+	if need := ctBits + 2 + bits.Len(uint(proofDegree+3)/2); need > int(C.polyring_get_log2q(rq)) {
+		return nil, nil, 0, fmt.Errorf("%w: %d bits exceed the LaZer modulus of %d bits", ErrModulusTooLarge, ctBits, int(C.polyring_get_log2q(rq)))
+	}
+	return lazerParams, rq, proofDegree, nil
+}
+
+// newStatement concatenates the coefficients of cts and of their plaintexts ms, scaled as in the ciphertexts,
+// checking that the LaZer modulus fits every ciphertext at its level.
+func newStatement(params bgv.Parameters, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice) (*statement, error) {
+	degree := params.N()
+	encoder := bgv.NewEncoder(params)
+
+	var lazerParams C.lnp_quad_eval_params_srcptr
+	var rq C.polyring_srcptr
+	var proofDegree int
+	ct0Coeffs := make([]int64, 0, len(cts)*degree)
+	ct1Coeffs := make([]int64, 0, len(cts)*degree)
+	mScaled := make([]int64, 0, len(cts)*degree)
+	for k, ct := range cts {
+		var err error
+		if lazerParams, rq, proofDegree, err = lazerParameters(params, ct.LevelQ()); err != nil {
+			return nil, err
+		}
+		ringQ := params.RingQ().AtLevel(ct.LevelQ())
+
+		ct0Coeffs = append(ct0Coeffs, core.RingPolyToCoeffsCentered(ringQ, *ct.Value[0].CopyNew(), ct.MetaData.IsMontgomery, ct.MetaData.IsNTT)...)
+		ct1Coeffs = append(ct1Coeffs, core.RingPolyToCoeffsCentered(ringQ, *ct.Value[1].CopyNew(), ct.MetaData.IsMontgomery, ct.MetaData.IsNTT)...)
+
+		pt := bgv.NewPlaintext(params, params.MaxLevel())
+		pt.MetaData = ct.MetaData
+		if err := encoder.Encode(ms[k], pt); err != nil {
+			return nil, err
+		}
+		mScaled = append(mScaled, core.RingPolyToCoeffsCentered(ringQ, pt.Value, false, false)...)
+	}
+
+	stmt := &statement{params: lazerParams, rq: rq, degree: degree, proofDegree: proofDegree, count: len(cts)}
+	numPolys := len(cts) * degree / proofDegree
+
+	var err error
+	if stmt.ct0, err = newPolyvec(rq, ct0Coeffs, numPolys, proofDegree); err != nil {
+		stmt.free()
+		return nil, fmt.Errorf("failed to create ct0 polyvec: %w", err)
+	}
+	if stmt.ct1, err = newPolyvec(rq, ct1Coeffs, numPolys, proofDegree); err != nil {
+		stmt.free()
+		return nil, fmt.Errorf("failed to create ct1 polyvec: %w", err)
+	}
+	if stmt.mDelta, err = newPolyvec(rq, mScaled, numPolys, proofDegree); err != nil {
+		stmt.free()
+		return nil, fmt.Errorf("failed to create m_delta polyvec: %w", err)
+	}
+
+	return stmt, nil
+}
+
+// secretKey splits the secret key into polynomials of the proof ring degree, and returns its coefficients as signs.
+func (s *statement) secretKey(params bgv.Parameters, sk *rlwe.SecretKey) (*C.polyvec_struct, []C.int8_t, error) {
+	skRingQ := params.RingQ().AtLevel(sk.LevelQ())
+	skCoeffs := core.RingPolyToCoeffsCentered(skRingQ, *sk.Value.Q.CopyNew(), true, true)
+	if len(skCoeffs) != s.degree {
+		return nil, nil, fmt.Errorf("%w: secret key has %d coefficients, expected %d", core.ErrDimensionMismatch, len(skCoeffs), s.degree)
+	}
+
+	skSign := make([]C.int8_t, s.degree)
+	for i := range skSign {
+		skSign[i] = C.int8_t(skCoeffs[i])
+	}
+
+	skVec, err := newPolyvec(s.rq, skCoeffs, s.degree/s.proofDegree, s.proofDegree)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create sk polyvec: %w", err)
+	}
+	return skVec, skSign, nil
+}
+
+func (s *statement) free() {
+	for _, pv := range []*C.polyvec_struct{s.ct0, s.ct1, s.mDelta} {
+		if pv != nil {
+			C.FreePolyvec(pv)
+		}
+	}
+}
+
+// newPolyvec splits coeffs into numPolys polynomials of proofDegree coefficients each.
+func newPolyvec(rq C.polyring_srcptr, coeffs []int64, numPolys int, proofDegree int) (*C.polyvec_struct, error) {
+	if numPolys*proofDegree > len(coeffs) {
+		return nil, fmt.Errorf("%w: need %d coefficients, got %d", core.ErrDimensionMismatch, numPolys*proofDegree, len(coeffs))
+	}
+
+	pv := C.CreatePolyvec(rq, C.uint(numPolys))
+	if pv == nil {
+		return nil, fmt.Errorf("allocation failed")
+	}
+	for i := 0; i < numPolys; i++ {
+		polyCoeffs := coeffs[i*proofDegree : (i+1)*proofDegree]
+		C.SetPolyvecPolyCoeffs(pv, C.uint(i), (*C.int64_t)(unsafe.Pointer(&polyCoeffs[0])), C.uint(proofDegree))
+	}
+
+	return pv, nil
+}
+
+func cSeed(seed []byte) [32]C.uint8_t {
+	var seedChar [32]C.uint8_t
+	for i := range seed {
+		seedChar[i] = C.uint8_t(seed[i])
+	}
+	return seedChar
+}
@@ -0,0 +1,137 @@
+//go:build lazer
+
+package vdec_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/vdec"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// TestParameterSets checks that the bundled parameter sets cover LogN up to 14 and that larger ring degrees are
+// rejected by their LogN.
+func TestParameterSets(t *testing.T) {
+	for logN := 11; logN <= 15; logN++ {
+		params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+			LogN:             logN,
+			LogQ:             []int{60, 55},
+			PlaintextModulus: Modulus,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = vdec.CheckParameters(params, vdec.SchemeBFV, 1)
+		if logN <= 14 && err != nil {
+			t.Errorf("LogN %d: %v", logN, err)
+		}
+		if logN > 14 && (!errors.Is(err, vdec.ErrUnsupportedDegree) || !strings.Contains(err.Error(), "LogN 15")) {
+			t.Errorf("expected ErrUnsupportedDegree naming LogN 15, got %v", err)
+		}
+	}
+}
+
+// TestTooManyCiphertexts checks that no more ciphertexts than the parameter sets bound the noise of are proven at once.
+func TestTooManyCiphertexts(t *testing.T) {
+	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             14,
+		LogQ:             []int{60, 55},
+		PlaintextModulus: Modulus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vdec.CheckParameters(params, vdec.SchemeBFV, 48); err != nil {
+		t.Fatal(err)
+	}
+	if err := vdec.CheckParameters(params, vdec.SchemeBFV, 49); !errors.Is(err, vdec.ErrTooManyCiphertexts) {
+		t.Fatalf("got %v, expected %v", err, vdec.ErrTooManyCiphertexts)
+	}
+}
+
+// TestVdecCiphertexts checks that several ciphertexts are proven in a single proof, which is bound to their order.
+func TestVdecCiphertexts(t *testing.T) {
+	run(t, func(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.ClientBFV, t *testing.T) {
+		cts := make([]*rlwe.Ciphertext, 3)
+		ms := make([]bgv.IntegerSlice, len(cts))
+		for k := range cts {
+			m := make([]uint64, params.N())
+			for i := range m {
+				m[i] = uint64(k*len(m) + i)
+			}
+			plaintext := bgv.NewPlaintext(params, params.MaxLevel())
+			if err := server.Encode(m, plaintext); err != nil {
+				t.Fatal(err)
+			}
+			ct, err := server.Encryptor.EncryptNew(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cts[k], ms[k] = ct, m
+		}
+
+		seed := []byte{5}
+		proof, err := vdec.CallVdecProver(seed, params, client.SecretKey(), cts, ms, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		single, err := vdec.CallVdecProver(seed, params, client.SecretKey(), cts[:1], ms[:1], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proof) != len(single) {
+			t.Fatalf("proof of %d ciphertexts has %d bytes, the proof of one has %d", len(cts), len(proof), len(single))
+		}
+		if err := vdec.CallVdecVerifier(proof, seed, params, cts, ms); err != nil {
+			t.Fatal(err)
+		}
+
+		cts[0], cts[1] = cts[1], cts[0]
+		ms[0], ms[1] = ms[1], ms[0]
+		if err := vdec.CallVdecVerifier(proof, seed, params, cts, ms); !errors.Is(err, vdec.ErrVdecProofInvalid) {
+			t.Fatalf("expected ErrVdecProofInvalid for reordered ciphertexts, got %v", err)
+		}
+	})
+}
+
+// TestVdecOtherCiphertext checks that a proof for one ciphertext fails against another encryption of the same values
+// under the same seed, as vdec.c derives its challenges from the statement.
+func TestVdecOtherCiphertext(t *testing.T) {
+	run(t, func(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.ClientBFV, t *testing.T) {
+		m := make([]uint64, params.N())
+		for i := range m {
+			m[i] = uint64(i)
+		}
+		encrypt := func() *rlwe.Ciphertext {
+			plaintext := bgv.NewPlaintext(params, params.MaxLevel())
+			if err := server.Encode(m, plaintext); err != nil {
+				t.Fatal(err)
+			}
+			ct, err := server.Encryptor.EncryptNew(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ct
+		}
+		ct, other := encrypt(), encrypt()
+
+		seed := []byte{3}
+		ms := []bgv.IntegerSlice{m}
+		proof, err := vdec.CallVdecProver(seed, params, client.SecretKey(), []*rlwe.Ciphertext{ct}, ms, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vdec.CallVdecVerifier(proof, seed, params, []*rlwe.Ciphertext{ct}, ms); err != nil {
+			t.Fatal(err)
+		}
+		if err := vdec.CallVdecVerifier(proof, seed, params, []*rlwe.Ciphertext{other}, ms); !errors.Is(err, vdec.ErrVdecProofInvalid) {
+			t.Fatalf("expected ErrVdecProofInvalid for another ciphertext, got %v", err)
+		}
+	})
+}
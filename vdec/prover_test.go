@@ -1,13 +1,16 @@
 package vdec_test
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/nulltea/lumenos/core"
 	"github.com/nulltea/lumenos/fhe"
 	"github.com/nulltea/lumenos/vdec"
+	"github.com/nulltea/lumenos/vdec/batching"
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
 )
@@ -24,6 +27,18 @@ func TestVdecBatched(t *testing.T) {
 	run(t, testVdecBatched)
 }
 
+func TestVdecMultipleBatches(t *testing.T) {
+	run(t, testVdecMultipleBatches)
+}
+
+func TestVdecProofHeader(t *testing.T) {
+	run(t, testVdecProofHeader)
+}
+
+func TestVdecTampered(t *testing.T) {
+	run(t, testVdecTampered)
+}
+
 func run(t *testing.T, test func(bgv.Parameters, *fhe.ServerBFV, *fhe.ClientBFV, *testing.T)) {
 	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
 		LogN:             11,
@@ -74,8 +89,21 @@ func testVdecSimple(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.Cl
 		panic(err)
 	}
 	span := core.StartSpan("Prove BfvDecBatched", nil, "Prove BfvDecBatched...")
-	vdec.CallVdecProver(seed, params, client.SecretKey(), ct, m, 2048, span)
+	proof, err := vdec.CallVdecProver(seed, params, client.SecretKey(), []*rlwe.Ciphertext{ct}, []bgv.IntegerSlice{m}, span)
 	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vdec.CallVdecVerifier(proof, seed, params, []*rlwe.Ciphertext{ct}, []bgv.IntegerSlice{m}); err != nil {
+		t.Fatal(err)
+	}
+
+	m[0]++
+	if err := vdec.CallVdecVerifier(proof, seed, params, []*rlwe.Ciphertext{ct}, []bgv.IntegerSlice{m}); err == nil {
+		t.Fatal("proof verified for a wrong plaintext")
+	}
+	m[0]--
 
 	for i := range decrypted {
 		if decrypted[i] != m[i] {
@@ -119,9 +147,9 @@ func testVdecBatched(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.C
 			colsCheck[i] = ciphertexts[i].CopyNew()
 		}
 
-		instance := make([]*vdec.ColumnInstance, len(ciphertexts))
+		instance := make([]*batching.ColumnInstance, len(ciphertexts))
 		for j := range ciphertexts {
-			instance[j] = &vdec.ColumnInstance{
+			instance[j] = &batching.ColumnInstance{
 				Values: matrixColMajor[j],
 				Ct:     ciphertexts[j],
 			}
@@ -129,19 +157,23 @@ func testVdecBatched(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.C
 
 		transcript := core.NewTranscript("vdec")
 		span := core.StartSpan("Prove BfvDecBatched", nil, "Prove BfvDecBatched...")
-		err = vdec.ProveBfvDecBatched(instance, client.SecretKey(), server.Evaluator, client.Field(), transcript, span)
+		proof, err := vdec.ProveBfvDecBatched(instance, client.SecretKey(), server.Evaluator, client.Field(), transcript, vdec.SchemeBFV, vdec.DefaultBatches, span)
 		span.End()
 		if err != nil {
 			panic(err)
 		}
 
+		if err := vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), core.NewTranscript("vdec"), vdec.SchemeBFV, vdec.DefaultBatches); err != nil {
+			t.Fatal(err)
+		}
+
 		// Sanity check
-		batchColCheck, alphas, err := vdec.BatchColumns(matrixColMajor, client.Field(), transcript)
+		batchColCheck, alphas, err := batching.BatchColumns(matrixColMajor, client.Field(), transcript)
 		if err != nil {
 			panic(err)
 		}
 		start := time.Now()
-		result, err := vdec.BatchCiphertexts(ciphertexts, alphas, server.Evaluator)
+		result, err := batching.BatchCiphertexts(ciphertexts, alphas, server.Evaluator)
 		if err != nil {
 			panic(err)
 		}
@@ -173,3 +205,184 @@ func testVdecBatched(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.C
 		}
 	}
 }
+
+func testVdecMultipleBatches(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.ClientBFV, t *testing.T) {
+	const batches = 3
+	matrixColMajor, ciphertexts, err := core.RandomMatrixColMajor(256, 16, Modulus, func(u []uint64) *rlwe.Ciphertext {
+		plaintext := bgv.NewPlaintext(params, params.MaxLevel())
+		if err := client.Encode(u, plaintext); err != nil {
+			panic(err)
+		}
+		ct, err := server.Encryptor.EncryptNew(plaintext)
+		if err != nil {
+			panic(err)
+		}
+		return ct
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance := make([]*batching.ColumnInstance, len(ciphertexts))
+	for j := range ciphertexts {
+		instance[j] = &batching.ColumnInstance{Values: matrixColMajor[j], Ct: ciphertexts[j]}
+	}
+
+	span := core.StartSpan("Prove BfvDecBatched", nil)
+	proof, err := vdec.ProveBfvDecBatched(instance, client.SecretKey(), server.Evaluator, client.Field(), core.NewTranscript("vdec"), vdec.SchemeBFV, batches, span)
+	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), core.NewTranscript("vdec"), vdec.SchemeBFV, batches); err != nil {
+		t.Fatal(err)
+	}
+	if err := vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), core.NewTranscript("vdec"), vdec.SchemeBFV, 1); err == nil {
+		t.Fatal("proof verified with fewer batches")
+	}
+
+	matrixColMajor[3][7] = client.Field().Add(matrixColMajor[3][7], core.One())
+	if err := vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), core.NewTranscript("vdec"), vdec.SchemeBFV, batches); err == nil {
+		t.Fatal("proof verified for a wrong column")
+	}
+}
+
+// testVdecTampered checks that a proof only verifies against the transcript, ciphertexts and batching challenges it
+// was made for.
+func testVdecTampered(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.ClientBFV, t *testing.T) {
+	matrixColMajor, ciphertexts, err := core.RandomMatrixColMajor(256, 16, Modulus, func(u []uint64) *rlwe.Ciphertext {
+		plaintext := bgv.NewPlaintext(params, params.MaxLevel())
+		if err := client.Encode(u, plaintext); err != nil {
+			panic(err)
+		}
+		ct, err := server.Encryptor.EncryptNew(plaintext)
+		if err != nil {
+			panic(err)
+		}
+		return ct
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := make([]*batching.ColumnInstance, len(ciphertexts))
+	for j := range ciphertexts {
+		instance[j] = &batching.ColumnInstance{Values: matrixColMajor[j], Ct: ciphertexts[j]}
+	}
+
+	// The proof is bound to a Merkle root, as fhe.Proof.ProveDecrypt does.
+	transcript := func(root byte) *core.Transcript {
+		transcript := core.NewTranscript("vdec")
+		transcript.AppendBytes("root", []byte{root})
+		return transcript
+	}
+	proof, err := vdec.ProveBfvDecBatched(instance, client.SecretKey(), server.Evaluator, client.Field(), transcript(1), vdec.SchemeBFV, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), transcript(1), vdec.SchemeBFV, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), transcript(2), vdec.SchemeBFV, 1); err == nil {
+		t.Fatal("proof verified under a different root")
+	}
+	if err := vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), core.NewTranscript("other"), vdec.SchemeBFV, 1); err == nil {
+		t.Fatal("proof verified under a different transcript")
+	}
+
+	// A tampered ciphertext changes the batched ciphertext, and the challenges sampled after absorbing it.
+	tampered := slices.Clone(instance)
+	tampered[5] = &batching.ColumnInstance{Values: instance[5].Values, Ct: instance[5].Ct.CopyNew()}
+	tampered[5].Ct.Value[0].Coeffs[0][0]++
+	if err := vdec.VerifyBfvDecBatched(proof, tampered, params, client.Field(), transcript(1), vdec.SchemeBFV, 1); err == nil {
+		t.Fatal("proof verified for a tampered ciphertext")
+	}
+
+	// Challenges alpha sampled from a transcript in another state batch the same columns differently, so a proof
+	// made under them does not verify either.
+	changed := func() *core.Transcript {
+		transcript := transcript(1)
+		transcript.AppendBytes("alpha", []byte{1})
+		return transcript
+	}
+	if err := vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), changed(), vdec.SchemeBFV, 1); err == nil {
+		t.Fatal("proof verified under different batching challenges")
+	}
+	otherProof, err := vdec.ProveBfvDecBatched(instance, client.SecretKey(), server.Evaluator, client.Field(), changed(), vdec.SchemeBFV, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vdec.VerifyBfvDecBatched(otherProof, instance, params, client.Field(), transcript(1), vdec.SchemeBFV, 1); err == nil {
+		t.Fatal("proof made under different batching challenges verified")
+	}
+}
+
+func testVdecProofHeader(params bgv.Parameters, server *fhe.ServerBFV, client *fhe.ClientBFV, t *testing.T) {
+	matrixColMajor, ciphertexts, err := core.RandomMatrixColMajor(64, 4, Modulus, func(u []uint64) *rlwe.Ciphertext {
+		plaintext := bgv.NewPlaintext(params, params.MaxLevel())
+		if err := client.Encode(u, plaintext); err != nil {
+			panic(err)
+		}
+		ct, err := server.Encryptor.EncryptNew(plaintext)
+		if err != nil {
+			panic(err)
+		}
+		return ct
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := make([]*batching.ColumnInstance, len(ciphertexts))
+	for j := range ciphertexts {
+		instance[j] = &batching.ColumnInstance{Values: matrixColMajor[j], Ct: ciphertexts[j]}
+	}
+
+	if _, err := vdec.ProveBfvDecBatched(instance, client.SecretKey(), server.Evaluator, client.Field(), core.NewTranscript("vdec"), vdec.Scheme(7), 1, nil); !errors.Is(err, vdec.ErrUnknownScheme) {
+		t.Fatalf("expected ErrUnknownScheme, got %v", err)
+	}
+
+	proof, err := vdec.ProveBfvDecBatched(instance, client.SecretKey(), server.Evaluator, client.Field(), core.NewTranscript("vdec"), vdec.SchemeBFV, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func(proof []byte, params bgv.Parameters, scheme vdec.Scheme) error {
+		return vdec.VerifyBfvDecBatched(proof, instance, params, client.Field(), core.NewTranscript("vdec"), scheme, 1)
+	}
+	if err := verify(proof, params, vdec.SchemeBFV); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(proof, params, vdec.SchemeGBFV); !errors.Is(err, vdec.ErrSchemeMismatch) {
+		t.Fatalf("expected ErrSchemeMismatch, got %v", err)
+	}
+
+	otherParams, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             params.LogN() - 1,
+		LogQ:             []int{60, 55},
+		PlaintextModulus: Modulus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(proof, otherParams, vdec.SchemeBFV); !errors.Is(err, vdec.ErrParamsMismatch) {
+		t.Fatalf("expected ErrParamsMismatch, got %v", err)
+	}
+
+	// Header layout: version, scheme, backend, LogN
+	tampered := slices.Clone(proof)
+	tampered[2]++
+	if err := verify(tampered, params, vdec.SchemeBFV); !errors.Is(err, vdec.ErrBackendMismatch) {
+		t.Fatalf("expected ErrBackendMismatch, got %v", err)
+	}
+
+	tampered = slices.Clone(proof)
+	tampered[1] = byte(vdec.SchemeGBFV)
+	if err := verify(tampered, params, vdec.SchemeGBFV); !errors.Is(err, vdec.ErrGBFVUnsupported) {
+		t.Fatalf("expected ErrGBFVUnsupported, got %v", err)
+	}
+
+	if err := verify(proof[:2], params, vdec.SchemeBFV); !errors.Is(err, vdec.ErrVdecProofInvalid) {
+		t.Fatalf("expected ErrVdecProofInvalid, got %v", err)
+	}
+}
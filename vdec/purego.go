@@ -0,0 +1,461 @@
+//go:build !lazer
+
+package vdec
+
+// Pure-Go backend of the verifiable decryption proof, used unless the `lazer` build tag is set.
+// It is meant for tests and for building without the C toolchain, not for deployment: it proves a relaxed relation
+// (see below) and the server's parameters leave it no noise budget, which it refuses with ErrTestBackend.
+//
+// For ciphertexts (c0_k, c1_k) at level 0 with modulus q and the encoded plaintexts Δm_k (Δ ≈ q/t), the prover shows
+// knowledge of a short s and e_k such that c0_k + c1_k*s = Δm_k + e_k (mod q), i.e. that every ciphertext decrypts
+// to its m_k under the same key. This is a Fiat-Shamir with aborts proof of a short preimage of [c1_k, -1]: the prover
+// commits to w_k = c1_k*y_s - y_e_k for uniform masks y_s, y_e_k, derives a sparse ternary challenge c from all w_k and
+// reveals z = y + c*(s, e_1, ..., e_k), restarting whenever z would leak the witness.
+// The challenge and the response for s are shared, so the proof is amortized over the ciphertexts.
+// As usual for such proofs, soundness is relaxed (the extracted witness is short up to challenge differences)
+// and s is only shown to be short, not ternary. Proofs are larger than LaZer's, about 8*N*(k+1) bytes.
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/ring"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+const (
+	// challengeWeight is the number of ±1 coefficients of the challenge polynomial, at most the ring degree.
+	challengeWeight = 60
+	// maxAborts bounds the number of rejected attempts; each attempt is accepted with probability at least 1/e.
+	maxAborts = 1000
+	// hashSize is the size of the commitment hash the challenge is derived from.
+	hashSize = sha256.Size
+)
+
+const linkedBackend = backendPureGo
+
+// callGBFVProver rejects GBFV instances, which only the LaZer backend supports.
+func callGBFVProver(seed []byte, params bgv.Parameters, sk *rlwe.SecretKey, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice, parentSpan *core.Span) ([]byte, error) {
+	return nil, fmt.Errorf("%w: build with the lazer tag", ErrGBFVUnsupported)
+}
+
+// CallVdecProver proves that every ciphertext in cts decrypts to the corresponding values in ms under sk
+// and returns the serialized proof.
+// Soundness is relaxed: the proof shows the key is short, not that it is ternary,
+// and the extracted noise is only bounded up to challenge differences.
+func CallVdecProver(seed []byte, params bgv.Parameters, sk *rlwe.SecretKey, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice, parentSpan *core.Span) ([]byte, error) {
+	span := core.StartSpan("Witness generation", parentSpan)
+
+	stmt, err := newStatement(seed, params, cts, ms)
+	if err != nil {
+		return nil, err
+	}
+
+	skRingQ := params.RingQ().AtLevel(sk.LevelQ())
+	s := core.RingPolyToCoeffsCentered(skRingQ, *sk.Value.Q.CopyNew(), true, true)
+	if len(s) != stmt.n {
+		return nil, fmt.Errorf("%w: secret key has %d coefficients, expected %d", core.ErrDimensionMismatch, len(s), stmt.n)
+	}
+
+	e := make([][]int64, len(stmt.c1))
+	for k := range e {
+		if e[k], err = stmt.noise(k, s); err != nil {
+			return nil, err
+		}
+	}
+	span.End()
+
+	// Prove
+	span = core.StartSpan("Proof generation", parentSpan)
+	defer span.End()
+
+	var rngSeed [32]byte
+	if _, err := crand.Read(rngSeed[:]); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewChaCha8(rngSeed))
+
+	ze := make([][]int64, len(e))
+	w := make([][]uint64, len(e))
+	for range maxAborts {
+		ys := sampleUniform(rng, stmt.n, stmt.maskS)
+		ye := make([][]int64, len(e))
+		for k := range ye {
+			ye[k] = sampleUniform(rng, stmt.n, stmt.maskE)
+			w[k] = stmt.commit(k, ys, ye[k])
+		}
+		h := stmt.challengeHash(w)
+		c := sampleChallenge(h, stmt.n)
+
+		zs := mulChallengeAdd(ys, c, s)
+		for k := range ze {
+			ze[k] = mulChallengeAdd(ye[k], c, e[k])
+		}
+		if !stmt.inBounds(zs, ze) {
+			continue
+		}
+
+		return encodeProof(h, zs, ze), nil
+	}
+
+	return nil, fmt.Errorf("failed to generate proof after %d attempts", maxAborts)
+}
+
+// CallVdecVerifier checks a proof produced by CallVdecProver for the same seed, ciphertexts and values.
+func CallVdecVerifier(proof []byte, seed []byte, params bgv.Parameters, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice) error {
+	if len(proof) == 0 {
+		return fmt.Errorf("%w: empty proof", ErrVdecProofInvalid)
+	}
+
+	stmt, err := newStatement(seed, params, cts, ms)
+	if err != nil {
+		return err
+	}
+
+	h, zs, ze, err := decodeProof(proof, stmt.n, len(stmt.c1))
+	if err != nil {
+		return err
+	}
+	if !stmt.inBounds(zs, ze) {
+		return fmt.Errorf("%w: response exceeds the norm bound", ErrVdecProofInvalid)
+	}
+
+	c := sampleChallenge(h, stmt.n)
+	w := make([][]uint64, len(ze))
+	for k := range w {
+		w[k] = stmt.open(k, zs, ze[k], c)
+	}
+	if !bytes.Equal(stmt.challengeHash(w), h) {
+		return ErrVdecProofInvalid
+	}
+
+	return nil
+}
+
+// statement is the public part of the vdec relation c1_k*s - e_k = u_k with u_k = Δm_k - c0_k, over the ring at level 0.
+type statement struct {
+	ringQ *ring.Ring
+	n     int
+	q     uint64
+	delta int64
+	c1    []ring.Poly // NTT form
+	u     []ring.Poly // NTT form
+
+	// noiseBound is the largest norm of e_k the proof accepts; maskS and maskE are the norms of the masks.
+	noiseBound int64
+	maskS      int64
+	maskE      int64
+
+	// prefix binds the challenges to the seed and the statement.
+	prefix []byte
+}
+
+// checkParameters rejects parameters under which no proof of batches ciphertexts can be generated.
+func checkParameters(params bgv.Parameters, scheme Scheme, batches int) error {
+	if scheme == SchemeGBFV {
+		return fmt.Errorf("%w: build with the lazer tag", ErrGBFVUnsupported)
+	}
+	if _, err := noiseBudget(params, batches); err != nil {
+		return fmt.Errorf("%w: %w", ErrTestBackend, err)
+	}
+	return nil
+}
+
+// noiseBudget returns the largest norm of the decryption noise accepted in a proof of count ciphertexts at level 0.
+// The masks grow with the number of ciphertexts to keep the abort rate bounded,
+// and maskE must stay below Δ/2, so that the noise of the extracted witness still decrypts to m.
+func noiseBudget(params bgv.Parameters, count int) (int64, error) {
+	q := params.Q()[0]
+	t := params.PlaintextModulus()
+	bound := int64(q/4/t/uint64(params.N())/challengeWeight) / int64(count)
+	if bound == 0 {
+		return 0, fmt.Errorf("%w: a %d-bit modulus leaves no room for the decryption noise of %d ciphertexts with a %d-bit plaintext modulus",
+			ErrNoiseBudget, bits.Len64(q), count, bits.Len64(t))
+	}
+	return bound, nil
+}
+
+func newStatement(seed []byte, params bgv.Parameters, cts []*rlwe.Ciphertext, ms []bgv.IntegerSlice) (*statement, error) {
+	if len(cts) == 0 {
+		return nil, fmt.Errorf("%w: no ciphertexts", core.ErrInvalidSize)
+	}
+	if len(cts) != len(ms) {
+		return nil, fmt.Errorf("%w: %d ciphertexts but %d plaintexts", core.ErrDimensionMismatch, len(cts), len(ms))
+	}
+
+	ringQ := params.RingQ().AtLevel(0)
+	n := ringQ.N()
+	q := params.Q()[0]
+	t := params.PlaintextModulus()
+
+	count := int64(len(cts))
+	noiseBound, err := noiseBudget(params, len(cts))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTestBackend, err)
+	}
+
+	stmt := &statement{
+		ringQ:      ringQ,
+		n:          n,
+		q:          q,
+		delta:      int64(q / t),
+		c1:         make([]ring.Poly, len(cts)),
+		u:          make([]ring.Poly, len(cts)),
+		noiseBound: noiseBound,
+		maskS:      2 * int64(n) * challengeWeight * count,
+		maskE:      2 * int64(n) * challengeWeight * noiseBound * count,
+	}
+
+	transcript := core.NewTranscript("vdec")
+	transcript.AppendBytes("seed", seed)
+	for k, ct := range cts {
+		if ct.Degree() != 1 {
+			return nil, fmt.Errorf("%w: ciphertext of degree %d, expected 1", core.ErrDimensionMismatch, ct.Degree())
+		}
+		if ct.LevelQ() > 0 {
+			ct = ct.CopyNew()
+			eval := bgv.NewEvaluator(params, nil)
+			for ct.LevelQ() > 0 {
+				if err := eval.Rescale(ct, ct); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		c0 := core.RingPolyToCoeffsCentered(ringQ, *ct.Value[0].CopyNew(), ct.MetaData.IsMontgomery, ct.MetaData.IsNTT)
+		c1 := core.RingPolyToCoeffsCentered(ringQ, *ct.Value[1].CopyNew(), ct.MetaData.IsMontgomery, ct.MetaData.IsNTT)
+
+		pt := bgv.NewPlaintext(params, 0)
+		pt.MetaData = ct.MetaData.CopyNew()
+		if err := bgv.NewEncoder(params).Encode(ms[k], pt); err != nil {
+			return nil, err
+		}
+		mDelta := core.RingPolyToCoeffsCentered(ringQ, *pt.Value.CopyNew(), pt.IsMontgomery, pt.IsNTT)
+
+		u := make([]int64, n)
+		for i := range u {
+			u[i] = mDelta[i] - c0[i]
+		}
+
+		transcript.AppendBytes("c0", encodeCoeffs(c0))
+		transcript.AppendBytes("c1", encodeCoeffs(c1))
+		transcript.AppendBytes("m_delta", encodeCoeffs(mDelta))
+
+		stmt.c1[k] = stmt.toNTT(c1)
+		stmt.u[k] = stmt.toNTT(u)
+	}
+	stmt.prefix = transcript.ExtractBytes([]byte("vdec_statement"), hashSize)
+
+	return stmt, nil
+}
+
+// noise returns e_k = c0_k + c1_k*s - Δm_k, which the prover needs as part of the witness.
+func (st *statement) noise(k int, s []int64) ([]int64, error) {
+	p := st.ringQ.NewPoly()
+	st.ringQ.MulCoeffsBarrett(st.c1[k], st.toNTT(s), p)
+	st.ringQ.Sub(p, st.u[k], p)
+	st.ringQ.INTT(p, p)
+
+	e := make([]int64, st.n)
+	for i, v := range p.Coeffs[0] {
+		e[i] = st.center(v)
+		norm := max(e[i], -e[i])
+		if 2*norm >= st.delta {
+			return nil, ErrDecryptionMismatch
+		}
+		if norm > st.noiseBound {
+			return nil, fmt.Errorf("%w: decryption noise exceeds %d", ErrNoiseBudget, st.noiseBound)
+		}
+	}
+	return e, nil
+}
+
+// commit returns the coefficients of w_k = c1_k*ys - ye.
+func (st *statement) commit(k int, ys, ye []int64) []uint64 {
+	w := st.ringQ.NewPoly()
+	st.ringQ.MulCoeffsBarrett(st.c1[k], st.toNTT(ys), w)
+	st.ringQ.Sub(w, st.toNTT(ye), w)
+	st.ringQ.INTT(w, w)
+	return w.Coeffs[0]
+}
+
+// open recomputes the commitment w_k = c1_k*zs - ze - c*u_k from the response.
+func (st *statement) open(k int, zs, ze []int64, c challenge) []uint64 {
+	w := st.ringQ.NewPoly()
+	st.ringQ.MulCoeffsBarrett(st.c1[k], st.toNTT(zs), w)
+	st.ringQ.Sub(w, st.toNTT(ze), w)
+	cu := st.toNTT(c.coeffs(st.n))
+	st.ringQ.MulCoeffsBarrett(cu, st.u[k], cu)
+	st.ringQ.Sub(w, cu, w)
+	st.ringQ.INTT(w, w)
+	return w.Coeffs[0]
+}
+
+func (st *statement) challengeHash(w [][]uint64) []byte {
+	h := sha256.New()
+	h.Write(st.prefix)
+	for k := range w {
+		for _, v := range w[k] {
+			binary.Write(h, binary.LittleEndian, v)
+		}
+	}
+	return h.Sum(nil)
+}
+
+func (st *statement) inBounds(zs []int64, ze [][]int64) bool {
+	if infNorm(zs) > st.maskS-challengeWeight {
+		return false
+	}
+	for k := range ze {
+		if infNorm(ze[k]) > st.maskE-challengeWeight*st.noiseBound {
+			return false
+		}
+	}
+	return true
+}
+
+// toNTT maps centered coefficients to a polynomial mod q in NTT form.
+func (st *statement) toNTT(coeffs []int64) ring.Poly {
+	p := st.ringQ.NewPoly()
+	q := int64(st.q)
+	for i, v := range coeffs {
+		v %= q
+		if v < 0 {
+			v += q
+		}
+		p.Coeffs[0][i] = uint64(v)
+	}
+	st.ringQ.NTT(p, p)
+	return p
+}
+
+func (st *statement) center(v uint64) int64 {
+	if v > st.q/2 {
+		return int64(v) - int64(st.q)
+	}
+	return int64(v)
+}
+
+// challenge is a ternary polynomial with up to challengeWeight nonzero coefficients.
+type challenge struct {
+	idx  []int
+	sign []int64
+}
+
+// sampleChallenge expands the commitment hash into a challenge polynomial of degree n.
+// Rings of degree below challengeWeight, such as those of tests, get a challenge with every coefficient set.
+func sampleChallenge(h []byte, n int) challenge {
+	transcript := core.NewTranscript("vdec_challenge")
+	transcript.AppendBytes("w", h)
+
+	weight := min(challengeWeight, n)
+	c := challenge{idx: make([]int, 0, weight), sign: make([]int64, 0, weight)}
+	seen := make(map[int]bool, weight)
+	for len(c.idx) < weight {
+		v := transcript.SampleUint64("c")
+		i := int((v >> 1) % uint64(n))
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		c.idx = append(c.idx, i)
+		c.sign = append(c.sign, 1-2*int64(v&1))
+	}
+	return c
+}
+
+func (c challenge) coeffs(n int) []int64 {
+	coeffs := make([]int64, n)
+	for k, i := range c.idx {
+		coeffs[i] = c.sign[k]
+	}
+	return coeffs
+}
+
+// mulChallengeAdd returns y + c*x in Z[X]/(X^n+1).
+func mulChallengeAdd(y []int64, c challenge, x []int64) []int64 {
+	n := len(y)
+	z := make([]int64, n)
+	copy(z, y)
+	for k, i := range c.idx {
+		for j := range x {
+			d := c.sign[k] * x[j]
+			if i+j < n {
+				z[i+j] += d
+			} else {
+				z[i+j-n] -= d
+			}
+		}
+	}
+	return z
+}
+
+// sampleUniform returns n coefficients uniform in [-bound, bound].
+func sampleUniform(rng *rand.Rand, n int, bound int64) []int64 {
+	v := make([]int64, n)
+	for i := range v {
+		v[i] = rng.Int64N(2*bound+1) - bound
+	}
+	return v
+}
+
+func infNorm(v []int64) int64 {
+	var norm int64
+	for _, x := range v {
+		if x == math.MinInt64 {
+			return math.MaxInt64
+		}
+		if x < 0 {
+			x = -x
+		}
+		norm = max(norm, x)
+	}
+	return norm
+}
+
+func encodeCoeffs(coeffs []int64) []byte {
+	bytes := make([]byte, 0, 8*len(coeffs))
+	for _, v := range coeffs {
+		bytes = binary.LittleEndian.AppendUint64(bytes, uint64(v))
+	}
+	return bytes
+}
+
+// encodeProof serializes the proof as the commitment hash followed by zs and every ze_k as little-endian int64s.
+func encodeProof(h []byte, zs []int64, ze [][]int64) []byte {
+	proof := make([]byte, 0, hashSize+8*len(zs)*(len(ze)+1))
+	proof = append(proof, h...)
+	proof = append(proof, encodeCoeffs(zs)...)
+	for k := range ze {
+		proof = append(proof, encodeCoeffs(ze[k])...)
+	}
+	return proof
+}
+
+func decodeProof(proof []byte, n int, count int) ([]byte, []int64, [][]int64, error) {
+	if size := hashSize + 8*n*(count+1); len(proof) != size {
+		return nil, nil, nil, fmt.Errorf("%w: proof has %d bytes, expected %d", ErrVdecProofInvalid, len(proof), size)
+	}
+	h := proof[:hashSize]
+	decode := func(offset int) []int64 {
+		coeffs := make([]int64, n)
+		for i := range n {
+			coeffs[i] = int64(binary.LittleEndian.Uint64(proof[offset+8*i:]))
+		}
+		return coeffs
+	}
+	zs := decode(hashSize)
+	ze := make([][]int64, count)
+	for k := range ze {
+		ze[k] = decode(hashSize + 8*n*(k+1))
+	}
+	return h, zs, ze, nil
+}
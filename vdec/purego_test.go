@@ -0,0 +1,87 @@
+//go:build !lazer
+
+package vdec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nulltea/lumenos/fhe"
+	"github.com/nulltea/lumenos/vdec"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// projectModulus is the plaintext modulus of the server, close to the first prime of its ciphertext modulus.
+const projectModulus = 144115188075593729
+
+func TestCheckParameters(t *testing.T) {
+	literal, err := fhe.GenerateBGVParamsForNTT(8, 12, projectModulus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := bgv.NewParametersFromLiteral(literal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vdec.CheckParameters(params, vdec.SchemeBFV, 1); !errors.Is(err, vdec.ErrTestBackend) || !errors.Is(err, vdec.ErrNoiseBudget) {
+		t.Fatalf("expected ErrTestBackend and ErrNoiseBudget for the project modulus, got %v", err)
+	}
+
+	params, err = bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             11,
+		LogQ:             []int{60, 55},
+		PlaintextModulus: Modulus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, batches := range []int{1, 4} {
+		if err := vdec.CheckParameters(params, vdec.SchemeBFV, batches); err != nil {
+			t.Errorf("CheckParameters with %d batches: %v", batches, err)
+		}
+	}
+	if err := vdec.CheckParameters(params, vdec.SchemeGBFV, 1); !errors.Is(err, vdec.ErrGBFVUnsupported) {
+		t.Errorf("expected ErrGBFVUnsupported, got %v", err)
+	}
+	if err := vdec.CheckParameters(params, vdec.SchemeBFV, 0); err == nil {
+		t.Error("accepted 0 batches")
+	}
+}
+
+// TestVdecSmallRing proves a ciphertext of a ring with fewer coefficients than the challenge weight.
+func TestVdecSmallRing(t *testing.T) {
+	params, err := bgv.NewParametersFromLiteral(bgv.ParametersLiteral{
+		LogN:             5,
+		LogQ:             []int{60},
+		PlaintextModulus: Modulus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kgen := rlwe.NewKeyGenerator(params)
+	sk, pk := kgen.GenKeyPairNew()
+
+	m := make([]uint64, params.MaxSlots())
+	for i := range m {
+		m[i] = uint64(i)
+	}
+	pt := bgv.NewPlaintext(params, params.MaxLevel())
+	if err := bgv.NewEncoder(params).Encode(m, pt); err != nil {
+		t.Fatal(err)
+	}
+	ct, err := rlwe.NewEncryptor(params, pk).EncryptNew(pt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed := []byte{1}
+	cts, ms := []*rlwe.Ciphertext{ct}, []bgv.IntegerSlice{m}
+	proof, err := vdec.CallVdecProver(seed, params, sk, cts, ms, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vdec.CallVdecVerifier(proof, seed, params, cts, ms); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,82 @@
+package vdec
+
+import (
+	"fmt"
+
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// Scheme is the FHE scheme whose decryption is proven.
+type Scheme uint8
+
+const (
+	// SchemeBFV proves decryption of BFV ciphertexts (vdec.c with LaZer, or the pure-Go prover).
+	SchemeBFV Scheme = iota
+	// SchemeGBFV proves decryption of generalized BFV ciphertexts with the LaZer prover in vdec_gbfv.c.
+	SchemeGBFV
+)
+
+func (s Scheme) String() string {
+	switch s {
+	case SchemeBFV:
+		return "BFV"
+	case SchemeGBFV:
+		return "GBFV"
+	default:
+		return fmt.Sprintf("Scheme(%d)", uint8(s))
+	}
+}
+
+func (s Scheme) valid() error {
+	if s > SchemeGBFV {
+		return fmt.Errorf("%w: %v", ErrUnknownScheme, s)
+	}
+	return nil
+}
+
+// backendID identifies the backend a proof was produced with, as proofs of different backends are not interchangeable.
+type backendID uint8
+
+const (
+	backendPureGo backendID = iota + 1
+	backendLaZer
+)
+
+func (b backendID) String() string {
+	switch b {
+	case backendPureGo:
+		return "pure-Go"
+	case backendLaZer:
+		return "LaZer"
+	default:
+		return fmt.Sprintf("backend(%d)", uint8(b))
+	}
+}
+
+const (
+	proofVersion = 1
+	// proofHeaderSize is the size of the metadata every serialized proof starts with:
+	// the format version, the scheme, the backend and the log2 of the ring degree, which selects the parameter set.
+	proofHeaderSize = 4
+)
+
+func encodeHeader(scheme Scheme, params bgv.Parameters) []byte {
+	return []byte{proofVersion, byte(scheme), byte(linkedBackend), byte(params.LogN())}
+}
+
+// checkHeader checks that proof was produced for scheme and params by the linked backend and returns the proof body.
+func checkHeader(proof []byte, scheme Scheme, params bgv.Parameters) ([]byte, error) {
+	if len(proof) < proofHeaderSize || proof[0] != proofVersion {
+		return nil, fmt.Errorf("%w: missing or unknown proof header", ErrVdecProofInvalid)
+	}
+	if got := Scheme(proof[1]); got != scheme {
+		return nil, fmt.Errorf("%w: proof for %v, expected %v", ErrSchemeMismatch, got, scheme)
+	}
+	if got := backendID(proof[2]); got != linkedBackend {
+		return nil, fmt.Errorf("%w: proof from the %v backend, but %v is linked", ErrBackendMismatch, got, linkedBackend)
+	}
+	if got := int(proof[3]); got != params.LogN() {
+		return nil, fmt.Errorf("%w: proof for LogN %d, expected %d", ErrParamsMismatch, got, params.LogN())
+	}
+	return proof[proofHeaderSize:], nil
+}
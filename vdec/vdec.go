@@ -0,0 +1,186 @@
+// Package vdec proves that a batch of columns are the decryptions of their BFV or GBFV ciphertexts.
+//
+// The proof backend is selected at build time: with the `lazer` build tag the LaZer prover is linked through cgo
+// (see ./c/), otherwise a pure-Go prover is used and the package builds without the C toolchain. The pure-Go prover
+// is for tests only: it refuses the server's parameters with ErrTestBackend.
+// Both backends expose CallVdecProver and CallVdecVerifier, but their proofs are not interchangeable.
+// Both amortize the proof over the batched ciphertexts; LaZer proves up to 12288*64/N of them in a single proof of
+// constant size, and rejects more with ErrTooManyCiphertexts.
+// The scheme is chosen per proof: the LaZer build links both the BFV and the GBFV prover.
+package vdec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nulltea/lumenos/core"
+	"github.com/nulltea/lumenos/vdec/batching"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/bgv"
+)
+
+// DefaultBatches is the number of independent batches of the columns a proof covers unless configured otherwise.
+const DefaultBatches = 1
+
+// seedSize is the size of the proof seed in bytes.
+const seedSize = 32
+
+// CheckParameters reports whether proofs over batches batched ciphertexts can be generated with the linked backend
+// under params, so that callers can reject unsuitable parameters before encrypting anything.
+// The pure-Go backend needs a noise budget at level 0, which plaintext moduli close to the first prime leave none of,
+// and returns ErrTestBackend without it.
+func CheckParameters(params bgv.Parameters, scheme Scheme, batches int) error {
+	if err := scheme.valid(); err != nil {
+		return err
+	}
+	if batches <= 0 {
+		return fmt.Errorf("%w: %d batches", core.ErrInvalidSize, batches)
+	}
+	return checkParameters(params, scheme, batches)
+}
+
+// ProveBfvDecBatched proves that the instance values are the decryptions of the instance ciphertexts under witness.
+// The columns are reduced to batches random linear combinations with challenges sampled from transcript, which are
+// proven by the linked backend; the serialized proof is returned.
+// Soundness of the batching improves with the number of batches.
+// The proof seed is derived from transcript after absorbing the batched statements, so callers should first append
+// anything the proof must be bound to (e.g. the Ligero root).
+// The proof starts with a header recording scheme, the linked backend and the ring degree, which VerifyBfvDecBatched
+// checks before anything else. With the LaZer backend, the parameter set is selected from the ring degree.
+func ProveBfvDecBatched(instance []*batching.ColumnInstance, witness *rlwe.SecretKey, backend *bgv.Evaluator, field *core.PrimeField, transcript *core.Transcript, scheme Scheme, batches int, parentSpan *core.Span) ([]byte, error) {
+	if err := scheme.valid(); err != nil {
+		return nil, err
+	}
+	params := *backend.GetParameters()
+
+	batchCts, ms, err := batching.Batch(instance, batches, backend, field, transcript, parentSpan)
+	if err != nil {
+		return nil, err
+	}
+
+	seed := deriveSeed(transcript, batchCts, ms)
+
+	var proof []byte
+	switch scheme {
+	case SchemeGBFV:
+		proof, err = callGBFVProver(seed, params, witness, batchCts, integerSlices(ms), parentSpan)
+	default:
+		proof, err = CallVdecProver(seed, params, witness, batchCts, integerSlices(ms), parentSpan)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append(encodeHeader(scheme, params), proof...), nil
+}
+
+// VerifyBfvDecBatched checks a proof produced by ProveBfvDecBatched for the same instance, scheme and number of batches.
+// The verifier needs no secret key; transcript must be in the same state as the prover's
+// so that the batching challenges and the proof seed are re-derived identically.
+// GBFV proofs are checked by the prover only, so they are rejected with ErrGBFVUnsupported.
+func VerifyBfvDecBatched(proof []byte, instance []*batching.ColumnInstance, params bgv.Parameters, field *core.PrimeField, transcript *core.Transcript, scheme Scheme, batches int) error {
+	if err := scheme.valid(); err != nil {
+		return err
+	}
+	body, err := checkHeader(proof, scheme, params)
+	if err != nil {
+		return err
+	}
+	if scheme == SchemeGBFV {
+		return fmt.Errorf("%w: vdec_gbfv.c does not serialize its proofs", ErrGBFVUnsupported)
+	}
+
+	backend := bgv.NewEvaluator(params, nil)
+	batchCts, ms, err := batching.Batch(instance, batches, backend, field, transcript, nil)
+	if err != nil {
+		return err
+	}
+
+	seed := deriveSeed(transcript, batchCts, ms)
+
+	return CallVdecVerifier(body, seed, params, batchCts, integerSlices(ms))
+}
+
+// deriveSeed binds the proof to the transcript by absorbing the batched statements
+// and extracting the seed for the proof's public randomness and Fiat-Shamir challenges.
+func deriveSeed(transcript *core.Transcript, batchCts []*rlwe.Ciphertext, ms [][]uint64) []byte {
+	for k := range batchCts {
+		transcript.AppendCiphertext("vdec_ct", batchCts[k])
+		values := make([]byte, 0, core.ElementBytes*len(ms[k]))
+		for i := range ms[k] {
+			values = binary.LittleEndian.AppendUint64(values, ms[k][i])
+		}
+		transcript.AppendBytes("vdec_m", values)
+	}
+	return transcript.ExtractBytes([]byte("vdec_seed"), seedSize)
+}
+
+func integerSlices(ms [][]uint64) []bgv.IntegerSlice {
+	slices := make([]bgv.IntegerSlice, len(ms))
+	for k := range ms {
+		slices[k] = ms[k]
+	}
+	return slices
+}
+
+func GenerateHeaderFile(fileName string, sk *rlwe.SecretKey, ct *rlwe.Ciphertext, m bgv.IntegerSlice, params bgv.Parameters) error {
+	skRingQ := params.RingQ().AtLevel(sk.LevelQ())
+	ringQ := params.RingQ().AtLevel(ct.LevelQ())
+	modQ := ringQ.ModulusAtLevel[ct.LevelQ()]
+	modT := params.RingT().Modulus()
+
+	skCoeffsString := core.RingPolyToStringsCentered(skRingQ, *sk.Value.Q.CopyNew(), true, true)
+	ct0String := core.RingPolyToStringsCentered(ringQ, *ct.Value[0].CopyNew(), ct.MetaData.IsMontgomery, ct.MetaData.IsNTT)
+	ct1String := core.RingPolyToStringsCentered(ringQ, *ct.Value[1].CopyNew(), ct.MetaData.IsMontgomery, ct.MetaData.IsNTT)
+
+	pt := bgv.NewPlaintext(params, params.MaxLevel())
+	pt.MetaData = ct.MetaData
+	bgv.NewEncoder(params).Encode(m, pt)
+	ptPoly := pt.Value
+
+	ptString := core.RingPolyToStringsCentered(ringQ, ptPoly, false, false)
+
+	formatForHeader := func(values []string) string {
+		var builder strings.Builder
+		for i, val := range values {
+			if i > 0 && i%5 == 0 {
+				builder.WriteString(",\n    ")
+			} else if i > 0 {
+				builder.WriteString(", ")
+			}
+			builder.WriteString(val)
+		}
+		return builder.String()
+	}
+
+	modQStr := strconv.FormatUint(modQ.Uint64(), 10)
+	modTStr := strconv.FormatUint(modT.Uint64(), 10)
+
+	headerContent := fmt.Sprintf(`#ifndef VDEC_CT_H
+#define VDEC_CT_H
+#include <stdint.h>
+
+// Modulus Q = %s
+// Modulus T = %s
+
+static const int64_t static_sk[] = {
+    %s
+};
+static const int64_t static_ct0[] = {
+    %s
+};
+static const int64_t static_ct1[] = {
+    %s
+};
+static const int64_t static_m_delta[] = {
+    %s
+};
+
+#endif /* VDEC_CT_H */
+`, modQStr, modTStr, formatForHeader(skCoeffsString), formatForHeader(ct0String), formatForHeader(ct1String), formatForHeader(ptString))
+
+	return os.WriteFile(fileName, []byte(headerContent), 0644)
+}